@@ -0,0 +1,26 @@
+package main
+
+import (
+	"fmt"
+	nethttp "net/http"
+	"os"
+	"time"
+)
+
+// healthcheck requests the readiness endpoint of the running server and returns the exit code.
+// It lets docker check the health of the scratch image, which has no curl or wget.
+func healthcheck() int {
+	client := nethttp.Client{Timeout: 3 * time.Second}
+	res, err := client.Get(fmt.Sprintf("http://127.0.0.1:%s/readyz", os.Getenv("SERVER_PORT")))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "health check failed:", err)
+		return 1
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != nethttp.StatusOK {
+		fmt.Fprintln(os.Stderr, "health check failed:", res.Status)
+		return 1
+	}
+	return 0
+}
@@ -1,54 +1,378 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"log/slog"
+	nethttp "net/http"
 	"os"
+	"time"
 
 	"example.com/rest/internal/config"
+	"example.com/rest/internal/health"
 	"example.com/rest/internal/http"
 	"example.com/rest/internal/jwt"
+	"example.com/rest/internal/logging"
+	"example.com/rest/internal/mail"
+	"example.com/rest/internal/metrics"
+	"example.com/rest/internal/oidc"
+	"example.com/rest/internal/password"
 	"example.com/rest/internal/postgres"
+	"example.com/rest/internal/ratelimit"
 	"example.com/rest/internal/services"
+	"example.com/rest/internal/tracing"
+	"github.com/jackc/pgx/v5"
 )
 
 func main() {
-	// Initialize logger
-	logger := slog.New(slog.NewJSONHandler(os.Stdout, nil))
+	// Used by the docker health check: /app/bin healthcheck
+	if len(os.Args) > 1 && os.Args[1] == "healthcheck" {
+		os.Exit(healthcheck())
+	}
 
-	if err := run(logger); err != nil {
-		logger.Error("server failed", "error", err)
+	if err := run(); err != nil {
+		// the configured logger may not exist yet, errors go to stderr
+		slog.New(slog.NewJSONHandler(os.Stderr, nil)).Error("server failed", "error", err)
+		os.Exit(1)
 	}
 }
 
-func run(logger *slog.Logger) error {
+func run() error {
 	// Load configuration
 	cfg, err := config.Load()
 	if err != nil {
 		return err
 	}
 
+	// Initialize logger, it is also the default logger for code without a request logger
+	logger, logOutput, closeLog, err := logging.New(logging.Config{
+		Level:          cfg.Log.Level,
+		Format:         cfg.Log.Format,
+		File:           cfg.Log.File,
+		FileMaxSize:    cfg.Log.FileMaxSize,
+		FileMaxBackups: cfg.Log.FileMaxBackups,
+		SampleInitial:  cfg.Log.SampleInitial,
+		SampleEvery:    cfg.Log.SampleEvery,
+		SampleInterval: cfg.Log.SampleInterval,
+	})
+	if err != nil {
+		return err
+	}
+	defer closeLog()
+	slog.SetDefault(logger)
+
+	// Initialize tracing, remaining spans are flushed when run returns
+	shutdownTracing, err := tracing.Setup(context.Background(), tracing.Config{
+		Exporter:    cfg.Tracing.Exporter,
+		File:        cfg.Tracing.File,
+		ServiceName: cfg.Tracing.ServiceName,
+		SampleRatio: cfg.Tracing.SampleRatio,
+	})
+	if err != nil {
+		return err
+	}
+	defer func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := shutdownTracing(ctx); err != nil {
+			logger.Error("failed to flush traces", "error", err)
+		}
+	}()
+
+	// Initialize health checks, components register their own checks
+	healthRegistry := health.NewRegistry()
+
+	// Initialize metrics
+	appMetrics := metrics.New()
+
 	// Connect to database
-	db, err := postgres.New(cfg.DB.URL)
+	db, err := postgres.New(cfg.DB.URL, postgres.PoolConfig{
+		MaxConns:               int32(cfg.DB.MaxConns),
+		MinConns:               int32(cfg.DB.MinConns),
+		MaxConnLifetime:        cfg.DB.MaxConnLifetime,
+		MaxConnIdleTime:        cfg.DB.MaxConnIdleTime,
+		HealthCheckPeriod:      cfg.DB.HealthCheckPeriod,
+		StatementCacheCapacity: cfg.DB.StatementCacheCapacity,
+	}, healthRegistry)
 	if err != nil {
 		return err
 	}
+	defer db.Close()
+	appMetrics.RegisterDB(db, "postgres")
 
 	// Initialize repositories
 	userRepo := postgres.NewUserRepo(db)
+	idempotencyRepo := postgres.NewIdempotencyRepo(db)
+	refreshTokenRepo := postgres.NewRefreshTokenRepo(db)
+	roleRepo := postgres.NewRoleRepo(db)
+	apiKeyRepo := postgres.NewAPIKeyRepo(db)
+	sessionRepo := postgres.NewSessionRepo(db)
+	userTokenRepo := postgres.NewUserTokenRepo(db)
+	mfaRepo := postgres.NewMFARepo(db)
+	loginFailureRepo := postgres.NewLoginFailureRepo(db)
+	authEventRepo := postgres.NewAuthEventRepo(db)
+	identityRepo := postgres.NewIdentityRepo(db)
+	txManager := postgres.NewTxManager(db, postgres.TxOptions{
+		Isolation:  isolationLevel(cfg.DB.TxIsolation),
+		MaxRetries: cfg.DB.TxMaxRetries,
+	})
+
+	// Initialize mailer
+	mailSender, closeMail, err := newMailSender(cfg.Mail.Sender, cfg.Mail.File, cfg.Mail.SMTPHost, cfg.Mail.SMTPPort, cfg.Mail.SMTPUsername, cfg.Mail.SMTPPassword)
+	if err != nil {
+		return err
+	}
+	defer closeMail()
+	mailer, err := mail.NewMailer(mailSender, cfg.Mail.From)
+	if err != nil {
+		return err
+	}
+
+	// Initialize OIDC providers, the router serves the mock provider at the path of its issuer URL
+	var oidcProviders []*oidc.Provider
+	for _, p := range cfg.OIDC.Providers {
+		oidcProviders = append(oidcProviders, oidc.NewProvider(oidc.Config{
+			Name:         p.Name,
+			Type:         p.Type,
+			Issuer:       p.Issuer,
+			ClientID:     p.ClientID,
+			ClientSecret: p.ClientSecret,
+			Scopes:       p.Scopes,
+		}))
+	}
+	var mockOIDC *oidc.MockProvider
+	if cfg.OIDC.Mock {
+		mockOIDC, err = oidc.NewMockProvider(cfg.OIDC.MockIssuer)
+		if err != nil {
+			return err
+		}
+		oidcProviders = append(oidcProviders, oidc.NewProvider(oidc.Config{
+			Name:       "mock",
+			Issuer:     mockOIDC.Issuer(),
+			ClientID:   "mock",
+			HTTPClient: mockOIDC.Client(),
+			Mock:       true,
+		}))
+		logger.Warn("mock OIDC provider enabled, it signs in anyone with any email", "issuer", mockOIDC.Issuer())
+	}
 
 	// Initialize services
-	userService := services.NewUserService(userRepo)
-	authService := jwt.NewAuthService(cfg.JWT.Secret, cfg.JWT.Duration)
+	hasher, blocklist, err := newPasswordHasher(cfg.Password.Hasher, cfg.Password.Argon2Memory, cfg.Password.Argon2Iterations, cfg.Password.Argon2Parallelism, cfg.Password.BcryptCost, cfg.Password.BlocklistFile)
+	if err != nil {
+		return err
+	}
+	passwords := services.NewPasswords(hasher, blocklist)
+	auditService := services.NewAuditService(authEventRepo, txManager)
+	loginThrottle := services.NewLoginThrottle(loginFailureRepo, services.LoginPolicy{
+		MaxFailures:     cfg.Login.MaxFailures,
+		IPMaxFailures:   cfg.Login.IPMaxFailures,
+		Delay:           cfg.Login.Delay,
+		LockoutDuration: cfg.Login.LockoutDuration,
+	})
+	userService := services.NewUserService(userRepo, txManager, passwords, loginThrottle, auditService, services.UserCounters{
+		Registrations: appMetrics.Counter("user_registrations_total", "Total number of user registrations."),
+		FailedLogins:  appMetrics.Counter("user_failed_logins_total", "Total number of failed login attempts."),
+	})
+	keySet, err := loadKeySet(cfg.JWT.Secret, cfg.JWT.SigningKeyFile, cfg.JWT.VerificationKeyFiles)
+	if err != nil {
+		return err
+	}
+	authService := jwt.NewAuthService(keySet, cfg.JWT.Duration, cfg.JWT.Issuer, cfg.JWT.Audience)
+	tokenService := services.NewTokenService(refreshTokenRepo, roleRepo, authService.GenerateToken, cfg.JWT.RefreshDuration)
+	roleService := services.NewRoleService(roleRepo)
+	apiKeyService := services.NewAPIKeyService(apiKeyRepo, roleRepo)
+	accountService := services.NewAccountService(userRepo, userTokenRepo, txManager, passwords, loginThrottle, auditService, mailer, cfg.Mail.AppURL, refreshTokenRepo, sessionRepo, apiKeyRepo)
+	mfaService := services.NewMFAService(mfaRepo, userRepo, loginThrottle, auditService, cfg.MFA.Issuer)
+	oidcService := services.NewOIDCService(oidcProviders, cfg.OIDC.RedirectURL, identityRepo, userRepo, txManager, passwords, auditService)
+	sessionService := services.NewSessionService(sessionRepo, roleRepo, cfg.Session.IdleTimeout, cfg.Session.AbsoluteTimeout)
+	idempotencyService := services.NewIdempotencyService(idempotencyRepo, cfg.Idempotency.TTL)
+
+	// Initialize rate limit store
+	var rateLimitStore ratelimit.Store = ratelimit.NewMemoryStore()
+	if cfg.RateLimit.Store == "postgres" {
+		rateLimitStore = postgres.NewRateLimitStore(db)
+	}
+
+	// Start background jobs, they stop when run returns
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go runPeriodically(ctx, "delete expired idempotency keys", time.Hour, idempotencyService.DeleteExpired, logger)
+	go runPeriodically(ctx, "delete expired refresh tokens", time.Hour, tokenService.DeleteExpired, logger)
+	go runPeriodically(ctx, "delete expired sessions", time.Hour, sessionService.DeleteExpired, logger)
+	go runPeriodically(ctx, "delete expired user tokens", time.Hour, accountService.DeleteExpired, logger)
+	go runPeriodically(ctx, "delete expired mfa challenges", time.Hour, mfaService.DeleteExpired, logger)
+	go runPeriodically(ctx, "delete stale login failures", time.Hour, loginThrottle.DeleteStale, logger)
+	go runPeriodically(ctx, "delete expired oidc states", time.Hour, oidcService.DeleteExpired, logger)
+	if store, ok := rateLimitStore.(*postgres.RateLimitStore); ok {
+		go runPeriodically(ctx, "delete full rate limit buckets", 10*time.Minute, store.DeleteFull, logger)
+	}
 
 	// Initialize handlers and middlewares
-	baseHandler := http.NewBaseHandler(logger)
-	userHandler := http.NewUserHandler(baseHandler, userService, authService.GenerateToken)
-	middlewares := http.NewMiddlewares(baseHandler, authService.ValidateToken, logger)
+	baseHandler := http.NewBaseHandler(logger, http.ErrorFormat(cfg.Server.ErrorFormat), cfg.Server.RequireIfMatch)
+	userHandler := http.NewUserHandler(baseHandler, userService, tokenService, apiKeyService, accountService, mfaService, oidcService)
+	sessionHandler := http.NewSessionHandler(baseHandler, userService, sessionService, mfaService, oidcService, http.SessionCookie{
+		Secure:   cfg.Session.CookieSecure,
+		SameSite: sameSite(cfg.Session.CookieSameSite),
+		MaxAge:   cfg.Session.AbsoluteTimeout,
+	}, cfg.Server.TrustedProxyHeaders)
+	mfaHandler := http.NewMFAHandler(baseHandler, mfaService)
+	oidcHandler := http.NewOIDCHandler(baseHandler, oidcService)
+	adminHandler := http.NewAdminHandler(baseHandler, userService, roleService, auditService)
+	healthHandler := http.NewHealthHandler(baseHandler, healthRegistry)
+	// admins without MFA are refused on the admin routes
+	var adminMFAEnabled func(context.Context, int) (bool, error)
+	if cfg.MFA.RequiredForAdmin {
+		adminMFAEnabled = mfaService.Enabled
+	}
+	middlewares := http.NewMiddlewares(
+		baseHandler,
+		authService.ValidateToken,
+		apiKeyService.Authenticate,
+		sessionService.Authenticate,
+		adminMFAEnabled,
+		http.AuthMode(cfg.Auth.Mode),
+		idempotencyService,
+		rateLimitStore,
+		cfg.Server.TrustedProxyHeaders,
+		appMetrics,
+		nil, // error reporter for recovered panics, e.g. a Sentry client
+		http.AccessLogFormat(cfg.Server.AccessLogFormat),
+		logOutput,
+		logger,
+	)
 
 	// Initialize router
-	router := http.NewRouter(userHandler, middlewares)
+	router := http.NewRouter(userHandler, sessionHandler, mfaHandler, oidcHandler, adminHandler, healthHandler, keySet.Handler(), mockOIDC, middlewares)
+
+	// Start admin server, it is shut down after the API server
+	adminServer := http.NewAdminServer(cfg.Server.AdminAddr(), http.NewAdminRouter(appMetrics.Handler()))
+	go func() {
+		logger.Info("starting admin server", "address", adminServer.Addr)
+		if err := adminServer.ListenAndServe(); err != nil && !errors.Is(err, nethttp.ErrServerClosed) {
+			logger.Error("admin server failed", "error", err)
+		}
+	}()
 
 	// Start server
-	server := http.NewServer(cfg.Server.Addr(), router, logger)
-	return server.Start()
+	server := http.NewServer(cfg.Server.Addr(), router, healthRegistry, cfg.Server.ShutdownDelay, logger)
+	err = server.Start()
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := adminServer.Shutdown(shutdownCtx); err != nil {
+		logger.Error("failed to shutdown admin server", "error", err)
+	}
+
+	// finish sending emails before the mailer is closed
+	accountService.Wait()
+	return err
+}
+
+// loadKeySet creates the JWT key set.
+// Tokens are signed with the key in signingKeyFile if set, otherwise with the HS256 secret.
+func loadKeySet(secret, signingKeyFile string, verificationKeyFiles []string) (*jwt.KeySet, error) {
+	if signingKeyFile == "" {
+		return jwt.NewKeySet(jwt.NewHMACKey(secret))
+	}
+
+	signingKey, err := jwt.LoadKeyFile(signingKeyFile)
+	if err != nil {
+		return nil, err
+	}
+
+	verificationKeys := make([]*jwt.Key, 0, len(verificationKeyFiles))
+	for _, file := range verificationKeyFiles {
+		key, err := jwt.LoadKeyFile(file)
+		if err != nil {
+			return nil, err
+		}
+		verificationKeys = append(verificationKeys, key)
+	}
+
+	return jwt.NewKeySet(signingKey, verificationKeys...)
+}
+
+// newMailSender returns the configured mail sender and a function closing it.
+func newMailSender(sender, file, smtpHost, smtpPort, smtpUsername, smtpPassword string) (mail.Sender, func() error, error) {
+	noop := func() error { return nil }
+	switch sender {
+	case "smtp":
+		return mail.NewSMTPSender(smtpHost, smtpPort, smtpUsername, smtpPassword), noop, nil
+	case "file":
+		return mail.OpenFileOutbox(file)
+	default:
+		return mail.NewOutbox(os.Stdout), noop, nil
+	}
+}
+
+// newPasswordHasher returns the hasher of new passwords, which also verifies hashes of the other algorithm,
+// and the blocklist of passwords that can't be chosen, nil without a file.
+func newPasswordHasher(hasher string, memory, iterations uint32, parallelism uint8, bcryptCost int, blocklistFile string) (password.Hasher, *password.Blocklist, error) {
+	argon2id := password.NewArgon2id(password.Argon2Params{
+		Memory:      memory,
+		Iterations:  iterations,
+		Parallelism: parallelism,
+		SaltLength:  password.DefaultArgon2Params.SaltLength,
+		KeyLength:   password.DefaultArgon2Params.KeyLength,
+	})
+	bcrypt := password.NewBcrypt(bcryptCost)
+
+	preferred := password.New(argon2id, bcrypt)
+	if hasher == "bcrypt" {
+		preferred = password.New(bcrypt, argon2id)
+	}
+
+	if blocklistFile == "" {
+		return preferred, nil, nil
+	}
+	blocklist, err := password.LoadBlocklist(blocklistFile)
+	if err != nil {
+		return nil, nil, err
+	}
+	return preferred, blocklist, nil
+}
+
+// isolationLevel returns the isolation level for the configured value.
+func isolationLevel(value string) pgx.TxIsoLevel {
+	switch value {
+	case "repeatable_read":
+		return pgx.RepeatableRead
+	case "serializable":
+		return pgx.Serializable
+	default:
+		return pgx.ReadCommitted
+	}
+}
+
+// runPeriodically runs a cleanup job every interval until the context is canceled.
+// The job returns the number of affected rows, which is logged.
+func runPeriodically(ctx context.Context, name string, interval time.Duration, job func(context.Context) (int64, error), logger *slog.Logger) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			count, err := job(ctx)
+			if err != nil {
+				logger.Error("background job failed", "job", name, "error", err)
+				continue
+			}
+			logger.Info("background job completed", "job", name, "count", count)
+		}
+	}
+}
+
+// sameSite returns the SameSite attribute for the configured value.
+func sameSite(value string) nethttp.SameSite {
+	switch value {
+	case "strict":
+		return nethttp.SameSiteStrictMode
+	case "none":
+		return nethttp.SameSiteNoneMode
+	default:
+		return nethttp.SameSiteLaxMode
+	}
 }
@@ -6,10 +6,11 @@ import (
 	"fmt"
 	"log/slog"
 	"os"
+	"strings"
 
 	"example.com/rest/internal/config"
 	"github.com/golang-migrate/migrate/v4"
-	_ "github.com/golang-migrate/migrate/v4/database/postgres"
+	_ "github.com/golang-migrate/migrate/v4/database/pgx/v5"
 	_ "github.com/golang-migrate/migrate/v4/source/file"
 	"github.com/joho/godotenv"
 )
@@ -32,8 +33,8 @@ func run(logger *slog.Logger) error {
 	if err != nil {
 		return err
 	}
-	// Create migrator
-	m, err := migrate.New("file://migrations", DB_URL)
+	// Create migrator, the pgx v5 driver of migrate is selected by the pgx5 scheme
+	m, err := migrate.New("file://migrations", "pgx5://"+strings.TrimPrefix(DB_URL, "postgres://"))
 	if err != nil {
 		return fmt.Errorf("failed to create migrator: %w", err)
 	}
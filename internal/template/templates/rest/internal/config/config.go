@@ -4,6 +4,8 @@ package config
 import (
 	"fmt"
 	"os"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/joho/godotenv"
@@ -11,23 +13,138 @@ import (
 
 // config represents the application configuration
 type config struct {
-	DB     db
-	Server server
-	JWT    jwt
+	DB          db
+	Server      server
+	JWT         jwt
+	Auth        auth
+	Session     session
+	Login       login
+	Password    password
+	Mail        mail
+	MFA         mfa
+	OIDC        oidc
+	Idempotency idempotency
+	RateLimit   rateLimit
+	Tracing     tracing
+	Log         log
 }
 
 type db struct {
-	URL string
+	URL                    string
+	MaxConns               int
+	MinConns               int
+	MaxConnLifetime        time.Duration
+	MaxConnIdleTime        time.Duration
+	HealthCheckPeriod      time.Duration
+	StatementCacheCapacity int
+	TxIsolation            string
+	TxMaxRetries           int
 }
 
 type server struct {
-	Host string
-	Port string
+	Host                string
+	Port                string
+	ErrorFormat         string
+	AccessLogFormat     string
+	RequireIfMatch      bool
+	TrustedProxyHeaders []string
+	ShutdownDelay       time.Duration
+	AdminPort           string
 }
 
 type jwt struct {
-	Secret   string
-	Duration time.Duration
+	Secret               string
+	SigningKeyFile       string
+	VerificationKeyFiles []string
+	Duration             time.Duration
+	RefreshDuration      time.Duration
+	Issuer               string
+	Audience             string
+}
+
+type auth struct {
+	Mode string
+}
+
+type session struct {
+	IdleTimeout     time.Duration
+	AbsoluteTimeout time.Duration
+	CookieSecure    bool
+	CookieSameSite  string
+}
+
+type login struct {
+	MaxFailures     int
+	IPMaxFailures   int
+	Delay           time.Duration
+	LockoutDuration time.Duration
+}
+
+type password struct {
+	Hasher            string
+	Argon2Memory      uint32
+	Argon2Iterations  uint32
+	Argon2Parallelism uint8
+	BcryptCost        int
+	BlocklistFile     string
+}
+
+type mail struct {
+	AppURL       string
+	Sender       string
+	From         string
+	File         string
+	SMTPHost     string
+	SMTPPort     string
+	SMTPUsername string
+	SMTPPassword string
+}
+
+type mfa struct {
+	Issuer           string
+	RequiredForAdmin bool
+}
+
+type oidc struct {
+	Providers   []oidcProvider
+	RedirectURL string
+	Mock        bool
+	MockIssuer  string
+}
+
+type oidcProvider struct {
+	Name         string
+	Type         string
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+	Scopes       []string
+}
+
+type idempotency struct {
+	TTL time.Duration
+}
+
+type rateLimit struct {
+	Store string
+}
+
+type tracing struct {
+	Exporter    string
+	File        string
+	ServiceName string
+	SampleRatio float64
+}
+
+type log struct {
+	Level          string
+	Format         string
+	File           string
+	FileMaxSize    int64
+	FileMaxBackups int
+	SampleInitial  int
+	SampleEvery    int
+	SampleInterval time.Duration
 }
 
 /*
@@ -42,12 +159,90 @@ It expects the following environment variables:
 	PGHOST
 	PGDATABASE
 	PGSSLMODE
+	DB_MAX_CONNS (optional, maximum number of connections of the pool, defaults to "20")
+	DB_MIN_CONNS (optional, connections kept open when idle, defaults to "2")
+	DB_MAX_CONN_LIFETIME (optional, connections are closed and replaced after that, defaults to "1h")
+	DB_MAX_CONN_IDLE_TIME (optional, idle connections above DB_MIN_CONNS are closed after that, defaults to "5m")
+	DB_HEALTH_CHECK_PERIOD (optional, how often idle connections are checked, defaults to "1m")
+	DB_STATEMENT_CACHE_CAPACITY (optional, prepared statements cached per connection, "0" disables the cache for PgBouncer in transaction mode, defaults to "512")
+	DB_TX_ISOLATION (optional, "read_committed", "repeatable_read" or "serializable" isolation of transactions, defaults to "read_committed")
+	DB_TX_MAX_RETRIES (optional, retries of transactions after serialization failures and deadlocks, defaults to "3")
+
+	JWT_SECRET (required unless JWT_SIGNING_KEY_FILE is set)
+	JWT_SIGNING_KEY_FILE (optional, PEM private key for RS256, ES256 or EdDSA signing instead of the HS256 secret)
+	JWT_VERIFICATION_KEY_FILES (optional, comma separated PEM public keys still accepted during key rotation)
+	JWT_DURATION (lifetime of access tokens, keep it short as they can't be revoked, e.g. "15m")
+	JWT_REFRESH_DURATION (optional, lifetime of refresh tokens, defaults to "720h")
+	JWT_ISSUER (optional, iss claim added to tokens and required when validating)
+	JWT_AUDIENCE (optional, aud claim added to tokens and required when validating)
+
+	AUTH_MODE (optional, "jwt" for bearer tokens or "session" for cookie sessions, defaults to "jwt")
+
+	SESSION_IDLE_TIMEOUT (optional, sessions without requests for this long end, defaults to "30m")
+	SESSION_ABSOLUTE_TIMEOUT (optional, sessions end after this long regardless of activity, defaults to "24h")
+	SESSION_COOKIE_SECURE (optional, "false" allows the cookies over plain HTTP for local development, defaults to "true")
+	SESSION_COOKIE_SAMESITE (optional, "lax", "strict" or "none", defaults to "lax")
+
+	LOGIN_MAX_FAILURES (optional, failed logins of an account until it is locked, defaults to "5")
+	LOGIN_IP_MAX_FAILURES (optional, failed logins from a client IP until it is locked, defaults to "20")
+	LOGIN_DELAY (optional, wait after the first failed login of an account, doubled with every failure, "0" disables it, defaults to "1s")
+	LOGIN_LOCKOUT_DURATION (optional, how long accounts and IPs are locked, defaults to "15m")
+
+	PASSWORD_HASHER (optional, "argon2id" or "bcrypt" for new hashes, hashes of the other are still verified and replaced on login, defaults to "argon2id")
+	ARGON2_MEMORY (optional, memory of argon2id in KiB, defaults to "19456")
+	ARGON2_ITERATIONS (optional, iterations of argon2id, defaults to "2")
+	ARGON2_PARALLELISM (optional, threads of argon2id, defaults to "1")
+	BCRYPT_COST (optional, cost of bcrypt, defaults to "10")
+	PASSWORD_BLOCKLIST_FILE (optional, file with one common or breached password per line that can't be chosen)
 
-	JWT_SECRET
-	JWT_DURATION
+	APP_URL (optional, base URL of the app that the links in emails point to, defaults to "http://localhost:8080")
+	MAIL_SENDER (optional, "stdout", "file" or "smtp", defaults to "stdout")
+	MAIL_FROM (optional, sender address of emails, defaults to "no-reply@example.com")
+	MAIL_FILE (required for the "file" sender, emails are appended to it)
+	SMTP_HOST (required for the "smtp" sender)
+	SMTP_PORT (optional, defaults to "587")
+	SMTP_USERNAME (optional, emails are sent without authentication if empty)
+	SMTP_PASSWORD (optional)
+
+	MFA_ISSUER (optional, name shown next to the account in authenticator apps, defaults to "API")
+	MFA_REQUIRED_FOR_ADMIN (optional, "false" lets admins without MFA use the admin routes, defaults to "true")
 
 	SERVER_HOST
 	SERVER_PORT
+	SERVER_ERROR_FORMAT (optional, "json" or "problem", defaults to "json")
+	SERVER_ACCESS_LOG_FORMAT (optional, "json" or "combined", defaults to "json")
+	SERVER_REQUIRE_IF_MATCH (optional, "true" rejects updates and deletes without If-Match, defaults to "false")
+	SERVER_TRUSTED_PROXY_HEADERS (optional, comma separated headers holding the client IP, e.g. "X-Forwarded-For")
+	SERVER_SHUTDOWN_DELAY (optional, how long to keep serving after readiness fails on shutdown, defaults to "0s")
+	SERVER_ADMIN_PORT (optional, port of the admin listener serving /metrics, defaults to "9090")
+
+	OIDC_PROVIDERS (optional, comma separated names of OpenID Connect providers, e.g. "google")
+	OIDC_<NAME>_TYPE (optional, "oidc" or "github" for GitHub OAuth apps, defaults to "oidc")
+	OIDC_<NAME>_ISSUER (required for every OIDC provider, e.g. OIDC_GOOGLE_ISSUER="https://accounts.google.com")
+	OIDC_<NAME>_CLIENT_ID (required for every provider)
+	OIDC_<NAME>_CLIENT_SECRET (optional, empty for public clients)
+	OIDC_<NAME>_SCOPES (optional, comma separated scopes besides "openid", defaults to "email,profile", for GitHub to "read:user,user:email")
+	OIDC_REDIRECT_URL (optional, page of the app the providers redirect back to, defaults to APP_URL + "/oidc/callback")
+	OIDC_MOCK (optional, "true" enables the mock provider "mock" for local development, defaults to "false")
+	OIDC_MOCK_ISSUER (optional, URL the mock provider is served at, defaults to "http://localhost:" + SERVER_PORT + "/oidc/mock")
+
+	IDEMPOTENCY_TTL (optional, how long responses are kept for Idempotency-Key replays, defaults to "24h")
+
+	RATE_LIMIT_STORE (optional, "memory" or "postgres", defaults to "memory")
+
+	TRACING_EXPORTER (optional, "none", "stdout", "file" or "otlp", defaults to "none")
+	TRACING_FILE (required for the "file" exporter)
+	TRACING_SERVICE_NAME (optional, defaults to "api")
+	TRACING_SAMPLE_RATIO (optional, between 0 and 1, defaults to "1")
+
+	LOG_LEVEL (optional, "debug", "info", "warn" or "error", defaults to "info")
+	LOG_FORMAT (optional, "json" or "text", defaults to "json")
+	LOG_FILE (optional, logs are written to stdout if empty)
+	LOG_FILE_MAX_SIZE (optional, size in MB at which the log file is rotated, defaults to "100")
+	LOG_FILE_MAX_BACKUPS (optional, number of rotated log files kept, defaults to "5")
+	LOG_SAMPLING_INITIAL (optional, debug and info records per message and interval that are always logged, defaults to "0" which disables sampling)
+	LOG_SAMPLING_THEREAFTER (optional, only every n-th record is logged after that, defaults to "100")
+	LOG_SAMPLING_INTERVAL (optional, defaults to "1s")
 */
 func Load() (*config, error) {
 	// Load environment variables, can be omitted if you don't use .env file and inject all variables via environment
@@ -59,10 +254,90 @@ func Load() (*config, error) {
 		return nil, err
 	}
 
+	DB_MAX_CONNS := 20
+	if value := os.Getenv("DB_MAX_CONNS"); value != "" {
+		DB_MAX_CONNS, err = strconv.Atoi(value)
+		if err != nil || DB_MAX_CONNS < 1 {
+			return nil, fmt.Errorf("DB_MAX_CONNS is invalid")
+		}
+	}
+
+	DB_MIN_CONNS := 2
+	if value := os.Getenv("DB_MIN_CONNS"); value != "" {
+		DB_MIN_CONNS, err = strconv.Atoi(value)
+		if err != nil || DB_MIN_CONNS < 0 {
+			return nil, fmt.Errorf("DB_MIN_CONNS is invalid")
+		}
+	}
+	if DB_MIN_CONNS > DB_MAX_CONNS {
+		return nil, fmt.Errorf("DB_MIN_CONNS must not be greater than DB_MAX_CONNS")
+	}
+
+	DB_MAX_CONN_LIFETIME := time.Hour
+	if value := os.Getenv("DB_MAX_CONN_LIFETIME"); value != "" {
+		DB_MAX_CONN_LIFETIME, err = time.ParseDuration(value)
+		if err != nil || DB_MAX_CONN_LIFETIME <= 0 {
+			return nil, fmt.Errorf("DB_MAX_CONN_LIFETIME is invalid")
+		}
+	}
+
+	DB_MAX_CONN_IDLE_TIME := 5 * time.Minute
+	if value := os.Getenv("DB_MAX_CONN_IDLE_TIME"); value != "" {
+		DB_MAX_CONN_IDLE_TIME, err = time.ParseDuration(value)
+		if err != nil || DB_MAX_CONN_IDLE_TIME <= 0 {
+			return nil, fmt.Errorf("DB_MAX_CONN_IDLE_TIME is invalid")
+		}
+	}
+
+	DB_HEALTH_CHECK_PERIOD := time.Minute
+	if value := os.Getenv("DB_HEALTH_CHECK_PERIOD"); value != "" {
+		DB_HEALTH_CHECK_PERIOD, err = time.ParseDuration(value)
+		if err != nil || DB_HEALTH_CHECK_PERIOD <= 0 {
+			return nil, fmt.Errorf("DB_HEALTH_CHECK_PERIOD is invalid")
+		}
+	}
+
+	DB_STATEMENT_CACHE_CAPACITY := 512
+	if value := os.Getenv("DB_STATEMENT_CACHE_CAPACITY"); value != "" {
+		DB_STATEMENT_CACHE_CAPACITY, err = strconv.Atoi(value)
+		if err != nil || DB_STATEMENT_CACHE_CAPACITY < 0 {
+			return nil, fmt.Errorf("DB_STATEMENT_CACHE_CAPACITY is invalid")
+		}
+	}
+
+	DB_TX_ISOLATION := os.Getenv("DB_TX_ISOLATION")
+	if DB_TX_ISOLATION == "" {
+		DB_TX_ISOLATION = "read_committed"
+	}
+	switch DB_TX_ISOLATION {
+	case "read_committed", "repeatable_read", "serializable":
+	default:
+		return nil, fmt.Errorf("DB_TX_ISOLATION must be read_committed, repeatable_read or serializable")
+	}
+
+	DB_TX_MAX_RETRIES := 3
+	if value := os.Getenv("DB_TX_MAX_RETRIES"); value != "" {
+		DB_TX_MAX_RETRIES, err = strconv.Atoi(value)
+		if err != nil || DB_TX_MAX_RETRIES < 0 {
+			return nil, fmt.Errorf("DB_TX_MAX_RETRIES is invalid")
+		}
+	}
+
 	// Load JWT configuration
 	JWT_SECRET := os.Getenv("JWT_SECRET")
-	if JWT_SECRET == "" {
-		return nil, fmt.Errorf("JWT_SECRET is required")
+	JWT_SIGNING_KEY_FILE := os.Getenv("JWT_SIGNING_KEY_FILE")
+	if JWT_SECRET == "" && JWT_SIGNING_KEY_FILE == "" {
+		return nil, fmt.Errorf("JWT_SECRET or JWT_SIGNING_KEY_FILE is required")
+	}
+
+	var JWT_VERIFICATION_KEY_FILES []string
+	for _, file := range strings.Split(os.Getenv("JWT_VERIFICATION_KEY_FILES"), ",") {
+		if file = strings.TrimSpace(file); file != "" {
+			JWT_VERIFICATION_KEY_FILES = append(JWT_VERIFICATION_KEY_FILES, file)
+		}
+	}
+	if len(JWT_VERIFICATION_KEY_FILES) > 0 && JWT_SIGNING_KEY_FILE == "" {
+		return nil, fmt.Errorf("JWT_VERIFICATION_KEY_FILES requires JWT_SIGNING_KEY_FILE")
 	}
 
 	JWT_DURATION, err := time.ParseDuration(os.Getenv("JWT_DURATION"))
@@ -70,6 +345,196 @@ func Load() (*config, error) {
 		return nil, fmt.Errorf("JWT_DURATION is invalid")
 	}
 
+	JWT_REFRESH_DURATION := 30 * 24 * time.Hour
+	if value := os.Getenv("JWT_REFRESH_DURATION"); value != "" {
+		JWT_REFRESH_DURATION, err = time.ParseDuration(value)
+		if err != nil || JWT_REFRESH_DURATION <= 0 {
+			return nil, fmt.Errorf("JWT_REFRESH_DURATION is invalid")
+		}
+	}
+
+	JWT_ISSUER := os.Getenv("JWT_ISSUER")
+	JWT_AUDIENCE := os.Getenv("JWT_AUDIENCE")
+
+	// Load auth configuration
+	AUTH_MODE := os.Getenv("AUTH_MODE")
+	if AUTH_MODE == "" {
+		AUTH_MODE = "jwt"
+	}
+	if AUTH_MODE != "jwt" && AUTH_MODE != "session" {
+		return nil, fmt.Errorf("AUTH_MODE must be jwt or session")
+	}
+
+	// Load session configuration
+	SESSION_IDLE_TIMEOUT := 30 * time.Minute
+	if value := os.Getenv("SESSION_IDLE_TIMEOUT"); value != "" {
+		SESSION_IDLE_TIMEOUT, err = time.ParseDuration(value)
+		if err != nil || SESSION_IDLE_TIMEOUT <= 0 {
+			return nil, fmt.Errorf("SESSION_IDLE_TIMEOUT is invalid")
+		}
+	}
+
+	SESSION_ABSOLUTE_TIMEOUT := 24 * time.Hour
+	if value := os.Getenv("SESSION_ABSOLUTE_TIMEOUT"); value != "" {
+		SESSION_ABSOLUTE_TIMEOUT, err = time.ParseDuration(value)
+		if err != nil || SESSION_ABSOLUTE_TIMEOUT <= 0 {
+			return nil, fmt.Errorf("SESSION_ABSOLUTE_TIMEOUT is invalid")
+		}
+	}
+	if SESSION_ABSOLUTE_TIMEOUT < SESSION_IDLE_TIMEOUT {
+		return nil, fmt.Errorf("SESSION_ABSOLUTE_TIMEOUT must not be shorter than SESSION_IDLE_TIMEOUT")
+	}
+
+	SESSION_COOKIE_SECURE := true
+	if value := os.Getenv("SESSION_COOKIE_SECURE"); value != "" {
+		SESSION_COOKIE_SECURE, err = strconv.ParseBool(value)
+		if err != nil {
+			return nil, fmt.Errorf("SESSION_COOKIE_SECURE is invalid")
+		}
+	}
+
+	SESSION_COOKIE_SAMESITE := strings.ToLower(os.Getenv("SESSION_COOKIE_SAMESITE"))
+	if SESSION_COOKIE_SAMESITE == "" {
+		SESSION_COOKIE_SAMESITE = "lax"
+	}
+	switch SESSION_COOKIE_SAMESITE {
+	case "lax", "strict":
+	case "none":
+		// browsers reject SameSite=None cookies without Secure
+		if !SESSION_COOKIE_SECURE {
+			return nil, fmt.Errorf("SESSION_COOKIE_SAMESITE none requires SESSION_COOKIE_SECURE")
+		}
+	default:
+		return nil, fmt.Errorf("SESSION_COOKIE_SAMESITE must be lax, strict or none")
+	}
+
+	// Load login throttling configuration
+	LOGIN_MAX_FAILURES := 5
+	if value := os.Getenv("LOGIN_MAX_FAILURES"); value != "" {
+		LOGIN_MAX_FAILURES, err = strconv.Atoi(value)
+		if err != nil || LOGIN_MAX_FAILURES < 1 {
+			return nil, fmt.Errorf("LOGIN_MAX_FAILURES is invalid")
+		}
+	}
+
+	LOGIN_IP_MAX_FAILURES := 20
+	if value := os.Getenv("LOGIN_IP_MAX_FAILURES"); value != "" {
+		LOGIN_IP_MAX_FAILURES, err = strconv.Atoi(value)
+		if err != nil || LOGIN_IP_MAX_FAILURES < 1 {
+			return nil, fmt.Errorf("LOGIN_IP_MAX_FAILURES is invalid")
+		}
+	}
+
+	LOGIN_DELAY := time.Second
+	if value := os.Getenv("LOGIN_DELAY"); value != "" {
+		LOGIN_DELAY, err = time.ParseDuration(value)
+		if err != nil || LOGIN_DELAY < 0 {
+			return nil, fmt.Errorf("LOGIN_DELAY is invalid")
+		}
+	}
+
+	LOGIN_LOCKOUT_DURATION := 15 * time.Minute
+	if value := os.Getenv("LOGIN_LOCKOUT_DURATION"); value != "" {
+		LOGIN_LOCKOUT_DURATION, err = time.ParseDuration(value)
+		if err != nil || LOGIN_LOCKOUT_DURATION <= 0 {
+			return nil, fmt.Errorf("LOGIN_LOCKOUT_DURATION is invalid")
+		}
+	}
+
+	// Load password configuration
+	PASSWORD_HASHER := os.Getenv("PASSWORD_HASHER")
+	if PASSWORD_HASHER == "" {
+		PASSWORD_HASHER = "argon2id"
+	}
+	if PASSWORD_HASHER != "argon2id" && PASSWORD_HASHER != "bcrypt" {
+		return nil, fmt.Errorf("PASSWORD_HASHER must be argon2id or bcrypt")
+	}
+
+	ARGON2_MEMORY := uint64(19456)
+	if value := os.Getenv("ARGON2_MEMORY"); value != "" {
+		ARGON2_MEMORY, err = strconv.ParseUint(value, 10, 32)
+		if err != nil || ARGON2_MEMORY < 8 {
+			return nil, fmt.Errorf("ARGON2_MEMORY is invalid")
+		}
+	}
+
+	ARGON2_ITERATIONS := uint64(2)
+	if value := os.Getenv("ARGON2_ITERATIONS"); value != "" {
+		ARGON2_ITERATIONS, err = strconv.ParseUint(value, 10, 32)
+		if err != nil || ARGON2_ITERATIONS < 1 {
+			return nil, fmt.Errorf("ARGON2_ITERATIONS is invalid")
+		}
+	}
+
+	ARGON2_PARALLELISM := uint64(1)
+	if value := os.Getenv("ARGON2_PARALLELISM"); value != "" {
+		ARGON2_PARALLELISM, err = strconv.ParseUint(value, 10, 8)
+		if err != nil || ARGON2_PARALLELISM < 1 {
+			return nil, fmt.Errorf("ARGON2_PARALLELISM is invalid")
+		}
+	}
+
+	BCRYPT_COST := 10
+	if value := os.Getenv("BCRYPT_COST"); value != "" {
+		BCRYPT_COST, err = strconv.Atoi(value)
+		if err != nil || BCRYPT_COST < 4 || BCRYPT_COST > 31 {
+			return nil, fmt.Errorf("BCRYPT_COST must be between 4 and 31")
+		}
+	}
+
+	PASSWORD_BLOCKLIST_FILE := os.Getenv("PASSWORD_BLOCKLIST_FILE")
+
+	// Load mail configuration
+	APP_URL := os.Getenv("APP_URL")
+	if APP_URL == "" {
+		APP_URL = "http://localhost:8080"
+	}
+
+	MAIL_SENDER := os.Getenv("MAIL_SENDER")
+	if MAIL_SENDER == "" {
+		MAIL_SENDER = "stdout"
+	}
+	if MAIL_SENDER != "stdout" && MAIL_SENDER != "file" && MAIL_SENDER != "smtp" {
+		return nil, fmt.Errorf("MAIL_SENDER must be stdout, file or smtp")
+	}
+
+	MAIL_FROM := os.Getenv("MAIL_FROM")
+	if MAIL_FROM == "" {
+		MAIL_FROM = "no-reply@example.com"
+	}
+
+	MAIL_FILE := os.Getenv("MAIL_FILE")
+	if MAIL_SENDER == "file" && MAIL_FILE == "" {
+		return nil, fmt.Errorf("MAIL_FILE is required for the file sender")
+	}
+
+	SMTP_HOST := os.Getenv("SMTP_HOST")
+	if MAIL_SENDER == "smtp" && SMTP_HOST == "" {
+		return nil, fmt.Errorf("SMTP_HOST is required for the smtp sender")
+	}
+
+	SMTP_PORT := os.Getenv("SMTP_PORT")
+	if SMTP_PORT == "" {
+		SMTP_PORT = "587"
+	}
+
+	SMTP_USERNAME := os.Getenv("SMTP_USERNAME")
+	SMTP_PASSWORD := os.Getenv("SMTP_PASSWORD")
+
+	// Load MFA configuration
+	MFA_ISSUER := os.Getenv("MFA_ISSUER")
+	if MFA_ISSUER == "" {
+		MFA_ISSUER = "API"
+	}
+
+	MFA_REQUIRED_FOR_ADMIN := true
+	if value := os.Getenv("MFA_REQUIRED_FOR_ADMIN"); value != "" {
+		MFA_REQUIRED_FOR_ADMIN, err = strconv.ParseBool(value)
+		if err != nil {
+			return nil, fmt.Errorf("MFA_REQUIRED_FOR_ADMIN is invalid")
+		}
+	}
+
 	// Load server configuration
 	SERVER_HOST := os.Getenv("SERVER_HOST")
 	if SERVER_HOST == "" {
@@ -81,18 +546,326 @@ func Load() (*config, error) {
 		return nil, fmt.Errorf("SERVER_PORT is required")
 	}
 
+	SERVER_ERROR_FORMAT := os.Getenv("SERVER_ERROR_FORMAT")
+	if SERVER_ERROR_FORMAT == "" {
+		SERVER_ERROR_FORMAT = "json"
+	}
+	if SERVER_ERROR_FORMAT != "json" && SERVER_ERROR_FORMAT != "problem" {
+		return nil, fmt.Errorf("SERVER_ERROR_FORMAT must be json or problem")
+	}
+
+	SERVER_ACCESS_LOG_FORMAT := os.Getenv("SERVER_ACCESS_LOG_FORMAT")
+	if SERVER_ACCESS_LOG_FORMAT == "" {
+		SERVER_ACCESS_LOG_FORMAT = "json"
+	}
+	if SERVER_ACCESS_LOG_FORMAT != "json" && SERVER_ACCESS_LOG_FORMAT != "combined" {
+		return nil, fmt.Errorf("SERVER_ACCESS_LOG_FORMAT must be json or combined")
+	}
+
+	SERVER_REQUIRE_IF_MATCH := false
+	if value := os.Getenv("SERVER_REQUIRE_IF_MATCH"); value != "" {
+		SERVER_REQUIRE_IF_MATCH, err = strconv.ParseBool(value)
+		if err != nil {
+			return nil, fmt.Errorf("SERVER_REQUIRE_IF_MATCH is invalid")
+		}
+	}
+
+	var SERVER_TRUSTED_PROXY_HEADERS []string
+	for _, header := range strings.Split(os.Getenv("SERVER_TRUSTED_PROXY_HEADERS"), ",") {
+		if header = strings.TrimSpace(header); header != "" {
+			SERVER_TRUSTED_PROXY_HEADERS = append(SERVER_TRUSTED_PROXY_HEADERS, header)
+		}
+	}
+
+	var SERVER_SHUTDOWN_DELAY time.Duration
+	if value := os.Getenv("SERVER_SHUTDOWN_DELAY"); value != "" {
+		SERVER_SHUTDOWN_DELAY, err = time.ParseDuration(value)
+		if err != nil || SERVER_SHUTDOWN_DELAY < 0 {
+			return nil, fmt.Errorf("SERVER_SHUTDOWN_DELAY is invalid")
+		}
+	}
+
+	SERVER_ADMIN_PORT := os.Getenv("SERVER_ADMIN_PORT")
+	if SERVER_ADMIN_PORT == "" {
+		SERVER_ADMIN_PORT = "9090"
+	}
+	if SERVER_ADMIN_PORT == SERVER_PORT {
+		return nil, fmt.Errorf("SERVER_ADMIN_PORT must differ from SERVER_PORT")
+	}
+
+	// Load OIDC configuration
+	var OIDC_PROVIDERS []oidcProvider
+	for _, name := range strings.Split(os.Getenv("OIDC_PROVIDERS"), ",") {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" {
+			continue
+		}
+		if strings.Trim(name, "abcdefghijklmnopqrstuvwxyz0123456789_") != "" {
+			return nil, fmt.Errorf("OIDC_PROVIDERS must be names of letters, digits and underscores")
+		}
+
+		prefix := "OIDC_" + strings.ToUpper(name) + "_"
+		provider := oidcProvider{
+			Name:         name,
+			Type:         os.Getenv(prefix + "TYPE"),
+			Issuer:       os.Getenv(prefix + "ISSUER"),
+			ClientID:     os.Getenv(prefix + "CLIENT_ID"),
+			ClientSecret: os.Getenv(prefix + "CLIENT_SECRET"),
+		}
+		switch provider.Type {
+		case "", "oidc":
+			provider.Type = "oidc"
+			if provider.Issuer == "" {
+				return nil, fmt.Errorf("%sISSUER is required", prefix)
+			}
+		case "github":
+			// GitHub OAuth apps are confidential clients
+			if provider.ClientSecret == "" {
+				return nil, fmt.Errorf("%sCLIENT_SECRET is required for GitHub", prefix)
+			}
+		default:
+			return nil, fmt.Errorf("%sTYPE must be oidc or github", prefix)
+		}
+		if provider.ClientID == "" {
+			return nil, fmt.Errorf("%sCLIENT_ID is required", prefix)
+		}
+		for _, scope := range strings.Split(os.Getenv(prefix+"SCOPES"), ",") {
+			if scope = strings.TrimSpace(scope); scope != "" {
+				provider.Scopes = append(provider.Scopes, scope)
+			}
+		}
+		OIDC_PROVIDERS = append(OIDC_PROVIDERS, provider)
+	}
+
+	OIDC_REDIRECT_URL := os.Getenv("OIDC_REDIRECT_URL")
+	if OIDC_REDIRECT_URL == "" {
+		OIDC_REDIRECT_URL = strings.TrimSuffix(APP_URL, "/") + "/oidc/callback"
+	}
+
+	OIDC_MOCK := false
+	if value := os.Getenv("OIDC_MOCK"); value != "" {
+		OIDC_MOCK, err = strconv.ParseBool(value)
+		if err != nil {
+			return nil, fmt.Errorf("OIDC_MOCK is invalid")
+		}
+	}
+	if OIDC_MOCK {
+		for _, provider := range OIDC_PROVIDERS {
+			if provider.Name == "mock" {
+				return nil, fmt.Errorf("OIDC_PROVIDERS must not contain mock when OIDC_MOCK is enabled")
+			}
+		}
+	}
+
+	OIDC_MOCK_ISSUER := os.Getenv("OIDC_MOCK_ISSUER")
+	if OIDC_MOCK_ISSUER == "" {
+		OIDC_MOCK_ISSUER = "http://localhost:" + SERVER_PORT + "/oidc/mock"
+	}
+
+	// Load idempotency configuration
+	IDEMPOTENCY_TTL := 24 * time.Hour
+	if value := os.Getenv("IDEMPOTENCY_TTL"); value != "" {
+		IDEMPOTENCY_TTL, err = time.ParseDuration(value)
+		if err != nil || IDEMPOTENCY_TTL <= 0 {
+			return nil, fmt.Errorf("IDEMPOTENCY_TTL is invalid")
+		}
+	}
+
+	// Load rate limit configuration
+	RATE_LIMIT_STORE := os.Getenv("RATE_LIMIT_STORE")
+	if RATE_LIMIT_STORE == "" {
+		RATE_LIMIT_STORE = "memory"
+	}
+	if RATE_LIMIT_STORE != "memory" && RATE_LIMIT_STORE != "postgres" {
+		return nil, fmt.Errorf("RATE_LIMIT_STORE must be memory or postgres")
+	}
+
+	// Load tracing configuration
+	TRACING_EXPORTER := os.Getenv("TRACING_EXPORTER")
+	if TRACING_EXPORTER == "" {
+		TRACING_EXPORTER = "none"
+	}
+	switch TRACING_EXPORTER {
+	case "none", "stdout", "file", "otlp":
+	default:
+		return nil, fmt.Errorf("TRACING_EXPORTER must be none, stdout, file or otlp")
+	}
+
+	TRACING_FILE := os.Getenv("TRACING_FILE")
+	if TRACING_EXPORTER == "file" && TRACING_FILE == "" {
+		return nil, fmt.Errorf("TRACING_FILE is required for the file exporter")
+	}
+
+	TRACING_SERVICE_NAME := os.Getenv("TRACING_SERVICE_NAME")
+	if TRACING_SERVICE_NAME == "" {
+		TRACING_SERVICE_NAME = "api"
+	}
+
+	TRACING_SAMPLE_RATIO := 1.0
+	if value := os.Getenv("TRACING_SAMPLE_RATIO"); value != "" {
+		TRACING_SAMPLE_RATIO, err = strconv.ParseFloat(value, 64)
+		if err != nil || TRACING_SAMPLE_RATIO < 0 || TRACING_SAMPLE_RATIO > 1 {
+			return nil, fmt.Errorf("TRACING_SAMPLE_RATIO is invalid")
+		}
+	}
+
+	// Load log configuration
+	LOG_LEVEL := strings.ToLower(os.Getenv("LOG_LEVEL"))
+	if LOG_LEVEL == "" {
+		LOG_LEVEL = "info"
+	}
+	switch LOG_LEVEL {
+	case "debug", "info", "warn", "error":
+	default:
+		return nil, fmt.Errorf("LOG_LEVEL must be debug, info, warn or error")
+	}
+
+	LOG_FORMAT := strings.ToLower(os.Getenv("LOG_FORMAT"))
+	if LOG_FORMAT == "" {
+		LOG_FORMAT = "json"
+	}
+	if LOG_FORMAT != "json" && LOG_FORMAT != "text" {
+		return nil, fmt.Errorf("LOG_FORMAT must be json or text")
+	}
+
+	LOG_FILE := os.Getenv("LOG_FILE")
+
+	LOG_FILE_MAX_SIZE := 100
+	if value := os.Getenv("LOG_FILE_MAX_SIZE"); value != "" {
+		LOG_FILE_MAX_SIZE, err = strconv.Atoi(value)
+		if err != nil || LOG_FILE_MAX_SIZE < 0 {
+			return nil, fmt.Errorf("LOG_FILE_MAX_SIZE is invalid")
+		}
+	}
+
+	LOG_FILE_MAX_BACKUPS := 5
+	if value := os.Getenv("LOG_FILE_MAX_BACKUPS"); value != "" {
+		LOG_FILE_MAX_BACKUPS, err = strconv.Atoi(value)
+		if err != nil || LOG_FILE_MAX_BACKUPS < 0 {
+			return nil, fmt.Errorf("LOG_FILE_MAX_BACKUPS is invalid")
+		}
+	}
+
+	LOG_SAMPLING_INITIAL := 0
+	if value := os.Getenv("LOG_SAMPLING_INITIAL"); value != "" {
+		LOG_SAMPLING_INITIAL, err = strconv.Atoi(value)
+		if err != nil || LOG_SAMPLING_INITIAL < 0 {
+			return nil, fmt.Errorf("LOG_SAMPLING_INITIAL is invalid")
+		}
+	}
+
+	LOG_SAMPLING_THEREAFTER := 100
+	if value := os.Getenv("LOG_SAMPLING_THEREAFTER"); value != "" {
+		LOG_SAMPLING_THEREAFTER, err = strconv.Atoi(value)
+		if err != nil || LOG_SAMPLING_THEREAFTER < 0 {
+			return nil, fmt.Errorf("LOG_SAMPLING_THEREAFTER is invalid")
+		}
+	}
+
+	LOG_SAMPLING_INTERVAL := time.Second
+	if value := os.Getenv("LOG_SAMPLING_INTERVAL"); value != "" {
+		LOG_SAMPLING_INTERVAL, err = time.ParseDuration(value)
+		if err != nil || LOG_SAMPLING_INTERVAL <= 0 {
+			return nil, fmt.Errorf("LOG_SAMPLING_INTERVAL is invalid")
+		}
+	}
+
 	// Return configuration
 	return &config{
 		DB: db{
-			URL: DB_URL,
+			URL:                    DB_URL,
+			MaxConns:               DB_MAX_CONNS,
+			MinConns:               DB_MIN_CONNS,
+			MaxConnLifetime:        DB_MAX_CONN_LIFETIME,
+			MaxConnIdleTime:        DB_MAX_CONN_IDLE_TIME,
+			HealthCheckPeriod:      DB_HEALTH_CHECK_PERIOD,
+			StatementCacheCapacity: DB_STATEMENT_CACHE_CAPACITY,
+			TxIsolation:            DB_TX_ISOLATION,
+			TxMaxRetries:           DB_TX_MAX_RETRIES,
 		},
 		Server: server{
-			Host: SERVER_HOST,
-			Port: SERVER_PORT,
+			Host:                SERVER_HOST,
+			Port:                SERVER_PORT,
+			ErrorFormat:         SERVER_ERROR_FORMAT,
+			AccessLogFormat:     SERVER_ACCESS_LOG_FORMAT,
+			RequireIfMatch:      SERVER_REQUIRE_IF_MATCH,
+			TrustedProxyHeaders: SERVER_TRUSTED_PROXY_HEADERS,
+			ShutdownDelay:       SERVER_SHUTDOWN_DELAY,
+			AdminPort:           SERVER_ADMIN_PORT,
 		},
 		JWT: jwt{
-			Secret:   JWT_SECRET,
-			Duration: JWT_DURATION,
+			Secret:               JWT_SECRET,
+			SigningKeyFile:       JWT_SIGNING_KEY_FILE,
+			VerificationKeyFiles: JWT_VERIFICATION_KEY_FILES,
+			Duration:             JWT_DURATION,
+			RefreshDuration:      JWT_REFRESH_DURATION,
+			Issuer:               JWT_ISSUER,
+			Audience:             JWT_AUDIENCE,
+		},
+		Auth: auth{
+			Mode: AUTH_MODE,
+		},
+		Session: session{
+			IdleTimeout:     SESSION_IDLE_TIMEOUT,
+			AbsoluteTimeout: SESSION_ABSOLUTE_TIMEOUT,
+			CookieSecure:    SESSION_COOKIE_SECURE,
+			CookieSameSite:  SESSION_COOKIE_SAMESITE,
+		},
+		Login: login{
+			MaxFailures:     LOGIN_MAX_FAILURES,
+			IPMaxFailures:   LOGIN_IP_MAX_FAILURES,
+			Delay:           LOGIN_DELAY,
+			LockoutDuration: LOGIN_LOCKOUT_DURATION,
+		},
+		Password: password{
+			Hasher:            PASSWORD_HASHER,
+			Argon2Memory:      uint32(ARGON2_MEMORY),
+			Argon2Iterations:  uint32(ARGON2_ITERATIONS),
+			Argon2Parallelism: uint8(ARGON2_PARALLELISM),
+			BcryptCost:        BCRYPT_COST,
+			BlocklistFile:     PASSWORD_BLOCKLIST_FILE,
+		},
+		Mail: mail{
+			AppURL:       APP_URL,
+			Sender:       MAIL_SENDER,
+			From:         MAIL_FROM,
+			File:         MAIL_FILE,
+			SMTPHost:     SMTP_HOST,
+			SMTPPort:     SMTP_PORT,
+			SMTPUsername: SMTP_USERNAME,
+			SMTPPassword: SMTP_PASSWORD,
+		},
+		MFA: mfa{
+			Issuer:           MFA_ISSUER,
+			RequiredForAdmin: MFA_REQUIRED_FOR_ADMIN,
+		},
+		OIDC: oidc{
+			Providers:   OIDC_PROVIDERS,
+			RedirectURL: OIDC_REDIRECT_URL,
+			Mock:        OIDC_MOCK,
+			MockIssuer:  OIDC_MOCK_ISSUER,
+		},
+		Idempotency: idempotency{
+			TTL: IDEMPOTENCY_TTL,
+		},
+		RateLimit: rateLimit{
+			Store: RATE_LIMIT_STORE,
+		},
+		Tracing: tracing{
+			Exporter:    TRACING_EXPORTER,
+			File:        TRACING_FILE,
+			ServiceName: TRACING_SERVICE_NAME,
+			SampleRatio: TRACING_SAMPLE_RATIO,
+		},
+		Log: log{
+			Level:          LOG_LEVEL,
+			Format:         LOG_FORMAT,
+			File:           LOG_FILE,
+			FileMaxSize:    int64(LOG_FILE_MAX_SIZE) << 20,
+			FileMaxBackups: LOG_FILE_MAX_BACKUPS,
+			SampleInitial:  LOG_SAMPLING_INITIAL,
+			SampleEvery:    LOG_SAMPLING_THEREAFTER,
+			SampleInterval: LOG_SAMPLING_INTERVAL,
 		},
 	}, nil
 }
@@ -102,6 +875,11 @@ func (s *server) Addr() string {
 	return fmt.Sprintf("%s:%s", s.Host, s.Port)
 }
 
+// AdminAddr returns the admin listener address in the format host:port
+func (s *server) AdminAddr() string {
+	return fmt.Sprintf("%s:%s", s.Host, s.AdminPort)
+}
+
 /*
 LoadDB_URL loads the database URL from environment variables.
 
@@ -0,0 +1,53 @@
+package domain
+
+import (
+	"regexp"
+	"time"
+
+	"example.com/rest/internal/validator"
+)
+
+// APIKey is a long-lived key for machine clients that can't log in with a password.
+// Only the hash of the key is stored, the key itself is shown once on creation.
+// The prefix is the public part of the key, it identifies the key in lists and logs.
+type APIKey struct {
+	ID         int        `json:"id" db:"id"`
+	UserID     int        `json:"-" db:"user_id"`
+	Name       string     `json:"name" db:"name"`
+	Prefix     string     `json:"prefix" db:"prefix"`
+	KeyHash    string     `json:"-" db:"key_hash"`
+	Scopes     []string   `json:"scopes" db:"scopes"` // limits the permissions of the key, empty for all permissions of the user
+	CreatedAt  time.Time  `json:"created_at" db:"created_at"`
+	ExpiresAt  *time.Time `json:"expires_at" db:"expires_at"`     // nil for keys that don't expire
+	LastUsedAt *time.Time `json:"last_used_at" db:"last_used_at"` // updated at most once a minute
+	RevokedAt  *time.Time `json:"revoked_at,omitempty" db:"revoked_at"`
+}
+
+type CreateAPIKeyRequest struct {
+	Name      string     `json:"name"`
+	Scopes    []string   `json:"scopes"`
+	ExpiresAt *time.Time `json:"expires_at"`
+}
+
+// validation
+
+// validScope matches scopes in the format of permissions, e.g. "users:read".
+var validScope = regexp.MustCompile(`^[a-z_]+:[a-z_]+$`)
+
+func (r *CreateAPIKeyRequest) Validate() error {
+	v := validator.New()
+
+	v.NotBlank(r.Name, "name", "name is required")
+	v.MaxRunes(r.Name, 100, "name", "name must not be longer than 100 characters")
+
+	v.CheckField(len(r.Scopes) <= 20, "scopes", "at most 20 scopes are allowed")
+	for _, scope := range r.Scopes {
+		v.CheckField(validScope.MatchString(scope), "scopes", "scopes must have the format resource:action")
+	}
+
+	if r.ExpiresAt != nil {
+		v.CheckField(r.ExpiresAt.After(time.Now()), "expires_at", "expires_at must be in the future")
+	}
+
+	return v.Validate("invalid api key")
+}
@@ -0,0 +1,28 @@
+package domain
+
+import "time"
+
+// AuthEventType is the kind of an audited authentication event.
+type AuthEventType string
+
+const (
+	AuthEventLogin           = AuthEventType("login")
+	AuthEventLoginFailed     = AuthEventType("login_failed")
+	AuthEventLockout         = AuthEventType("lockout")
+	AuthEventPasswordChanged = AuthEventType("password_changed")
+	AuthEventPasswordReset   = AuthEventType("password_reset")
+	AuthEventUserDeleted     = AuthEventType("user_deleted")
+)
+
+// AuthEvent is an entry of the audit trail of authentication events.
+// The user is unknown for failed logins with an unknown email, the email is kept for those.
+type AuthEvent struct {
+	ID        int           `json:"id" db:"id"`
+	Type      AuthEventType `json:"type" db:"type"`
+	UserID    *int          `json:"user_id" db:"user_id"`
+	Email     *string       `json:"email" db:"email"`
+	RequestID string        `json:"request_id" db:"request_id"`
+	IP        string        `json:"ip" db:"ip"`
+	UserAgent string        `json:"user_agent" db:"user_agent"`
+	CreatedAt time.Time     `json:"created_at" db:"created_at"`
+}
@@ -0,0 +1,29 @@
+package domain
+
+import "context"
+
+// Client describes where a request comes from.
+// It is stored in the request context, so services can record it, e.g. in the audit trail.
+type Client struct {
+	RequestID string
+	IP        string
+	UserAgent string
+}
+
+// clientKey is the context key of the client.
+type clientKey struct{}
+
+// ContextWithClient returns a copy of the context that carries the client.
+func ContextWithClient(ctx context.Context, client *Client) context.Context {
+	return context.WithValue(ctx, clientKey{}, client)
+}
+
+// ClientFromContext returns the client carried by the context.
+// It returns an empty client outside of requests, e.g. in background jobs.
+func ClientFromContext(ctx context.Context) *Client {
+	client, ok := ctx.Value(clientKey{}).(*Client)
+	if !ok {
+		return &Client{}
+	}
+	return client
+}
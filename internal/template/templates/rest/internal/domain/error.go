@@ -16,6 +16,8 @@ const (
 	NOTFOUND_ERROR     = ErrorCode("not_found")
 	UNAUTHORIZED_ERROR = ErrorCode("unauthorized")
 	FORBIDDEN_ERROR    = ErrorCode("forbidden")
+	PRECONDITION_ERROR = ErrorCode("precondition_failed")
+	RATE_LIMIT_ERROR   = ErrorCode("rate_limited")
 )
 
 type Error struct {
@@ -43,3 +45,19 @@ func (e *Error) Wrap(err error) error {
 	return errors.Join(e, err)
 }
 
+// Repository errors are returned by the repositories regardless of the storage behind them,
+// services check for them with errors.Is and turn them into errors with a code and a message.
+var (
+	// ErrNotFound is returned when the record doesn't exist.
+	ErrNotFound = errors.New("not found")
+	// ErrConflict is returned when a unique value, e.g. an email, is already taken.
+	ErrConflict = errors.New("conflict")
+	// ErrStaleVersion is returned when the record was changed concurrently, e.g. it has another version by now.
+	ErrStaleVersion = errors.New("stale version")
+	// ErrForeignKeyViolation is returned when a referenced record doesn't exist, e.g. a deleted user.
+	ErrForeignKeyViolation = errors.New("foreign key violation")
+	// ErrCheckViolation is returned when a value isn't allowed by the storage, e.g. an unknown enum value.
+	ErrCheckViolation = errors.New("check violation")
+	// ErrSerializationFailure is returned when a transaction conflicts with a concurrent one, running it again may succeed.
+	ErrSerializationFailure = errors.New("serialization failure")
+)
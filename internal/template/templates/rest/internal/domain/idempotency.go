@@ -0,0 +1,21 @@
+package domain
+
+import "time"
+
+// IdempotencyRecord stores the outcome of a request sent with an Idempotency-Key header.
+// A record with a StatusCode of 0 belongs to a request that is still being processed.
+type IdempotencyRecord struct {
+	Scope       string              // who sent the key (e.g. "user:1:session:2")
+	Key         string              // value of the Idempotency-Key header
+	RequestHash string              // fingerprint of method, path and body
+	StatusCode  int                 // captured response status code
+	Header      map[string][]string // captured response headers
+	Body        []byte              // captured response body
+	CreatedAt   time.Time
+	ExpiresAt   time.Time
+}
+
+// Completed reports whether the response of the request has been captured.
+func (r *IdempotencyRecord) Completed() bool {
+	return r.StatusCode != 0
+}
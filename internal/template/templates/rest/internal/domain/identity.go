@@ -0,0 +1,57 @@
+package domain
+
+import (
+	"time"
+
+	"example.com/rest/internal/validator"
+)
+
+// Identity links a user to their account at an OpenID Connect provider, e.g. Google.
+// The subject is the ID of the account at the provider, it is stable while the email can change.
+type Identity struct {
+	ID          int       `json:"id" db:"id"`
+	UserID      int       `json:"-" db:"user_id"`
+	Provider    string    `json:"provider" db:"provider"`
+	Subject     string    `json:"-" db:"subject"`
+	Email       string    `json:"email" db:"email"` // email at the provider on the last login
+	CreatedAt   time.Time `json:"created_at" db:"created_at"`
+	LastLoginAt time.Time `json:"last_login_at" db:"last_login_at"`
+}
+
+// OIDCState is kept between sending the user to the provider and the callback.
+// Only the hashes of the state and binding are stored, the nonce and code verifier are never sent to the client.
+// The binding is returned only to the client that started the sign in, so a callback URL with
+// the code and state of someone else can't sign the client in to their account.
+type OIDCState struct {
+	ID           int       `db:"id"`
+	StateHash    string    `db:"state_hash"`
+	BindingHash  string    `db:"binding_hash"`
+	Provider     string    `db:"provider"`
+	Nonce        string    `db:"nonce"`
+	CodeVerifier string    `db:"code_verifier"`
+	CreatedAt    time.Time `db:"created_at"`
+	ExpiresAt    time.Time `db:"expires_at"`
+}
+
+// OIDCCallbackRequest carries the parameters the provider redirected the user back with,
+// together with the binding the client got from authorize.
+type OIDCCallbackRequest struct {
+	Code    string `json:"code"`
+	State   string `json:"state"`
+	Binding string `json:"binding"`
+}
+
+// validation
+
+func (r *OIDCCallbackRequest) Validate() error {
+	v := validator.New()
+
+	v.NotBlank(r.Code, "code", "code is required")
+	v.MaxRunes(r.Code, 2048, "code", "code is not valid")
+
+	v.NotBlank(r.State, "state", "state is required")
+
+	v.NotBlank(r.Binding, "binding", "binding is required")
+
+	return v.Validate("invalid input")
+}
@@ -0,0 +1,68 @@
+package domain
+
+import (
+	"time"
+
+	"example.com/rest/internal/validator"
+)
+
+// MFA is the TOTP secret of a user.
+// MFA is enabled once the user confirmed the secret with a code from their authenticator app.
+type MFA struct {
+	UserID       int        `db:"user_id"`
+	Secret       string     `db:"secret"`
+	ConfirmedAt  *time.Time `db:"confirmed_at"`
+	LastUsedStep int64      `db:"last_used_step"` // time step of the last accepted code, older codes are rejected
+	CreatedAt    time.Time  `db:"created_at"`
+}
+
+// MFAChallenge is issued on login when the user has MFA enabled.
+// It proves the password was correct, the client exchanges it together with a code for the real credentials.
+// Only the hash of the token is stored.
+type MFAChallenge struct {
+	ID        int        `db:"id"`
+	UserID    int        `db:"user_id"`
+	TokenHash string     `db:"token_hash"`
+	Attempts  int        `db:"attempts"`
+	CreatedAt time.Time  `db:"created_at"`
+	ExpiresAt time.Time  `db:"expires_at"`
+	UsedAt    *time.Time `db:"used_at"`
+}
+
+// MFAEnrollment is returned when enrolling, the URI is usually shown as a QR code.
+type MFAEnrollment struct {
+	Secret string `json:"secret"`
+	URI    string `json:"uri"`
+}
+
+// MFACodeRequest carries a TOTP code, or a recovery code where they are accepted.
+type MFACodeRequest struct {
+	Code string `json:"code"`
+}
+
+type MFAVerifyRequest struct {
+	MFAToken string `json:"mfa_token"`
+	Code     string `json:"code"`
+}
+
+// validation
+
+func (r *MFACodeRequest) Validate() error {
+	v := validator.New()
+
+	v.NotBlank(r.Code, "code", "code is required")
+	v.MaxRunes(r.Code, 20, "code", "code is not valid")
+
+	return v.Validate("invalid input")
+}
+
+func (r *MFAVerifyRequest) Validate() error {
+	v := validator.New()
+
+	v.NotBlank(r.MFAToken, "mfa_token", "mfa token is required")
+
+	v.NotBlank(r.Code, "code", "code is required")
+	v.MaxRunes(r.Code, 20, "code", "code is not valid")
+
+	return v.Validate("invalid input")
+}
@@ -0,0 +1,54 @@
+package domain
+
+import (
+	"context"
+	"slices"
+	"time"
+)
+
+// Principal is the authenticated caller of a request.
+// It is created from a validated access token, API key or session and stored in the request context.
+type Principal struct {
+	UserID      int
+	Roles       []string  // e.g. "admin"
+	Permissions []string  // granted by the roles, e.g. "users:read"
+	Scopes      []string  // e.g. "users:read", empty for tokens that are not limited to scopes
+	TokenID     string    // jti of the access token
+	APIKeyID    int       // set instead of TokenID if the caller authenticated with an API key
+	SessionID   int       // set instead of TokenID if the caller authenticated with a session cookie
+	ExpiresAt   time.Time // expiry of the access token, API key or session, zero for keys that don't expire
+}
+
+// HasRole reports whether the principal has the role.
+func (p *Principal) HasRole(role string) bool {
+	return slices.Contains(p.Roles, role)
+}
+
+// HasPermission reports whether the roles of the principal grant the permission.
+// Tokens limited to scopes must also have the permission as a scope.
+func (p *Principal) HasPermission(permission string) bool {
+	if len(p.Scopes) > 0 && !p.HasScope(permission) {
+		return false
+	}
+	return slices.Contains(p.Permissions, permission)
+}
+
+// HasScope reports whether the principal has the scope.
+func (p *Principal) HasScope(scope string) bool {
+	return slices.Contains(p.Scopes, scope)
+}
+
+// principalKey is the context key of the principal.
+type principalKey struct{}
+
+// ContextWithPrincipal returns a copy of the context that carries the principal.
+func ContextWithPrincipal(ctx context.Context, principal *Principal) context.Context {
+	return context.WithValue(ctx, principalKey{}, principal)
+}
+
+// PrincipalFromContext returns the principal carried by the context.
+// It returns false for unauthenticated requests.
+func PrincipalFromContext(ctx context.Context) (*Principal, bool) {
+	principal, ok := ctx.Value(principalKey{}).(*Principal)
+	return principal, ok
+}
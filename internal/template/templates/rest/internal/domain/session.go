@@ -0,0 +1,19 @@
+package domain
+
+import "time"
+
+// Session is a server-side session of a browser client, identified by a cookie.
+// Only the hash of the session token is stored, the token itself is only known to the browser.
+// A session ends when it is revoked, when it was idle for too long or when it reaches its absolute expiry.
+type Session struct {
+	ID         int        `json:"id" db:"id"`
+	UserID     int        `json:"-" db:"user_id"`
+	TokenHash  string     `json:"-" db:"token_hash"`
+	UserAgent  string     `json:"user_agent" db:"user_agent"`
+	IP         string     `json:"ip" db:"ip"`
+	CreatedAt  time.Time  `json:"created_at" db:"created_at"`
+	LastSeenAt time.Time  `json:"last_seen_at" db:"last_seen_at"` // updated at most once a minute
+	ExpiresAt  time.Time  `json:"expires_at" db:"expires_at"`     // absolute expiry, independent of activity
+	RevokedAt  *time.Time `json:"-" db:"revoked_at"`
+	Current    bool       `json:"current" db:"-"` // whether the session made the request
+}
@@ -0,0 +1,41 @@
+package domain
+
+import (
+	"time"
+
+	"example.com/rest/internal/validator"
+)
+
+// RefreshToken is a stored refresh token.
+// Only the hash of the token is stored, the token itself is only known to the client.
+// Tokens issued by rotating a refresh token share the family of the first token issued at login.
+type RefreshToken struct {
+	ID        int        `db:"id"`
+	UserID    int        `db:"user_id"`
+	FamilyID  string     `db:"family_id"`
+	TokenHash string     `db:"token_hash"`
+	CreatedAt time.Time  `db:"created_at"`
+	ExpiresAt time.Time  `db:"expires_at"`
+	UsedAt    *time.Time `db:"used_at"`    // set once the token was exchanged for a new one
+	RevokedAt *time.Time `db:"revoked_at"` // set on logout or when reuse of the family was detected
+}
+
+// Tokens is the pair of tokens returned on login and refresh.
+type Tokens struct {
+	AccessToken  string `json:"token"`
+	RefreshToken string `json:"refresh_token"`
+}
+
+type RefreshRequest struct {
+	RefreshToken string `json:"refresh_token"`
+}
+
+// validation
+
+func (r *RefreshRequest) Validate() error {
+	v := validator.New()
+
+	v.NotBlank(r.RefreshToken, "refresh_token", "refresh token is required")
+
+	return v.Validate("invalid refresh token")
+}
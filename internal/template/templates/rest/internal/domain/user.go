@@ -7,12 +7,13 @@ import (
 )
 
 type User struct {
-	ID           int       `json:"id" db:"id"`
-	Email        string    `json:"email" db:"email"`
-	PasswordHash string    `json:"-" db:"password_hash"`
-	CreatedAt    time.Time `json:"created_at" db:"created_at"`
-	UpdatedAt    time.Time `json:"updated_at" db:"updated_at"`
-	Version      int       `json:"-" db:"version"`
+	ID              int        `json:"id" db:"id"`
+	Email           string     `json:"email" db:"email"`
+	EmailVerifiedAt *time.Time `json:"email_verified_at" db:"email_verified_at"` // nil until the email is verified
+	PasswordHash    string     `json:"-" db:"password_hash"`
+	CreatedAt       time.Time  `json:"created_at" db:"created_at"`
+	UpdatedAt       time.Time  `json:"updated_at" db:"updated_at"`
+	Version         int        `json:"-" db:"version"`
 }
 
 type UserCredentials struct {
@@ -35,7 +36,7 @@ func (u *UserCredentials) Validate() error {
 	v.Email(u.Email, "email", "email is not valid")
 
 	v.NotBlank(u.Password, "password", "password is required")
-	v.BetweenRunes(u.Password, 8, 50, "password", "password must be between 8 and 50 characters long")
+	v.BetweenRunes(u.Password, 8, 128, "password", "password must be between 8 and 128 characters long")
 
 	return v.Validate("invalid credentials")
 }
@@ -54,11 +55,11 @@ func (u *UserPatch) Validate() error {
 
 	if u.NewPassword != nil {
 		v.NotBlank(*u.NewPassword, "new_password", "new password is required")
-		v.BetweenRunes(*u.NewPassword, 8, 50, "new_password", "new password must be between 8 and 50 characters long")
+		v.BetweenRunes(*u.NewPassword, 8, 128, "new_password", "new password must be between 8 and 128 characters long")
 	}
 
 	v.NotBlank(u.Password, "password", "password is required")
-	v.BetweenRunes(u.Password, 8, 50, "password", "password must be between 8 and 50 characters long")
+	v.BetweenRunes(u.Password, 8, 128, "password", "password must be between 8 and 128 characters long")
 
 	return v.Validate("invalid input")
 }
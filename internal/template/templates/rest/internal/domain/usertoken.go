@@ -0,0 +1,72 @@
+package domain
+
+import (
+	"time"
+
+	"example.com/rest/internal/validator"
+)
+
+// TokenPurpose is what a user token can be used for.
+type TokenPurpose string
+
+const (
+	PurposeVerifyEmail   = TokenPurpose("verify_email")
+	PurposeResetPassword = TokenPurpose("reset_password")
+)
+
+// UserToken is a single-use token sent to the user by email, e.g. to verify the email address.
+// Only the hash of the token is stored, the token itself is only in the email.
+// The email the token was sent to is stored, so a token can't verify an address the user changed to later.
+type UserToken struct {
+	ID        int          `db:"id"`
+	UserID    int          `db:"user_id"`
+	Purpose   TokenPurpose `db:"purpose"`
+	TokenHash string       `db:"token_hash"`
+	Email     string       `db:"email"`
+	CreatedAt time.Time    `db:"created_at"`
+	ExpiresAt time.Time    `db:"expires_at"`
+	UsedAt    *time.Time   `db:"used_at"`
+}
+
+type VerifyEmailRequest struct {
+	Token string `json:"token"`
+}
+
+type ForgotPasswordRequest struct {
+	Email string `json:"email"`
+}
+
+type ResetPasswordRequest struct {
+	Token       string `json:"token"`
+	NewPassword string `json:"new_password"`
+}
+
+// validation
+
+func (r *VerifyEmailRequest) Validate() error {
+	v := validator.New()
+
+	v.NotBlank(r.Token, "token", "token is required")
+
+	return v.Validate("invalid input")
+}
+
+func (r *ForgotPasswordRequest) Validate() error {
+	v := validator.New()
+
+	v.NotBlank(r.Email, "email", "email is required")
+	v.Email(r.Email, "email", "email is not valid")
+
+	return v.Validate("invalid input")
+}
+
+func (r *ResetPasswordRequest) Validate() error {
+	v := validator.New()
+
+	v.NotBlank(r.Token, "token", "token is required")
+
+	v.NotBlank(r.NewPassword, "new_password", "new password is required")
+	v.BetweenRunes(r.NewPassword, 8, 128, "new_password", "new password must be between 8 and 128 characters long")
+
+	return v.Validate("invalid input")
+}
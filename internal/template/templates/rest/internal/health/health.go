@@ -0,0 +1,78 @@
+package health
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+)
+
+// Check reports whether a dependency is healthy by returning nil.
+// It should respect the context deadline.
+type Check func(ctx context.Context) error
+
+// Registry holds the readiness checks of the application.
+// Components register their own checks (e.g. the database pool registers a ping).
+type Registry struct {
+	mu           sync.RWMutex
+	checks       map[string]Check
+	shuttingDown atomic.Bool
+}
+
+// NewRegistry creates an empty registry.
+func NewRegistry() *Registry {
+	return &Registry{
+		checks: make(map[string]Check),
+	}
+}
+
+// Register adds a readiness check. A check with the same name is replaced.
+func (r *Registry) Register(name string, check Check) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.checks[name] = check
+}
+
+// Shutdown marks the application as shutting down, after this it is never ready again.
+// This lets load balancers stop sending traffic before connections are closed.
+func (r *Registry) Shutdown() {
+	r.shuttingDown.Store(true)
+}
+
+// Ready runs all checks concurrently and returns the result of each check, nil means healthy.
+// It reports false if any check failed or the application is shutting down.
+func (r *Registry) Ready(ctx context.Context) (map[string]error, bool) {
+	r.mu.RLock()
+	checks := make(map[string]Check, len(r.checks))
+	for name, check := range r.checks {
+		checks[name] = check
+	}
+	r.mu.RUnlock()
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	results := make(map[string]error, len(checks))
+	ready := !r.shuttingDown.Load()
+
+	for name, check := range checks {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			err := check(ctx)
+
+			mu.Lock()
+			defer mu.Unlock()
+			results[name] = err
+			if err != nil {
+				ready = false
+			}
+		}()
+	}
+	wg.Wait()
+
+	return results, ready
+}
+
+// ShuttingDown reports whether Shutdown has been called.
+func (r *Registry) ShuttingDown() bool {
+	return r.shuttingDown.Load()
+}
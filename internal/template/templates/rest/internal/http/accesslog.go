@@ -0,0 +1,158 @@
+package http
+
+import (
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"example.com/rest/internal/logging"
+	"github.com/go-chi/chi/v5"
+)
+
+// AccessLogFormat is the format used for access log records.
+type AccessLogFormat string
+
+const (
+	AccessLogJSON     = AccessLogFormat("json")     // a structured record on the request logger
+	AccessLogCombined = AccessLogFormat("combined") // Apache/NGINX combined log format with extra fields
+)
+
+// accessLogTimeFormat is the time format of the combined log format.
+const accessLogTimeFormat = "02/Jan/2006:15:04:05 -0700"
+
+// countingReader is a wrapper around the request body that counts the bytes read.
+type countingReader struct {
+	io.ReadCloser
+	bytes int64
+}
+
+// Read overrides the Read method to count the bytes read.
+func (cr *countingReader) Read(p []byte) (int, error) {
+	n, err := cr.ReadCloser.Read(p)
+	cr.bytes += int64(n)
+	return n, err
+}
+
+// accessLogEntry holds what is recorded about a served request.
+type accessLogEntry struct {
+	start      time.Time
+	duration   time.Duration
+	remoteAddr string
+	route      string
+	status     int
+	bytesIn    int64
+	bytesOut   int64
+}
+
+// AccessLog writes one access log record per request once it is served.
+// It records the status, the bytes read from the request body and written to the response,
+// the client address (using the trusted proxy headers), the route pattern and the latency.
+// In the JSON format the record is written to the request logger, so it carries the request and trace IDs.
+// In the combined format a line is written to the access log output.
+func (m *Middlewares) AccessLog(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+
+		wrapped, ww := wrapResponseWriter(w)
+
+		body := &countingReader{ReadCloser: r.Body}
+		if r.Body != nil && r.Body != http.NoBody {
+			r.Body = body
+		}
+
+		// log in a deferred function, so requests that panic are logged too
+		completed := false
+		defer func() {
+			m.writeAccessLog(r, accessLogEntry{
+				start:      start,
+				duration:   time.Since(start),
+				remoteAddr: clientIP(r, m.trustedProxyHeaders),
+				route:      chi.RouteContext(r.Context()).RoutePattern(),
+				status:     wrapped.statusOrPanic(completed),
+				bytesIn:    body.bytes,
+				bytesOut:   wrapped.bytes,
+			})
+		}()
+
+		next.ServeHTTP(ww, r)
+		completed = true
+	})
+}
+
+// writeAccessLog writes the entry in the configured format.
+func (m *Middlewares) writeAccessLog(r *http.Request, entry accessLogEntry) {
+	if m.accessLogFormat == AccessLogCombined {
+		m.writeCombined(r, entry)
+		return
+	}
+
+	logging.FromContext(r.Context()).Info("HTTP Request Completed",
+		"method", r.Method,
+		"path", r.URL.Path,
+		"query", r.URL.RawQuery,
+		"proto", r.Proto,
+		"status", entry.status,
+		"bytes_in", entry.bytesIn,
+		"bytes_out", entry.bytesOut,
+		"remote_addr", entry.remoteAddr,
+		"user_agent", r.UserAgent(),
+		"referer", r.Referer(),
+		"duration", entry.duration.String(),
+	)
+}
+
+// writeCombined writes the entry in the combined log format, followed by the route pattern,
+// the request bytes, the latency in microseconds and the request ID:
+//
+//	127.0.0.1 - - [02/Jan/2006:15:04:05 +0000] "GET /api/v1/user HTTP/1.1" 200 64 "-" "curl/8.5.0" "/api/v1/user" 0 412 0b6e...
+func (m *Middlewares) writeCombined(r *http.Request, entry accessLogEntry) {
+	var b strings.Builder
+	b.WriteString(entry.remoteAddr)
+	b.WriteString(" - - [")
+	b.WriteString(entry.start.Format(accessLogTimeFormat))
+	b.WriteString("] ")
+	b.WriteString(quote(r.Method + " " + r.URL.RequestURI() + " " + r.Proto))
+	b.WriteString(" ")
+	b.WriteString(strconv.Itoa(entry.status))
+	b.WriteString(" ")
+	b.WriteString(dashIfZero(entry.bytesOut))
+	b.WriteString(" ")
+	b.WriteString(quote(r.Referer()))
+	b.WriteString(" ")
+	b.WriteString(quote(r.UserAgent()))
+	b.WriteString(" ")
+	b.WriteString(quote(entry.route))
+	b.WriteString(" ")
+	b.WriteString(strconv.FormatInt(entry.bytesIn, 10))
+	b.WriteString(" ")
+	b.WriteString(strconv.FormatInt(entry.duration.Microseconds(), 10))
+	b.WriteString(" ")
+	b.WriteString(requestID(r))
+	b.WriteString("\n")
+
+	// lines of concurrent requests must not interleave
+	m.accessLogMu.Lock()
+	defer m.accessLogMu.Unlock()
+	if _, err := io.WriteString(m.accessLogOutput, b.String()); err != nil {
+		m.logger.Error("failed to write access log", "error", err)
+	}
+}
+
+// quote quotes a field of the combined log format, empty fields are written as "-".
+// Quotes and control characters are escaped, so clients can't forge log lines.
+func quote(s string) string {
+	if s == "" {
+		return `"-"`
+	}
+	return strconv.Quote(s)
+}
+
+// dashIfZero formats a byte count of the combined log format, where 0 is written as "-".
+func dashIfZero(n int64) string {
+	if n == 0 {
+		return "-"
+	}
+	return strconv.FormatInt(n, 10)
+}
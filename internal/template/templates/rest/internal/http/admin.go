@@ -0,0 +1,186 @@
+package http
+
+import (
+	"net/http"
+	"strconv"
+
+	"example.com/rest/internal/domain"
+	"example.com/rest/internal/services"
+	"github.com/go-chi/chi/v5"
+)
+
+// Page sizes of the user list.
+const (
+	defaultPageSize = 20
+	maxPageSize     = 100
+)
+
+// AdminHandler serves the routes for managing other users.
+// The routes require the admin role, the services additionally check the permissions of every operation.
+type AdminHandler struct {
+	*baseHandler
+	userService  *services.UserService
+	roleService  *services.RoleService
+	auditService *services.AuditService
+}
+
+func NewAdminHandler(baseHandler *baseHandler, userService *services.UserService, roleService *services.RoleService, auditService *services.AuditService) *AdminHandler {
+	return &AdminHandler{
+		baseHandler:  baseHandler,
+		userService:  userService,
+		roleService:  roleService,
+		auditService: auditService,
+	}
+}
+
+func (h *AdminHandler) listUsers(w http.ResponseWriter, r *http.Request) {
+	limit, err := queryInt(r, "limit", defaultPageSize)
+	if err != nil {
+		h.json.WriteError(w, r, err)
+		return
+	}
+	offset, err := queryInt(r, "offset", 0)
+	if err != nil {
+		h.json.WriteError(w, r, err)
+		return
+	}
+	if limit < 1 || limit > maxPageSize || offset < 0 {
+		h.json.WriteError(w, r, domain.Errorf(domain.INVALID_ERROR, "limit must be between 1 and %d and offset must not be negative", maxPageSize))
+		return
+	}
+
+	users, err := h.userService.List(r.Context(), limit, offset)
+	if err != nil {
+		h.json.WriteError(w, r, err)
+		return
+	}
+
+	h.json.Write(w, http.StatusOK, map[string]any{"users": users, "limit": limit, "offset": offset})
+}
+
+// listAuthEvents returns the audit trail of the user, newest first.
+func (h *AdminHandler) listAuthEvents(w http.ResponseWriter, r *http.Request) {
+	userID, err := pathUserID(r)
+	if err != nil {
+		h.json.WriteError(w, r, err)
+		return
+	}
+	limit, err := queryInt(r, "limit", defaultPageSize)
+	if err != nil {
+		h.json.WriteError(w, r, err)
+		return
+	}
+	offset, err := queryInt(r, "offset", 0)
+	if err != nil {
+		h.json.WriteError(w, r, err)
+		return
+	}
+	if limit < 1 || limit > maxPageSize || offset < 0 {
+		h.json.WriteError(w, r, domain.Errorf(domain.INVALID_ERROR, "limit must be between 1 and %d and offset must not be negative", maxPageSize))
+		return
+	}
+
+	events, err := h.auditService.ListByUser(r.Context(), userID, limit, offset)
+	if err != nil {
+		h.json.WriteError(w, r, err)
+		return
+	}
+
+	h.json.Write(w, http.StatusOK, map[string]any{"events": events, "limit": limit, "offset": offset})
+}
+
+func (h *AdminHandler) getUser(w http.ResponseWriter, r *http.Request) {
+	userID, err := pathUserID(r)
+	if err != nil {
+		h.json.WriteError(w, r, err)
+		return
+	}
+
+	user, err := h.userService.GetByID(r.Context(), userID)
+	if err != nil {
+		h.json.WriteError(w, r, err)
+		return
+	}
+
+	roles, err := h.roleService.UserRoles(r.Context(), userID)
+	if err != nil {
+		h.json.WriteError(w, r, err)
+		return
+	}
+
+	writeETag(w, user.Version)
+	h.json.Write(w, http.StatusOK, map[string]any{"user": user, "roles": roles})
+}
+
+func (h *AdminHandler) deleteUser(w http.ResponseWriter, r *http.Request) {
+	userID, err := pathUserID(r)
+	if err != nil {
+		h.json.WriteError(w, r, err)
+		return
+	}
+
+	versions, err := h.ifMatchVersions(r)
+	if err != nil {
+		h.json.WriteError(w, r, err)
+		return
+	}
+
+	if err := h.userService.Delete(r.Context(), userID, versions); err != nil {
+		h.json.WriteError(w, r, err)
+		return
+	}
+
+	h.json.Write(w, http.StatusNoContent, nil)
+}
+
+func (h *AdminHandler) assignRole(w http.ResponseWriter, r *http.Request) {
+	userID, err := pathUserID(r)
+	if err != nil {
+		h.json.WriteError(w, r, err)
+		return
+	}
+
+	if err := h.roleService.AssignRole(r.Context(), userID, chi.URLParam(r, "role")); err != nil {
+		h.json.WriteError(w, r, err)
+		return
+	}
+
+	h.json.Write(w, http.StatusNoContent, nil)
+}
+
+func (h *AdminHandler) removeRole(w http.ResponseWriter, r *http.Request) {
+	userID, err := pathUserID(r)
+	if err != nil {
+		h.json.WriteError(w, r, err)
+		return
+	}
+
+	if err := h.roleService.RemoveRole(r.Context(), userID, chi.URLParam(r, "role")); err != nil {
+		h.json.WriteError(w, r, err)
+		return
+	}
+
+	h.json.Write(w, http.StatusNoContent, nil)
+}
+
+// pathUserID returns the user ID of the {id} path parameter.
+func pathUserID(r *http.Request) (int, error) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil || id < 1 {
+		return 0, domain.Errorf(domain.INVALID_ERROR, "invalid user id")
+	}
+	return id, nil
+}
+
+// queryInt returns the integer query parameter or the fallback if it is not set.
+func queryInt(r *http.Request, name string, fallback int) (int, error) {
+	value := r.URL.Query().Get(name)
+	if value == "" {
+		return fallback, nil
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, domain.Errorf(domain.INVALID_ERROR, "%s must be an integer", name)
+	}
+	return n, nil
+}
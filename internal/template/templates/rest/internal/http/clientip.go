@@ -0,0 +1,32 @@
+package http
+
+import (
+	"net"
+	"net/http"
+	"strings"
+)
+
+// clientIP returns the IP address of the client.
+// Headers in trustedHeaders (e.g. X-Forwarded-For or X-Real-IP) are checked in order and the
+// right-most address of the first present header is used, as that is the one added by our own proxy.
+// Only trust headers that your proxy sets, otherwise clients can spoof their address.
+// It falls back to the remote address of the connection.
+func clientIP(r *http.Request, trustedHeaders []string) string {
+	for _, header := range trustedHeaders {
+		value := r.Header.Get(header)
+		if value == "" {
+			continue
+		}
+		addresses := strings.Split(value, ",")
+		ip := strings.TrimSpace(addresses[len(addresses)-1])
+		if net.ParseIP(ip) != nil {
+			return ip
+		}
+	}
+
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
@@ -1,9 +1,20 @@
 package http
 
+import "net/http"
+
 // Custom type for context keys
 type contextKey string
 
 const (
-	userIDKey    contextKey = "user_id"
 	requestIDKey contextKey = "request_id"
 )
+
+// requestID safely retrieves the request ID from the request context.
+// It returns "unknown" if the RequestID middleware did not run.
+func requestID(r *http.Request) string {
+	reqID, ok := r.Context().Value(requestIDKey).(string)
+	if !ok {
+		return "unknown"
+	}
+	return reqID
+}
@@ -1,6 +1,7 @@
 package http
 
 import (
+	"errors"
 	"net/http"
 
 	"example.com/rest/internal/domain"
@@ -13,5 +14,11 @@ var domainToHTTPErrors = map[domain.ErrorCode]int{
 	domain.FORBIDDEN_ERROR:    http.StatusForbidden,           // 403
 	domain.NOTFOUND_ERROR:     http.StatusNotFound,            // 404
 	domain.CONFLICT_ERROR:     http.StatusConflict,            // 409
+	domain.PRECONDITION_ERROR: http.StatusPreconditionFailed,  // 412
+	domain.RATE_LIMIT_ERROR:   http.StatusTooManyRequests,     // 429
 	domain.INTERNAL_ERROR:     http.StatusInternalServerError, // 500
 }
+
+// errPreconditionRequired is returned when a conditional request is required but the client sent none.
+// It is converted to a 428 Precondition Required response.
+var errPreconditionRequired = errors.New("precondition required")
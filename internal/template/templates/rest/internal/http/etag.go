@@ -0,0 +1,95 @@
+package http
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"example.com/rest/internal/domain"
+)
+
+// etag returns the strong entity tag for a resource version.
+func etag(version int) string {
+	return strconv.Quote(strconv.Itoa(version))
+}
+
+// parseETag parses an entity tag created by etag and returns the version.
+// It returns false for weak tags and tags that were not created by this API.
+func parseETag(tag string) (int, bool) {
+	unquoted, err := strconv.Unquote(strings.TrimSpace(tag))
+	if err != nil {
+		return 0, false
+	}
+	version, err := strconv.Atoi(unquoted)
+	if err != nil || version < 1 {
+		return 0, false
+	}
+	return version, true
+}
+
+// splitETags splits a list of entity tags, e.g. of If-Match, at the commas outside of the quotes.
+func splitETags(header string) []string {
+	var tags []string
+	start, quoted := 0, false
+	for i, c := range header {
+		switch {
+		case c == '"':
+			quoted = !quoted
+		case c == ',' && !quoted:
+			tags = append(tags, strings.TrimSpace(header[start:i]))
+			start = i + 1
+		}
+	}
+	return append(tags, strings.TrimSpace(header[start:]))
+}
+
+// ifMatchVersions returns the resource versions the client expects based on the If-Match header,
+// the request succeeds if the current version is any of them (RFC 9110, section 13.1.1).
+// It returns nil if the request is unconditional (no header or "*").
+// Tags that can never match with the strong comparison (weak or foreign) are skipped,
+// a list of only such tags results in a precondition error.
+// If If-Match is required, a missing header results in errPreconditionRequired (428).
+func (b *baseHandler) ifMatchVersions(r *http.Request) ([]int, error) {
+	header := strings.TrimSpace(r.Header.Get("If-Match"))
+	if header == "" {
+		if b.requireIfMatch {
+			return nil, errPreconditionRequired
+		}
+		return nil, nil
+	}
+	if header == "*" {
+		return nil, nil
+	}
+
+	var versions []int
+	for _, tag := range splitETags(header) {
+		if version, ok := parseETag(tag); ok {
+			versions = append(versions, version)
+		}
+	}
+	if len(versions) == 0 {
+		return nil, domain.Errorf(domain.PRECONDITION_ERROR, "If-Match does not match the current version")
+	}
+	return versions, nil
+}
+
+// notModified reports whether the If-None-Match header matches the current entity tag.
+// It uses weak comparison as required for GET requests.
+func notModified(r *http.Request, current string) bool {
+	header := r.Header.Get("If-None-Match")
+	if header == "" {
+		return false
+	}
+	for _, tag := range splitETags(header) {
+		tag = strings.TrimPrefix(tag, "W/")
+		if tag == "*" || tag == current {
+			return true
+		}
+	}
+	return false
+}
+
+// writeETag sets the ETag header of the response.
+func writeETag(w http.ResponseWriter, version int) {
+	w.Header().Set("ETag", etag(version))
+}
@@ -5,25 +5,44 @@ import (
 	"net/http"
 
 	"example.com/rest/internal/domain"
+	"example.com/rest/internal/logging"
 )
 
 // baseHandler contains common dependencies for all handlers.
 type baseHandler struct {
-	json *jsonHelper
+	json           *jsonHelper
+	requireIfMatch bool
 }
 
 // NewBaseHandler creates a new base handler which contains common dependencies for all handlers.
-func NewBaseHandler(logger *slog.Logger) *baseHandler {
+// The error format is used for error responses unless the client negotiates another one with the Accept header.
+// If requireIfMatch is true, updates and deletes without an If-Match header are rejected with 428.
+func NewBaseHandler(logger *slog.Logger, errorFormat ErrorFormat, requireIfMatch bool) *baseHandler {
 	return &baseHandler{
-		json: &jsonHelper{logger: logger},
+		json:           &jsonHelper{logger: logger, errorFormat: errorFormat},
+		requireIfMatch: requireIfMatch,
 	}
 }
 
+// getPrincipal safely retrieves the authenticated principal from the context
+func (b *baseHandler) getPrincipal(r *http.Request) (*domain.Principal, error) {
+	principal, ok := domain.PrincipalFromContext(r.Context())
+	if !ok {
+		return nil, domain.Errorf(domain.UNAUTHORIZED_ERROR, "user not authenticated")
+	}
+	return principal, nil
+}
+
 // getUserID safely retrieves user ID from the context
 func (b *baseHandler) getUserID(r *http.Request) (int, error) {
-	userID, ok := r.Context().Value(userIDKey).(int)
-	if !ok {
-		return 0, domain.Errorf(domain.UNAUTHORIZED_ERROR, "user not authenticated")
+	principal, err := b.getPrincipal(r)
+	if err != nil {
+		return 0, err
 	}
-	return userID, nil
+	return principal.UserID, nil
+}
+
+// requestLogger returns the logger of the request, enriched with the request ID, route, trace ID and user ID.
+func (b *baseHandler) requestLogger(r *http.Request) *slog.Logger {
+	return logging.FromContext(r.Context())
 }
@@ -0,0 +1,62 @@
+package http
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"example.com/rest/internal/health"
+)
+
+// readinessTimeout is how long the readiness checks may take in total.
+const readinessTimeout = 2 * time.Second
+
+type HealthHandler struct {
+	*baseHandler
+	health *health.Registry
+}
+
+func NewHealthHandler(baseHandler *baseHandler, health *health.Registry) *HealthHandler {
+	return &HealthHandler{
+		baseHandler: baseHandler,
+		health:      health,
+	}
+}
+
+// livez reports that the process is running and able to serve requests.
+// It deliberately doesn't check dependencies, a failing database should not get the process restarted.
+func (h *HealthHandler) livez(w http.ResponseWriter, r *http.Request) {
+	h.json.Write(w, http.StatusOK, map[string]any{"status": "ok"})
+}
+
+// readyz reports whether the process should receive traffic.
+// It fails if any registered check fails or the server is shutting down.
+func (h *HealthHandler) readyz(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), readinessTimeout)
+	defer cancel()
+
+	results, ready := h.health.Ready(ctx)
+
+	// only report the status, check errors may contain internal details
+	checks := make(map[string]string, len(results))
+	for name, err := range results {
+		checks[name] = "ok"
+		if err != nil {
+			checks[name] = "failed"
+			h.requestLogger(r).Warn("readiness check failed", "check", name, "error", err)
+		}
+	}
+	if h.health.ShuttingDown() {
+		checks["shutdown"] = "in progress"
+	}
+
+	if !ready {
+		h.json.WriteResponse(w, http.StatusServiceUnavailable, response{
+			Status:  "error",
+			Message: "not ready",
+			Data:    map[string]any{"checks": checks},
+		})
+		return
+	}
+	h.json.Write(w, http.StatusOK, map[string]any{"status": "ok", "checks": checks})
+}
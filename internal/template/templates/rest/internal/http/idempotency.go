@@ -0,0 +1,150 @@
+package http
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"example.com/rest/internal/domain"
+	"example.com/rest/internal/logging"
+)
+
+// maxIdempotentBodySize is the largest request body accepted with an Idempotency-Key header.
+const maxIdempotentBodySize = 1 << 20 // 1 MB
+
+// idempotentMethods are the unsafe methods that honor the Idempotency-Key header.
+var idempotentMethods = map[string]bool{
+	http.MethodPost:   true,
+	http.MethodPatch:  true,
+	http.MethodDelete: true,
+}
+
+// Idempotency honors the Idempotency-Key header on POST, PATCH and DELETE requests.
+// The first request with a key is processed and its response is stored.
+// Duplicate requests with the same key and body get the stored response replayed,
+// while reusing a key for a different request is rejected.
+// Keys are scoped to the authenticated user and their session or API key, so clients can't replay each other's responses.
+// It must run after the Auth middleware, anonymous requests are scoped to the request itself,
+// so a response is only replayed for exactly the same request.
+// Responses with a 5xx status are not stored, so the request can be retried.
+// Responses marked Cache-Control: no-store, such as issued tokens, API keys and session cookies,
+// are not stored either, so no credentials are kept in the database.
+func (m *Middlewares) Idempotency(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key := r.Header.Get("Idempotency-Key")
+		if key == "" || !idempotentMethods[r.Method] {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		// read the body to fingerprint the request, then restore it for the handler
+		body, err := io.ReadAll(io.LimitReader(r.Body, maxIdempotentBodySize+1))
+		if err != nil {
+			m.json.WriteError(w, r, domain.Errorf(domain.INVALID_ERROR, "invalid request body"))
+			return
+		}
+		if len(body) > maxIdempotentBodySize {
+			m.json.WriteError(w, r, domain.Errorf(domain.INVALID_ERROR, "request body too large"))
+			return
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+
+		requestHash := fingerprint([]byte(r.Method), []byte(r.URL.RequestURI()), body)
+		scope := idempotencyScope(r, requestHash)
+
+		record, err := m.idempotencyService.Begin(r.Context(), scope, key, requestHash)
+		if err != nil {
+			m.json.WriteError(w, r, err)
+			return
+		}
+
+		// replay the stored response
+		if record != nil {
+			for name, values := range record.Header {
+				w.Header()[name] = values
+			}
+			w.Header().Set("Idempotent-Replayed", "true")
+			w.WriteHeader(record.StatusCode)
+			w.Write(record.Body)
+			return
+		}
+
+		rec, ww := wrapResponseWriter(w)
+		rec.captureBody()
+		completed := false
+		defer func() {
+			// release the key if the response wasn't stored (server error, no-store response, panic or failed store)
+			if completed {
+				return
+			}
+			if err := m.idempotencyService.Release(context.WithoutCancel(r.Context()), scope, key); err != nil {
+				logging.FromContext(r.Context()).Error("failed to release idempotency key", "error", err)
+			}
+		}()
+
+		next.ServeHTTP(ww, r)
+
+		if rec.status >= http.StatusInternalServerError || isNoStore(rec.Header()) {
+			return
+		}
+
+		header := rec.Header().Clone()
+		header.Del("X-Request-ID") // every request gets its own ID
+		err = m.idempotencyService.Complete(context.WithoutCancel(r.Context()), &domain.IdempotencyRecord{
+			Scope:      scope,
+			Key:        key,
+			StatusCode: rec.status,
+			Header:     header,
+			Body:       rec.body.Bytes(),
+		})
+		if err != nil {
+			logging.FromContext(r.Context()).Error("failed to store idempotent response", "error", err)
+			return
+		}
+		completed = true
+	})
+}
+
+// idempotencyScope returns the scope of the keys of the request.
+// Access tokens are scoped to the user, so a retry with a refreshed token still matches,
+// sessions and API keys are scoped to themselves.
+func idempotencyScope(r *http.Request, requestHash string) string {
+	principal, ok := domain.PrincipalFromContext(r.Context())
+	if !ok {
+		return "anonymous:" + requestHash
+	}
+
+	scope := "user:" + strconv.Itoa(principal.UserID)
+	switch {
+	case principal.APIKeyID != 0:
+		scope += ":api_key:" + strconv.Itoa(principal.APIKeyID)
+	case principal.SessionID != 0:
+		scope += ":session:" + strconv.Itoa(principal.SessionID)
+	}
+	return scope
+}
+
+// fingerprint returns the hex encoded SHA-256 hash of the parts.
+func fingerprint(parts ...[]byte) string {
+	h := sha256.New()
+	for _, part := range parts {
+		h.Write(part)
+		h.Write([]byte{0}) // separator, so ("ab", "c") and ("a", "bc") differ
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// isNoStore reports whether the response must not be stored, it is set on responses with credentials.
+func isNoStore(header http.Header) bool {
+	for _, directive := range strings.Split(header.Get("Cache-Control"), ",") {
+		if strings.EqualFold(strings.TrimSpace(directive), "no-store") {
+			return true
+		}
+	}
+	return false
+}
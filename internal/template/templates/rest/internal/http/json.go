@@ -4,15 +4,29 @@ import (
 	"encoding/json"
 	"errors"
 	"log/slog"
+	"mime"
 	"net/http"
+	"strings"
 
 	"example.com/rest/internal/domain"
+	"example.com/rest/internal/logging"
 	"example.com/rest/internal/validator"
 )
 
+// ErrorFormat is the format used for error responses.
+type ErrorFormat string
+
+const (
+	ErrorFormatJSON    = ErrorFormat("json")    // {status, message, data} envelope
+	ErrorFormatProblem = ErrorFormat("problem") // RFC 9457 application/problem+json
+)
+
+const problemContentType = "application/problem+json"
+
 // jsonHelper for encoding and decoding JSON.
 type jsonHelper struct {
-	logger *slog.Logger
+	logger      *slog.Logger
+	errorFormat ErrorFormat
 }
 
 // response is the JSON response format for the API.
@@ -22,11 +36,28 @@ type response struct {
 	Data    any    `json:"data,omitempty"`    // response data or error fields for invalid requests
 }
 
+// problem is the RFC 9457 problem details format for error responses.
+// Code and Fields are extension members.
+type problem struct {
+	Type     string              `json:"type"`               // problem type URI, "about:blank" means the status code explains it
+	Title    string              `json:"title"`              // short summary of the status code
+	Status   int                 `json:"status"`             // HTTP status code
+	Detail   string              `json:"detail,omitempty"`   // human readable explanation
+	Instance string              `json:"instance,omitempty"` // request ID of the failed request
+	Code     domain.ErrorCode    `json:"code,omitempty"`     // machine readable domain error code
+	Fields   map[string][]string `json:"fields,omitempty"`   // validation errors per field
+}
+
 // WriteResponse sends a JSON response with the status code and response.
 func (j *jsonHelper) WriteResponse(w http.ResponseWriter, statusCode int, res response) {
-	w.Header().Set("Content-Type", "application/json")
+	j.write(w, statusCode, "application/json", res)
+}
+
+// write encodes v as JSON and sends it with the status code and content type.
+func (j *jsonHelper) write(w http.ResponseWriter, statusCode int, contentType string, v any) {
+	w.Header().Set("Content-Type", contentType)
 	w.WriteHeader(statusCode)
-	err := json.NewEncoder(w).Encode(res)
+	err := json.NewEncoder(w).Encode(v)
 	if err != nil {
 		// This error is very rare and should not happen
 		// If it does, it means that the encoded data is not supported by the JSON encoder (e.g. chan or func)
@@ -51,36 +82,89 @@ func (j *jsonHelper) Write(w http.ResponseWriter, statusCode int, data any) {
 // If the error is neither, it sends a generic error message and status code (500).
 // Internal server errors are logged.
 func (j *jsonHelper) WriteError(w http.ResponseWriter, r *http.Request, err error) {
-	res := response{Status: "error"}
 	statusCode := http.StatusInternalServerError
+	code := domain.INTERNAL_ERROR
+	var message string
+	var fields map[string][]string
 
 	// Check if the error is a domain or validation error
 	var domainError *domain.Error
 	var validationError *validator.Error
 	if errors.As(err, &domainError) {
-		if code, ok := domainToHTTPErrors[domainError.Code]; ok {
-			statusCode = code
-			res.Message = domainError.Message
+		if status, ok := domainToHTTPErrors[domainError.Code]; ok {
+			statusCode = status
+			code = domainError.Code
+			message = domainError.Message
+			fields = domainError.Fields
 		}
 	} else if errors.As(err, &validationError) {
 		statusCode = http.StatusBadRequest
-		res.Message = validationError.Message
-		res.Data = validationError.Fields
+		code = domain.INVALID_ERROR
+		message = validationError.Message
+		fields = validationError.Fields
+	} else if errors.Is(err, errPreconditionRequired) {
+		statusCode = http.StatusPreconditionRequired
+		code = domain.PRECONDITION_ERROR
+		message = "conditional request required, send the If-Match header"
 	}
 
 	if statusCode == http.StatusInternalServerError {
 		// Log the error, this is the only place where we log errors
-		reqID, ok := r.Context().Value(requestIDKey).(string)
-		if !ok {
-			reqID = "unknown"
-		}
-		j.logger.Error("internal server error", "request_id", reqID, "error", err)
+		logging.FromContext(r.Context()).Error("internal server error", "error", err)
 		// Hide the error message from the user
-		res.Message = "internal server error"
+		message = "internal server error"
+		fields = nil
+	}
+	j.writeError(w, r, statusCode, code, message, fields)
+}
+
+// writeError sends the error in the format negotiated for the request.
+func (j *jsonHelper) writeError(w http.ResponseWriter, r *http.Request, statusCode int, code domain.ErrorCode, message string, fields map[string][]string) {
+	if j.errorFormatFor(r) == ErrorFormatProblem {
+		j.write(w, statusCode, problemContentType, problem{
+			Type:     "about:blank",
+			Title:    http.StatusText(statusCode),
+			Status:   statusCode,
+			Detail:   message,
+			Instance: requestID(r),
+			Code:     code,
+			Fields:   fields,
+		})
+		return
+	}
+
+	res := response{Status: "error", Message: message}
+	if fields != nil {
+		res.Data = fields
 	}
 	j.WriteResponse(w, statusCode, res)
 }
 
+// errorFormatFor returns the error format for the request.
+// Clients asking for application/problem+json in the Accept header always get problem details,
+// clients asking only for application/json get the envelope, everyone else gets the configured format.
+func (j *jsonHelper) errorFormatFor(r *http.Request) ErrorFormat {
+	var acceptsJSON, acceptsAny bool
+	for _, part := range strings.Split(r.Header.Get("Accept"), ",") {
+		mediaType, _, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+		switch mediaType {
+		case problemContentType:
+			return ErrorFormatProblem
+		case "application/json":
+			acceptsJSON = true
+		case "*/*", "application/*":
+			acceptsAny = true
+		}
+	}
+	if acceptsJSON && !acceptsAny {
+		return ErrorFormatJSON
+	}
+	return j.errorFormat
+}
+
 // Read decodes the JSON request body into the target.
 // It doesn't allow unknown fields and returns an error if the request body is invalid.
 func (j *jsonHelper) Read(r *http.Request, target any) error {
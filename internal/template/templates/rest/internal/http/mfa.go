@@ -0,0 +1,108 @@
+package http
+
+import (
+	"net/http"
+
+	"example.com/rest/internal/domain"
+	"example.com/rest/internal/services"
+)
+
+// MFAHandler serves enrolling in and managing two-factor authentication.
+// The second login step is served by the login handler of the auth mode, see verifyMFA.
+type MFAHandler struct {
+	*baseHandler
+	mfaService *services.MFAService
+}
+
+func NewMFAHandler(baseHandler *baseHandler, mfaService *services.MFAService) *MFAHandler {
+	return &MFAHandler{
+		baseHandler: baseHandler,
+		mfaService:  mfaService,
+	}
+}
+
+// enroll returns a new secret and its otpauth URI, MFA is enabled once it is confirmed.
+func (h *MFAHandler) enroll(w http.ResponseWriter, r *http.Request) {
+	userID, err := h.getUserID(r)
+	if err != nil {
+		h.json.WriteError(w, r, err)
+		return
+	}
+
+	enrollment, err := h.mfaService.Enroll(r.Context(), userID)
+	if err != nil {
+		h.json.WriteError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	h.json.Write(w, http.StatusOK, enrollment)
+}
+
+// confirm enables MFA and returns the recovery codes, they are shown only once.
+func (h *MFAHandler) confirm(w http.ResponseWriter, r *http.Request) {
+	userID, err := h.getUserID(r)
+	if err != nil {
+		h.json.WriteError(w, r, err)
+		return
+	}
+
+	var req domain.MFACodeRequest
+	if err := h.json.Read(r, &req); err != nil {
+		h.json.WriteError(w, r, err)
+		return
+	}
+
+	codes, err := h.mfaService.Confirm(r.Context(), userID, &req)
+	if err != nil {
+		h.json.WriteError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	h.json.Write(w, http.StatusOK, map[string]any{"recovery_codes": codes})
+}
+
+func (h *MFAHandler) regenerateRecoveryCodes(w http.ResponseWriter, r *http.Request) {
+	userID, err := h.getUserID(r)
+	if err != nil {
+		h.json.WriteError(w, r, err)
+		return
+	}
+
+	var req domain.MFACodeRequest
+	if err := h.json.Read(r, &req); err != nil {
+		h.json.WriteError(w, r, err)
+		return
+	}
+
+	codes, err := h.mfaService.RegenerateRecoveryCodes(r.Context(), userID, &req)
+	if err != nil {
+		h.json.WriteError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	h.json.Write(w, http.StatusOK, map[string]any{"recovery_codes": codes})
+}
+
+func (h *MFAHandler) disable(w http.ResponseWriter, r *http.Request) {
+	userID, err := h.getUserID(r)
+	if err != nil {
+		h.json.WriteError(w, r, err)
+		return
+	}
+
+	var req domain.MFACodeRequest
+	if err := h.json.Read(r, &req); err != nil {
+		h.json.WriteError(w, r, err)
+		return
+	}
+
+	if err := h.mfaService.Disable(r.Context(), userID, &req); err != nil {
+		h.json.WriteError(w, r, err)
+		return
+	}
+
+	h.json.Write(w, http.StatusNoContent, nil)
+}
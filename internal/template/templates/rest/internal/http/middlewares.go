@@ -2,142 +2,304 @@ package http
 
 import (
 	"context"
+	"io"
 	"log/slog"
 	"net/http"
+	"regexp"
 	"strings"
+	"sync"
 	"time"
 
 	"example.com/rest/internal/domain"
+	"example.com/rest/internal/logging"
+	"example.com/rest/internal/metrics"
+	"example.com/rest/internal/ratelimit"
+	"example.com/rest/internal/services"
+	"github.com/go-chi/chi/v5"
 	"github.com/google/uuid"
 )
 
 // Middlewares contains all the dependencies required by the middleware functions.
 type Middlewares struct {
 	*baseHandler
-	validateToken func(string) (int, error)
-	logger        *slog.Logger
+	validateToken       func(string) (*domain.Principal, error)
+	authenticateAPIKey  func(context.Context, string) (*domain.Principal, error)
+	authenticateSession func(context.Context, string) (*domain.Principal, error)
+	mfaEnabled          func(context.Context, int) (bool, error)
+	authMode            AuthMode
+	idempotencyService  *services.IdempotencyService
+	rateLimitStore      ratelimit.Store
+	trustedProxyHeaders []string
+	metrics             *metrics.Metrics
+	errorReporter       ErrorReporter
+	accessLogFormat     AccessLogFormat
+	accessLogOutput     io.Writer
+	accessLogMu         sync.Mutex
+	logger              *slog.Logger
 }
 
 // NewMiddlewares creates a new Middlewares instance with the required dependencies.
-func NewMiddlewares(baseHandler *baseHandler, validateToken func(string) (int, error), logger *slog.Logger) *Middlewares {
+// The auth mode selects whether Auth accepts bearer tokens or session cookies.
+// trustedProxyHeaders are the headers used to find the client IP behind a proxy (e.g. X-Forwarded-For).
+// mfaEnabled reports whether a user has MFA enabled for RequireMFA, nil turns the check off.
+// errorReporter receives recovered panics, it may be nil.
+// accessLogOutput receives the access log lines in the combined format, the JSON format uses the logger.
+func NewMiddlewares(
+	baseHandler *baseHandler,
+	validateToken func(string) (*domain.Principal, error),
+	authenticateAPIKey func(context.Context, string) (*domain.Principal, error),
+	authenticateSession func(context.Context, string) (*domain.Principal, error),
+	mfaEnabled func(context.Context, int) (bool, error),
+	authMode AuthMode,
+	idempotencyService *services.IdempotencyService,
+	rateLimitStore ratelimit.Store,
+	trustedProxyHeaders []string,
+	metrics *metrics.Metrics,
+	errorReporter ErrorReporter,
+	accessLogFormat AccessLogFormat,
+	accessLogOutput io.Writer,
+	logger *slog.Logger,
+) *Middlewares {
 	return &Middlewares{
-		baseHandler:   baseHandler,
-		validateToken: validateToken,
-		logger:        logger,
+		baseHandler:         baseHandler,
+		validateToken:       validateToken,
+		authenticateAPIKey:  authenticateAPIKey,
+		authenticateSession: authenticateSession,
+		mfaEnabled:          mfaEnabled,
+		authMode:            authMode,
+		idempotencyService:  idempotencyService,
+		rateLimitStore:      rateLimitStore,
+		trustedProxyHeaders: trustedProxyHeaders,
+		metrics:             metrics,
+		errorReporter:       errorReporter,
+		accessLogFormat:     accessLogFormat,
+		accessLogOutput:     accessLogOutput,
+		logger:              logger,
 	}
 }
 
-// Auth returns a middleware that validates the JWT token in the Authorization header.
-// If the token is valid, it adds the user ID to the request context.
-// Handlers can retrieve the user ID using the getUserID method from the baseHandler.
+// Auth returns a middleware that authenticates the request with the API key in the X-API-Key header,
+// or depending on the auth mode with the JWT token in the Authorization header or the session cookie.
+// All of them result in the same principal.
+// If the credentials are valid, it adds the principal to the request context and the user ID to the request logger.
+// Handlers can retrieve the principal using the getPrincipal and getUserID methods from the baseHandler,
+// services using domain.PrincipalFromContext.
 func (m *Middlewares) Auth(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		authHeader := r.Header.Get("Authorization")
-		if authHeader == "" {
-			m.json.WriteError(w, r, domain.Errorf(domain.UNAUTHORIZED_ERROR, "authorization header required"))
+		var principal *domain.Principal
+		var err error
+		if apiKey := r.Header.Get("X-API-Key"); apiKey != "" {
+			principal, err = m.authenticateAPIKey(r.Context(), apiKey)
+		} else if m.authMode == AuthModeSession {
+			principal, err = m.authenticateCookie(r)
+		} else {
+			principal, err = m.authenticateToken(r)
+		}
+		if err != nil {
+			m.json.WriteError(w, r, err)
+			return
+		}
+
+		ctx := domain.ContextWithPrincipal(r.Context(), principal)
+		ctx = logging.With(ctx, "user_id", principal.UserID)
+		if principal.APIKeyID != 0 {
+			ctx = logging.With(ctx, "api_key_id", principal.APIKeyID)
+		}
+		if principal.SessionID != 0 {
+			ctx = logging.With(ctx, "session_id", principal.SessionID)
+		}
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// authenticateToken validates the bearer token in the Authorization header.
+func (m *Middlewares) authenticateToken(r *http.Request) (*domain.Principal, error) {
+	authHeader := r.Header.Get("Authorization")
+	if authHeader == "" {
+		return nil, domain.Errorf(domain.UNAUTHORIZED_ERROR, "authorization header required")
+	}
+
+	parts := strings.Split(authHeader, " ")
+	if len(parts) != 2 || strings.ToLower(parts[0]) != "bearer" {
+		return nil, domain.Errorf(domain.UNAUTHORIZED_ERROR, "invalid authorization header format")
+	}
+
+	return m.validateToken(parts[1])
+}
+
+// authenticateCookie validates the session cookie.
+func (m *Middlewares) authenticateCookie(r *http.Request) (*domain.Principal, error) {
+	cookie, err := r.Cookie(sessionCookieName)
+	if err != nil || cookie.Value == "" {
+		return nil, domain.Errorf(domain.UNAUTHORIZED_ERROR, "session cookie required")
+	}
+	return m.authenticateSession(r.Context(), cookie.Value)
+}
+
+// safeMethods don't change state, so they don't need CSRF protection.
+var safeMethods = map[string]bool{
+	http.MethodGet:     true,
+	http.MethodHead:    true,
+	http.MethodOptions: true,
+	http.MethodTrace:   true,
+}
+
+// CSRF middleware protects requests authenticated with a session cookie against cross-site request forgery.
+// Browsers send the cookie with requests started by other sites, so unsafe requests must also carry
+// the CSRF token of the session in the X-CSRF-Token header, which other sites can't read or set.
+// It must run after Auth, requests authenticated with a bearer token or API key are not affected.
+func (m *Middlewares) CSRF(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		principal, ok := domain.PrincipalFromContext(r.Context())
+		if !ok || principal.SessionID == 0 || safeMethods[r.Method] {
+			next.ServeHTTP(w, r)
 			return
 		}
 
-		parts := strings.Split(authHeader, " ")
-		if len(parts) != 2 || strings.ToLower(parts[0]) != "bearer" {
-			m.json.WriteError(w, r, domain.Errorf(domain.UNAUTHORIZED_ERROR, "invalid authorization header format"))
+		cookie, err := r.Cookie(sessionCookieName)
+		if err != nil || !services.ValidCSRFToken(cookie.Value, r.Header.Get(csrfHeader)) {
+			m.json.WriteError(w, r, domain.Errorf(domain.FORBIDDEN_ERROR, "invalid or missing CSRF token"))
 			return
 		}
 
-		userID, err := m.validateToken(parts[1])
+		next.ServeHTTP(w, r)
+	})
+}
+
+// RequireMFA is a middleware that only lets principals through whose user has MFA enabled.
+// Such users can only log in with a second factor, so their tokens and sessions were issued after one.
+// It must run after Auth, requests of other users are rejected with 403. Without mfaEnabled, it lets all principals through.
+func (m *Middlewares) RequireMFA(next http.Handler) http.Handler {
+	if m.mfaEnabled == nil {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		principal, ok := domain.PrincipalFromContext(r.Context())
+		if !ok {
+			m.json.WriteError(w, r, domain.Errorf(domain.UNAUTHORIZED_ERROR, "user not authenticated"))
+			return
+		}
+
+		enabled, err := m.mfaEnabled(r.Context(), principal.UserID)
 		if err != nil {
 			m.json.WriteError(w, r, err)
 			return
 		}
+		if !enabled {
+			m.json.WriteError(w, r, domain.Errorf(domain.FORBIDDEN_ERROR, "enable two-factor authentication to perform this operation"))
+			return
+		}
 
-		ctx := context.WithValue(r.Context(), userIDKey, userID)
-		next.ServeHTTP(w, r.WithContext(ctx))
+		next.ServeHTTP(w, r)
 	})
 }
 
-// RequestID middleware generates a unique request ID and adds it to the request context and response headers.
+// RequireRole returns a middleware that only lets principals with the role through.
+// It must run after Auth, requests of other users are rejected with 403.
+func (m *Middlewares) RequireRole(role string) func(http.Handler) http.Handler {
+	return m.require(func(principal *domain.Principal) bool { return principal.HasRole(role) })
+}
+
+// RequirePermission returns a middleware that only lets principals with the permission through.
+// It must run after Auth, requests of other users are rejected with 403.
+func (m *Middlewares) RequirePermission(permission string) func(http.Handler) http.Handler {
+	return m.require(func(principal *domain.Principal) bool { return principal.HasPermission(permission) })
+}
+
+// require returns a middleware that rejects requests whose principal is not allowed.
+func (m *Middlewares) require(allowed func(*domain.Principal) bool) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			principal, ok := domain.PrincipalFromContext(r.Context())
+			if !ok {
+				m.json.WriteError(w, r, domain.Errorf(domain.UNAUTHORIZED_ERROR, "user not authenticated"))
+				return
+			}
+			if !allowed(principal) {
+				m.json.WriteError(w, r, domain.Errorf(domain.FORBIDDEN_ERROR, "you are not allowed to perform this operation"))
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// validRequestID matches incoming request IDs that are safe to reuse in logs and headers.
+var validRequestID = regexp.MustCompile(`^[A-Za-z0-9._:-]{1,128}$`)
+
+// RequestID middleware adds a request ID to the request context and response headers.
+// It reuses a valid X-Request-ID header sent by the client or a proxy and generates a new ID otherwise.
+// It also stores the request logger in the context, enriched with the request ID and route.
+// Handlers and services retrieve it with logging.FromContext.
+// The request ID, client IP and user agent are stored as the domain.Client for the audit trail.
 func (m *Middlewares) RequestID(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		requestID := uuid.New().String()
+		requestID := r.Header.Get("X-Request-ID")
+		if !validRequestID.MatchString(requestID) {
+			requestID = uuid.New().String()
+		}
 		w.Header().Set("X-Request-ID", requestID)
+
 		ctx := context.WithValue(r.Context(), requestIDKey, requestID)
+		ctx = domain.ContextWithClient(ctx, &domain.Client{
+			RequestID: requestID,
+			IP:        clientIP(r, m.trustedProxyHeaders),
+			UserAgent: r.UserAgent(),
+		})
+		ctx = logging.WithLogger(ctx, m.logger.With(
+			"request_id", requestID,
+			"route", routePattern{chi.RouteContext(r.Context())},
+		))
 		next.ServeHTTP(w, r.WithContext(ctx))
 	})
 }
 
-// responseWriter is a wrapper around http.ResponseWriter that captures the status code.
-type responseWriter struct {
-	http.ResponseWriter
-	status int
+// routePattern resolves the chi route pattern when a log record is written,
+// as the pattern is only complete once the request has been routed.
+type routePattern struct {
+	rctx *chi.Context
 }
 
-// WriteHeader overrides the WriteHeader method to capture the status code.
-func (rw *responseWriter) WriteHeader(code int) {
-	rw.status = code
-	rw.ResponseWriter.WriteHeader(code)
+// LogValue implements the slog.LogValuer interface.
+func (p routePattern) LogValue() slog.Value {
+	if p.rctx == nil {
+		return slog.StringValue("")
+	}
+	return slog.StringValue(p.rctx.RoutePattern())
 }
 
-// Logger logs incoming HTTP requests and their duration.
-// It logs at the start and end of a request.
-func (m *Middlewares) Logger(next http.Handler) http.Handler {
+// Metrics records the request count, duration and in-flight requests.
+// Requests are labeled with the chi route pattern instead of the raw path, so IDs in paths don't create new series.
+func (m *Middlewares) Metrics(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		start := time.Now()
+		m.metrics.RequestStarted()
 
-		wrapped := &responseWriter{
-			ResponseWriter: w,
-			status:         http.StatusOK,
-		}
-
-		reqID, ok := r.Context().Value(requestIDKey).(string)
-		if !ok {
-			reqID = "unknown"
-		}
+		wrapped, ww := wrapResponseWriter(w)
 
-		m.logger.Info("HTTP Request Received",
-			"request_id", reqID,
-			"method", r.Method,
-			"path", r.URL.Path,
-			"user_agent", r.UserAgent(),
-		)
-
-		next.ServeHTTP(wrapped, r)
-
-		m.logger.Info("HTTP Request Completed",
-			"request_id", reqID,
-			"method", r.Method,
-			"path", r.URL.Path,
-			"user_agent", r.UserAgent(),
-			"status", wrapped.status,
-			"duration", time.Since(start).String(),
-		)
-	})
-}
-
-// recovery middleware recovers from panics and logs the error.
-func (m *Middlewares) Recovery(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// the route pattern is only known after routing, read it once the request is served
+		// or has panicked
+		completed := false
 		defer func() {
-			err := recover()
-			if err != nil {
-				m.json.WriteError(w, r, domain.Errorf(domain.INTERNAL_ERROR, "panic occurred: %v", err))
+			route := "unmatched"
+			if pattern := chi.RouteContext(r.Context()).RoutePattern(); pattern != "" {
+				route = pattern
 			}
+			m.metrics.RequestFinished(r.Method, route, wrapped.statusOrPanic(completed), time.Since(start))
 		}()
-		next.ServeHTTP(w, r)
+
+		next.ServeHTTP(ww, r)
+		completed = true
 	})
 }
 
 // NotFound sends a 404 response for unknown routes.
 func (m *Middlewares) NotFound(w http.ResponseWriter, r *http.Request) {
-	m.json.WriteResponse(w, http.StatusNotFound, response{
-		Status:  "error",
-		Message: "not found",
-	})
+	m.json.WriteError(w, r, domain.Errorf(domain.NOTFOUND_ERROR, "not found"))
 }
 
 // MethodNotAllowed sends a 405 response for unknown methods.
 func (m *Middlewares) MethodNotAllowed(w http.ResponseWriter, r *http.Request) {
-	m.json.WriteResponse(w, http.StatusMethodNotAllowed, response{
-		Status:  "error",
-		Message: "method not allowed",
-	})
+	// There is no domain error for this status, so the response is written directly
+	m.json.writeError(w, r, http.StatusMethodNotAllowed, "", "method not allowed", nil)
 }
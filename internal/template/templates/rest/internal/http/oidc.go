@@ -0,0 +1,56 @@
+package http
+
+import (
+	"net/http"
+
+	"example.com/rest/internal/services"
+	"github.com/go-chi/chi/v5"
+)
+
+// OIDCHandler serves signing in with OpenID Connect providers and the identities linked to users.
+// The callback is served by the login handler of the auth mode, see oidcCallback.
+type OIDCHandler struct {
+	*baseHandler
+	oidcService *services.OIDCService
+}
+
+func NewOIDCHandler(baseHandler *baseHandler, oidcService *services.OIDCService) *OIDCHandler {
+	return &OIDCHandler{
+		baseHandler: baseHandler,
+		oidcService: oidcService,
+	}
+}
+
+// listProviders returns the names of the configured providers, e.g. to show a button for each.
+func (h *OIDCHandler) listProviders(w http.ResponseWriter, r *http.Request) {
+	h.json.Write(w, http.StatusOK, map[string]any{"providers": h.oidcService.Providers()})
+}
+
+// authorize returns the URL of the provider the app sends the user to,
+// and the binding the app keeps until it posts the callback.
+func (h *OIDCHandler) authorize(w http.ResponseWriter, r *http.Request) {
+	url, binding, err := h.oidcService.Authorize(r.Context(), chi.URLParam(r, "provider"))
+	if err != nil {
+		h.json.WriteError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	h.json.Write(w, http.StatusOK, map[string]any{"authorization_url": url, "binding": binding})
+}
+
+func (h *OIDCHandler) listIdentities(w http.ResponseWriter, r *http.Request) {
+	userID, err := h.getUserID(r)
+	if err != nil {
+		h.json.WriteError(w, r, err)
+		return
+	}
+
+	identities, err := h.oidcService.ListIdentities(r.Context(), userID)
+	if err != nil {
+		h.json.WriteError(w, r, err)
+		return
+	}
+
+	h.json.Write(w, http.StatusOK, map[string]any{"identities": identities})
+}
@@ -0,0 +1,67 @@
+package http
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"example.com/rest/internal/domain"
+	"example.com/rest/internal/logging"
+	"example.com/rest/internal/ratelimit"
+)
+
+// rateLimitKey returns the key that requests are counted by.
+type rateLimitKey func(r *http.Request) string
+
+// byIP counts requests per client IP.
+func (m *Middlewares) byIP(r *http.Request) string {
+	return "ip:" + clientIP(r, m.trustedProxyHeaders)
+}
+
+// byUser counts requests per authenticated user and falls back to the client IP.
+// It must run after the Auth middleware.
+func (m *Middlewares) byUser(r *http.Request) string {
+	if principal, ok := domain.PrincipalFromContext(r.Context()); ok {
+		return "user:" + strconv.Itoa(principal.UserID)
+	}
+	return m.byIP(r)
+}
+
+// RateLimit returns a middleware that allows limit requests per key.
+// The name separates the buckets of different routes, so each route can have its own limit.
+// It sets the RateLimit-Limit, RateLimit-Remaining and RateLimit-Reset headers on every response
+// and Retry-After on 429 responses.
+// If the store fails, the request is let through and the error is logged.
+func (m *Middlewares) RateLimit(name string, limit ratelimit.Limit, key rateLimitKey) func(http.Handler) http.Handler {
+	policy := strconv.Itoa(limit.Requests) + ";w=" + strconv.Itoa(int(limit.Window.Seconds()))
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			result, err := m.rateLimitStore.Take(r.Context(), name+":"+key(r), limit)
+			if err != nil {
+				logging.FromContext(r.Context()).Error("rate limit store failed", "error", err)
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			w.Header().Set("RateLimit-Policy", policy)
+			w.Header().Set("RateLimit-Limit", strconv.Itoa(result.Limit))
+			w.Header().Set("RateLimit-Remaining", strconv.Itoa(result.Remaining))
+			w.Header().Set("RateLimit-Reset", ceilSeconds(result.Reset))
+
+			if !result.Allowed {
+				w.Header().Set("Retry-After", ceilSeconds(result.RetryAfter))
+				m.json.WriteError(w, r, domain.Errorf(domain.RATE_LIMIT_ERROR, "too many requests, try again later"))
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// ceilSeconds formats a duration as whole seconds, rounded up.
+func ceilSeconds(d time.Duration) string {
+	return strconv.Itoa(int(math.Ceil(d.Seconds())))
+}
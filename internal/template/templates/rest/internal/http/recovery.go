@@ -0,0 +1,62 @@
+package http
+
+import (
+	"fmt"
+	"net/http"
+	"runtime/debug"
+
+	"example.com/rest/internal/domain"
+	"example.com/rest/internal/logging"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// ErrorReporter receives the panics recovered by the Recovery middleware.
+// Implement it to send panics to an error tracking service (e.g. Sentry).
+type ErrorReporter interface {
+	// Report is called with the request, the panic as an error and the stack trace of the panic.
+	// It runs on the request goroutine, so it should not block for long.
+	Report(r *http.Request, err error, stack []byte)
+}
+
+// Recovery recovers from panics in the handlers and the middlewares after it.
+// The panic is logged with its stack trace and passed to the error reporter, if there is one.
+// If the response has not started, a 500 error is sent. Otherwise the connection is aborted,
+// as appending an error to a partially written response would corrupt it.
+// Panics with http.ErrAbortHandler are passed on, they are the way to abort a response on purpose.
+func (m *Middlewares) Recovery(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		wrapped, ww := wrapResponseWriter(w)
+
+		defer func() {
+			p := recover()
+			if p == nil {
+				return
+			}
+			if p == http.ErrAbortHandler {
+				panic(p)
+			}
+
+			stack := debug.Stack()
+			err, ok := p.(error)
+			if !ok {
+				err = fmt.Errorf("%v", p)
+			}
+			err = fmt.Errorf("panic: %w", err)
+
+			logging.FromContext(r.Context()).Error("panic recovered", "error", err, "stack", string(stack))
+
+			trace.SpanFromContext(r.Context()).RecordError(err)
+
+			if m.errorReporter != nil {
+				m.errorReporter.Report(r, err, stack)
+			}
+
+			if wrapped.wroteHeader {
+				panic(http.ErrAbortHandler)
+			}
+			m.json.writeError(ww, r, http.StatusInternalServerError, domain.INTERNAL_ERROR, "internal server error", nil)
+		}()
+
+		next.ServeHTTP(ww, r)
+	})
+}
@@ -0,0 +1,223 @@
+package http
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"net"
+	"net/http"
+)
+
+// responseWriter is a wrapper around http.ResponseWriter that captures the status code and the number of bytes written.
+// Use wrapResponseWriter to create it, so the optional interfaces of the underlying writer are kept.
+type responseWriter struct {
+	http.ResponseWriter
+	status      int
+	bytes       int64
+	wroteHeader bool
+	body        *bytes.Buffer // if set, the body is copied to it, see captureBody
+}
+
+// WriteHeader overrides the WriteHeader method to capture the status code.
+// Informational (1xx) responses can be followed by another status, so only the final status is kept.
+func (rw *responseWriter) WriteHeader(code int) {
+	if !rw.wroteHeader && (code >= http.StatusOK || code == http.StatusSwitchingProtocols) {
+		rw.status = code
+		rw.wroteHeader = true
+	}
+	rw.ResponseWriter.WriteHeader(code)
+}
+
+// Write overrides the Write method to count the bytes written.
+func (rw *responseWriter) Write(b []byte) (int, error) {
+	rw.wroteHeader = true
+	n, err := rw.ResponseWriter.Write(b)
+	rw.bytes += int64(n)
+	if rw.body != nil {
+		rw.body.Write(b[:n])
+	}
+	return n, err
+}
+
+// captureBody makes the wrapper keep a copy of the body written from now on.
+func (rw *responseWriter) captureBody() {
+	rw.body = &bytes.Buffer{}
+}
+
+// statusOrPanic returns the status of the response. If the handler panicked before the response
+// started, it returns 500, the status the Recovery middleware sends.
+// Middlewares that run inside Recovery use it to report the status of panicking requests.
+func (rw *responseWriter) statusOrPanic(completed bool) int {
+	if !completed && !rw.wroteHeader {
+		return http.StatusInternalServerError
+	}
+	return rw.status
+}
+
+// Unwrap returns the underlying writer, it is used by http.ResponseController.
+func (rw *responseWriter) Unwrap() http.ResponseWriter {
+	return rw.ResponseWriter
+}
+
+// flush implements http.Flusher, it is only exposed if the underlying writer supports it.
+func (rw *responseWriter) flush() {
+	rw.wroteHeader = true
+	rw.ResponseWriter.(http.Flusher).Flush()
+}
+
+// hijack implements http.Hijacker, it is only exposed if the underlying writer supports it.
+// The status of a hijacked connection is reported as 101 Switching Protocols.
+func (rw *responseWriter) hijack() (net.Conn, *bufio.ReadWriter, error) {
+	conn, buf, err := rw.ResponseWriter.(http.Hijacker).Hijack()
+	if err == nil && !rw.wroteHeader {
+		rw.status = http.StatusSwitchingProtocols
+		rw.wroteHeader = true
+	}
+	return conn, buf, err
+}
+
+// readFrom implements io.ReaderFrom, it is only exposed if the underlying writer supports it.
+// It keeps the sendfile optimization of the standard library while counting the bytes,
+// unless the body is captured.
+func (rw *responseWriter) readFrom(src io.Reader) (int64, error) {
+	rw.wroteHeader = true
+	if rw.body != nil {
+		src = io.TeeReader(src, rw.body)
+	}
+	n, err := rw.ResponseWriter.(io.ReaderFrom).ReadFrom(src)
+	rw.bytes += n
+	return n, err
+}
+
+// push implements http.Pusher, it is only exposed if the underlying writer supports it.
+func (rw *responseWriter) push(target string, opts *http.PushOptions) error {
+	return rw.ResponseWriter.(http.Pusher).Push(target, opts)
+}
+
+// The method types used to expose the optional interfaces.
+type (
+	flusherFunc    func()
+	hijackerFunc   func() (net.Conn, *bufio.ReadWriter, error)
+	readerFromFunc func(io.Reader) (int64, error)
+	pusherFunc     func(string, *http.PushOptions) error
+)
+
+func (f flusherFunc) Flush()                                        { f() }
+func (f hijackerFunc) Hijack() (net.Conn, *bufio.ReadWriter, error) { return f() }
+func (f readerFromFunc) ReadFrom(src io.Reader) (int64, error)      { return f(src) }
+func (f pusherFunc) Push(target string, opts *http.PushOptions) error {
+	return f(target, opts)
+}
+
+// wrapResponseWriter wraps w to capture the status code and bytes written.
+// It returns the wrapper to read them from and the writer to pass to the next handler.
+// The returned writer implements exactly the optional interfaces (http.Flusher, http.Hijacker,
+// io.ReaderFrom and http.Pusher) that w implements, so type assertions downstream
+// behave as if w was not wrapped. This keeps streaming, websockets and sendfile working.
+func wrapResponseWriter(w http.ResponseWriter) (*responseWriter, http.ResponseWriter) {
+	rw := &responseWriter{ResponseWriter: w, status: http.StatusOK}
+
+	_, isFlusher := w.(http.Flusher)
+	_, isHijacker := w.(http.Hijacker)
+	_, isReaderFrom := w.(io.ReaderFrom)
+	_, isPusher := w.(http.Pusher)
+
+	f, h, rf, p := flusherFunc(rw.flush), hijackerFunc(rw.hijack), readerFromFunc(rw.readFrom), pusherFunc(rw.push)
+
+	switch {
+	case isFlusher && isHijacker && isReaderFrom && isPusher:
+		return rw, struct {
+			*responseWriter
+			flusherFunc
+			hijackerFunc
+			readerFromFunc
+			pusherFunc
+		}{rw, f, h, rf, p}
+	case isFlusher && isHijacker && isReaderFrom:
+		return rw, struct {
+			*responseWriter
+			flusherFunc
+			hijackerFunc
+			readerFromFunc
+		}{rw, f, h, rf}
+	case isFlusher && isHijacker && isPusher:
+		return rw, struct {
+			*responseWriter
+			flusherFunc
+			hijackerFunc
+			pusherFunc
+		}{rw, f, h, p}
+	case isFlusher && isReaderFrom && isPusher:
+		return rw, struct {
+			*responseWriter
+			flusherFunc
+			readerFromFunc
+			pusherFunc
+		}{rw, f, rf, p}
+	case isHijacker && isReaderFrom && isPusher:
+		return rw, struct {
+			*responseWriter
+			hijackerFunc
+			readerFromFunc
+			pusherFunc
+		}{rw, h, rf, p}
+	case isFlusher && isHijacker:
+		return rw, struct {
+			*responseWriter
+			flusherFunc
+			hijackerFunc
+		}{rw, f, h}
+	case isFlusher && isReaderFrom:
+		return rw, struct {
+			*responseWriter
+			flusherFunc
+			readerFromFunc
+		}{rw, f, rf}
+	case isFlusher && isPusher:
+		return rw, struct {
+			*responseWriter
+			flusherFunc
+			pusherFunc
+		}{rw, f, p}
+	case isHijacker && isReaderFrom:
+		return rw, struct {
+			*responseWriter
+			hijackerFunc
+			readerFromFunc
+		}{rw, h, rf}
+	case isHijacker && isPusher:
+		return rw, struct {
+			*responseWriter
+			hijackerFunc
+			pusherFunc
+		}{rw, h, p}
+	case isReaderFrom && isPusher:
+		return rw, struct {
+			*responseWriter
+			readerFromFunc
+			pusherFunc
+		}{rw, rf, p}
+	case isFlusher:
+		return rw, struct {
+			*responseWriter
+			flusherFunc
+		}{rw, f}
+	case isHijacker:
+		return rw, struct {
+			*responseWriter
+			hijackerFunc
+		}{rw, h}
+	case isReaderFrom:
+		return rw, struct {
+			*responseWriter
+			readerFromFunc
+		}{rw, rf}
+	case isPusher:
+		return rw, struct {
+			*responseWriter
+			pusherFunc
+		}{rw, p}
+	default:
+		return rw, rw
+	}
+}
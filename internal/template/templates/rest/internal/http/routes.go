@@ -1,6 +1,12 @@
 package http
 
 import (
+	"net/http"
+	"time"
+
+	"example.com/rest/internal/oidc"
+	"example.com/rest/internal/ratelimit"
+	"example.com/rest/internal/services"
 	"github.com/go-chi/chi/v5"
 )
 
@@ -8,6 +14,13 @@ import (
 // It uses chi as the underlying router.
 func NewRouter(
 	userHandler *UserHandler,
+	sessionHandler *SessionHandler,
+	mfaHandler *MFAHandler,
+	oidcHandler *OIDCHandler,
+	adminHandler *AdminHandler,
+	healthHandler *HealthHandler,
+	jwksHandler http.Handler,
+	mockOIDC *oidc.MockProvider,
 	middlewares *Middlewares,
 ) *chi.Mux {
 	r := chi.NewRouter()
@@ -15,26 +28,124 @@ func NewRouter(
 	// Global middlewares
 	r.Use(
 		middlewares.RequestID,
-		middlewares.Logger,
-		middlewares.Recovery,
+		middlewares.Tracing,
+		middlewares.Recovery, // outside of metrics and the access log, so they record the 500 of a panic
+		middlewares.Metrics,
+		middlewares.AccessLog,
 	)
 
 	r.NotFound(middlewares.NotFound)
 
 	r.MethodNotAllowed(middlewares.MethodNotAllowed)
 
+	// Health checks for orchestrators and load balancers
+	r.Get("/livez", healthHandler.livez)
+	r.Get("/readyz", healthHandler.readyz)
+
+	// Public keys for other services to verify our tokens
+	r.Method(http.MethodGet, "/.well-known/jwks.json", jwksHandler)
+
+	// Mock OIDC provider for local development, nil unless enabled
+	if mockOIDC != nil {
+		r.Mount(mockOIDC.Path(), mockOIDC)
+	}
+
 	r.Route("/api/v1", func(r chi.Router) {
-		r.Post("/user/register", userHandler.register)
-		r.Post("/user/login", userHandler.login)
+		// Anonymous routes are rate limited per client IP, authenticated routes per user
+		r.With(middlewares.RateLimit("register", ratelimit.Limit{Requests: 10, Window: time.Hour}, middlewares.byIP), middlewares.Idempotency).
+			Post("/user/register", userHandler.register)
+		r.With(middlewares.RateLimit("verify_email", ratelimit.Limit{Requests: 10, Window: time.Minute}, middlewares.byIP)).
+			Post("/user/email/verify", userHandler.verifyEmail)
+		r.With(middlewares.RateLimit("forgot_password", ratelimit.Limit{Requests: 5, Window: time.Hour}, middlewares.byIP)).
+			Post("/user/password/forgot", userHandler.forgotPassword)
+		r.With(middlewares.RateLimit("reset_password", ratelimit.Limit{Requests: 10, Window: time.Hour}, middlewares.byIP)).
+			Post("/user/password/reset", userHandler.resetPassword)
+		r.Get("/user/oidc/providers", oidcHandler.listProviders)
+		r.With(middlewares.RateLimit("oidc_authorize", ratelimit.Limit{Requests: 20, Window: time.Minute}, middlewares.byIP)).
+			Post("/user/oidc/{provider}/authorize", oidcHandler.authorize)
+
+		// Login and logout depend on the auth mode, sessions have no refresh tokens
+		if middlewares.authMode == AuthModeSession {
+			r.With(middlewares.RateLimit("login", ratelimit.Limit{Requests: 5, Window: time.Minute}, middlewares.byIP)).
+				Post("/user/login", sessionHandler.login)
+			r.With(middlewares.RateLimit("login_mfa", ratelimit.Limit{Requests: 10, Window: time.Minute}, middlewares.byIP)).
+				Post("/user/login/mfa", sessionHandler.verifyMFA)
+			r.With(middlewares.RateLimit("oidc_callback", ratelimit.Limit{Requests: 20, Window: time.Minute}, middlewares.byIP)).
+				Post("/user/oidc/callback", sessionHandler.oidcCallback)
+		} else {
+			r.With(middlewares.RateLimit("login", ratelimit.Limit{Requests: 5, Window: time.Minute}, middlewares.byIP)).
+				Post("/user/login", userHandler.login)
+			r.With(middlewares.RateLimit("login_mfa", ratelimit.Limit{Requests: 10, Window: time.Minute}, middlewares.byIP)).
+				Post("/user/login/mfa", userHandler.verifyMFA)
+			r.With(middlewares.RateLimit("oidc_callback", ratelimit.Limit{Requests: 20, Window: time.Minute}, middlewares.byIP)).
+				Post("/user/oidc/callback", userHandler.oidcCallback)
+			r.With(middlewares.RateLimit("refresh", ratelimit.Limit{Requests: 30, Window: time.Minute}, middlewares.byIP)).
+				Post("/user/token/refresh", userHandler.refreshToken)
+		}
 
 		r.Group(func(r chi.Router) {
 			r.Use(middlewares.Auth)
+			r.Use(middlewares.CSRF)
+			r.Use(middlewares.RateLimit("user", ratelimit.Limit{Requests: 100, Window: time.Minute}, middlewares.byUser))
+			r.Use(middlewares.Idempotency) // after Auth, the keys are scoped to the principal
 
 			r.Get("/user", userHandler.getUser)
 			r.Patch("/user", userHandler.updateUser)
 			r.Delete("/user", userHandler.deleteUser)
+			r.With(middlewares.RateLimit("verification_email", ratelimit.Limit{Requests: 3, Window: time.Hour}, middlewares.byUser)).
+				Post("/user/email/verification", userHandler.requestVerification)
+			if middlewares.authMode == AuthModeSession {
+				r.Post("/user/logout", sessionHandler.logout)
+				r.Post("/user/logout-all", sessionHandler.logoutAll)
+				r.Get("/user/sessions", sessionHandler.listSessions)
+				r.Delete("/user/sessions/{id}", sessionHandler.revokeSession)
+			} else {
+				r.Post("/user/logout", userHandler.logout)
+				r.Post("/user/logout-all", userHandler.logoutAll)
+			}
+
+			r.Get("/user/api-keys", userHandler.listAPIKeys)
+			r.Post("/user/api-keys", userHandler.createAPIKey)
+			r.Delete("/user/api-keys/{id}", userHandler.revokeAPIKey)
+
+			// Codes can be guessed, so managing two-factor authentication is limited per user
+			r.Group(func(r chi.Router) {
+				r.Use(middlewares.RateLimit("mfa", ratelimit.Limit{Requests: 10, Window: time.Hour}, middlewares.byUser))
+
+				r.Post("/user/mfa/enroll", mfaHandler.enroll)
+				r.Post("/user/mfa/confirm", mfaHandler.confirm)
+				r.Post("/user/mfa/recovery-codes", mfaHandler.regenerateRecoveryCodes)
+				r.Delete("/user/mfa", mfaHandler.disable)
+			})
+
+			r.Get("/user/identities", oidcHandler.listIdentities)
+		})
+
+		// Managing other users requires the admin role and MFA
+		r.Route("/admin", func(r chi.Router) {
+			r.Use(middlewares.Auth)
+			r.Use(middlewares.CSRF)
+			r.Use(middlewares.RateLimit("admin", ratelimit.Limit{Requests: 100, Window: time.Minute}, middlewares.byUser))
+			r.Use(middlewares.RequireRole(services.RoleAdmin))
+			r.Use(middlewares.RequireMFA)
+			r.Use(middlewares.Idempotency)
+
+			r.Get("/users", adminHandler.listUsers)
+			r.Get("/users/{id}", adminHandler.getUser)
+			r.Get("/users/{id}/auth-events", adminHandler.listAuthEvents)
+			r.Delete("/users/{id}", adminHandler.deleteUser)
+			r.Put("/users/{id}/roles/{role}", adminHandler.assignRole)
+			r.Delete("/users/{id}/roles/{role}", adminHandler.removeRole)
 		})
 	})
 
 	return r
 }
+
+// NewAdminRouter creates the router for the admin listener.
+// It is served on a separate port that should not be exposed publicly.
+func NewAdminRouter(metricsHandler http.Handler) *chi.Mux {
+	r := chi.NewRouter()
+	r.Method(http.MethodGet, "/metrics", metricsHandler)
+	return r
+}
@@ -9,6 +9,8 @@ import (
 	"os/signal"
 	"syscall"
 	"time"
+
+	"example.com/rest/internal/health"
 )
 
 const (
@@ -21,12 +23,16 @@ const (
 // server represents an HTTP server.
 type Server struct {
 	*http.Server
-	logger *slog.Logger
+	health        *health.Registry
+	shutdownDelay time.Duration
+	logger        *slog.Logger
 }
 
 // NewServer creates a new HTTP server. It takes in an address in the format "host:port",
-// a router, and a logger.
-func NewServer(addr string, router http.Handler, logger *slog.Logger) *Server {
+// a router, the health registry, the shutdown delay and a logger.
+// The shutdown delay is how long the server keeps serving after readiness starts failing,
+// so load balancers have time to stop sending traffic.
+func NewServer(addr string, router http.Handler, health *health.Registry, shutdownDelay time.Duration, logger *slog.Logger) *Server {
 	return &Server{
 		Server: &http.Server{
 			Addr:         addr,
@@ -35,7 +41,21 @@ func NewServer(addr string, router http.Handler, logger *slog.Logger) *Server {
 			ReadTimeout:  defaultReadTimeout,
 			WriteTimeout: defaultWriteTimeout,
 		},
-		logger: logger,
+		health:        health,
+		shutdownDelay: shutdownDelay,
+		logger:        logger,
+	}
+}
+
+// NewAdminServer creates the HTTP server of the admin listener. Unlike Server, it doesn't handle signals
+// or readiness, the caller shuts it down after the API server stopped, so metrics are served while traffic drains.
+func NewAdminServer(addr string, router http.Handler) *http.Server {
+	return &http.Server{
+		Addr:         addr,
+		Handler:      router,
+		IdleTimeout:  defaultIdleTimeout,
+		ReadTimeout:  defaultReadTimeout,
+		WriteTimeout: defaultWriteTimeout,
 	}
 }
 
@@ -49,6 +69,13 @@ func (s *Server) Start() error {
 		signal.Notify(sigint, os.Interrupt, syscall.SIGTERM)
 		<-sigint
 
+		// fail readiness first and give load balancers time to drain traffic
+		s.health.Shutdown()
+		if s.shutdownDelay > 0 {
+			s.logger.Info("draining traffic before shutdown", "delay", s.shutdownDelay.String())
+			time.Sleep(s.shutdownDelay)
+		}
+
 		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
 		defer cancel()
 
@@ -0,0 +1,233 @@
+package http
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"example.com/rest/internal/domain"
+	"example.com/rest/internal/services"
+	"github.com/go-chi/chi/v5"
+)
+
+// AuthMode selects how users authenticate, API keys are accepted in both modes.
+type AuthMode string
+
+const (
+	AuthModeJWT     AuthMode = "jwt"     // bearer access tokens and refresh tokens, for mobile apps and other APIs
+	AuthModeSession AuthMode = "session" // server-side sessions in a cookie, for browser apps
+)
+
+const (
+	sessionCookieName = "session"
+	csrfCookieName    = "csrf_token"
+	csrfHeader        = "X-CSRF-Token"
+)
+
+// SessionCookie configures the cookies set on login.
+type SessionCookie struct {
+	Secure   bool          // only send the cookies over HTTPS, disable it for local development over HTTP only
+	SameSite http.SameSite // lax still sends the cookie on top-level navigation from other sites, strict never does
+	MaxAge   time.Duration // the absolute timeout of sessions
+}
+
+// SessionHandler serves login, logout and session management in the session auth mode.
+type SessionHandler struct {
+	*baseHandler
+	userService         *services.UserService
+	sessionService      *services.SessionService
+	mfaService          *services.MFAService
+	oidcService         *services.OIDCService
+	cookie              SessionCookie
+	trustedProxyHeaders []string
+}
+
+func NewSessionHandler(baseHandler *baseHandler, userService *services.UserService, sessionService *services.SessionService, mfaService *services.MFAService, oidcService *services.OIDCService, cookie SessionCookie, trustedProxyHeaders []string) *SessionHandler {
+	return &SessionHandler{
+		baseHandler:         baseHandler,
+		userService:         userService,
+		sessionService:      sessionService,
+		mfaService:          mfaService,
+		oidcService:         oidcService,
+		cookie:              cookie,
+		trustedProxyHeaders: trustedProxyHeaders,
+	}
+}
+
+// login starts a session and sets the session and CSRF cookies.
+// The CSRF token is also returned in the body, clients send it in the X-CSRF-Token header of unsafe requests.
+func (h *SessionHandler) login(w http.ResponseWriter, r *http.Request) {
+	var req domain.UserCredentials
+	if err := h.json.Read(r, &req); err != nil {
+		h.json.WriteError(w, r, err)
+		return
+	}
+
+	user, err := h.userService.Authenticate(r.Context(), &req)
+	if err != nil {
+		h.json.WriteError(w, r, err)
+		return
+	}
+
+	h.completeLogin(w, r, user)
+}
+
+// oidcCallback exchanges the code and state the OIDC provider redirected back with for a session.
+func (h *SessionHandler) oidcCallback(w http.ResponseWriter, r *http.Request) {
+	var req domain.OIDCCallbackRequest
+	if err := h.json.Read(r, &req); err != nil {
+		h.json.WriteError(w, r, err)
+		return
+	}
+
+	user, err := h.oidcService.Callback(r.Context(), &req)
+	if err != nil {
+		h.json.WriteError(w, r, err)
+		return
+	}
+
+	h.completeLogin(w, r, user)
+}
+
+// completeLogin starts a session for an authenticated user,
+// with MFA enabled it returns an MFA token instead and the session is started by verifyMFA.
+func (h *SessionHandler) completeLogin(w http.ResponseWriter, r *http.Request, user *domain.User) {
+	mfaToken, err := h.mfaService.Challenge(r.Context(), user.ID)
+	if err != nil {
+		h.json.WriteError(w, r, err)
+		return
+	}
+	if mfaToken != "" {
+		w.Header().Set("Cache-Control", "no-store")
+		h.json.Write(w, http.StatusOK, map[string]any{"mfa_required": true, "mfa_token": mfaToken})
+		return
+	}
+
+	h.startSession(w, r, user)
+}
+
+// verifyMFA exchanges the MFA token of login and a code for a session.
+func (h *SessionHandler) verifyMFA(w http.ResponseWriter, r *http.Request) {
+	var req domain.MFAVerifyRequest
+	if err := h.json.Read(r, &req); err != nil {
+		h.json.WriteError(w, r, err)
+		return
+	}
+
+	user, err := h.mfaService.Verify(r.Context(), &req)
+	if err != nil {
+		h.json.WriteError(w, r, err)
+		return
+	}
+
+	h.startSession(w, r, user)
+}
+
+// startSession creates a session for the user and sets the cookies.
+func (h *SessionHandler) startSession(w http.ResponseWriter, r *http.Request, user *domain.User) {
+	_, token, err := h.sessionService.Create(r.Context(), user.ID, r.UserAgent(), clientIP(r, h.trustedProxyHeaders))
+	if err != nil {
+		h.json.WriteError(w, r, err)
+		return
+	}
+
+	csrfToken := services.CSRFToken(token)
+	h.setCookies(w, token, csrfToken, int(h.cookie.MaxAge.Seconds()))
+	h.json.Write(w, http.StatusOK, map[string]any{"user": user, "csrf_token": csrfToken})
+}
+
+// logout ends the current session and clears the cookies.
+func (h *SessionHandler) logout(w http.ResponseWriter, r *http.Request) {
+	principal, err := h.getPrincipal(r)
+	if err != nil {
+		h.json.WriteError(w, r, err)
+		return
+	}
+
+	if principal.SessionID != 0 {
+		if err := h.sessionService.Revoke(r.Context(), principal.UserID, principal.SessionID); err != nil {
+			h.json.WriteError(w, r, err)
+			return
+		}
+	}
+
+	h.setCookies(w, "", "", -1)
+	h.json.Write(w, http.StatusNoContent, nil)
+}
+
+// logoutAll ends all sessions of the user and clears the cookies.
+func (h *SessionHandler) logoutAll(w http.ResponseWriter, r *http.Request) {
+	userID, err := h.getUserID(r)
+	if err != nil {
+		h.json.WriteError(w, r, err)
+		return
+	}
+
+	if err := h.sessionService.RevokeAll(r.Context(), userID); err != nil {
+		h.json.WriteError(w, r, err)
+		return
+	}
+
+	h.setCookies(w, "", "", -1)
+	h.json.Write(w, http.StatusNoContent, nil)
+}
+
+func (h *SessionHandler) listSessions(w http.ResponseWriter, r *http.Request) {
+	principal, err := h.getPrincipal(r)
+	if err != nil {
+		h.json.WriteError(w, r, err)
+		return
+	}
+
+	sessions, err := h.sessionService.List(r.Context(), principal.UserID, principal.SessionID)
+	if err != nil {
+		h.json.WriteError(w, r, err)
+		return
+	}
+
+	h.json.Write(w, http.StatusOK, map[string]any{"sessions": sessions})
+}
+
+func (h *SessionHandler) revokeSession(w http.ResponseWriter, r *http.Request) {
+	userID, err := h.getUserID(r)
+	if err != nil {
+		h.json.WriteError(w, r, err)
+		return
+	}
+
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		h.json.WriteError(w, r, domain.Errorf(domain.INVALID_ERROR, "invalid session id"))
+		return
+	}
+
+	if err := h.sessionService.Revoke(r.Context(), userID, id); err != nil {
+		h.json.WriteError(w, r, err)
+		return
+	}
+
+	h.json.Write(w, http.StatusNoContent, nil)
+}
+
+// setCookies sets the session and CSRF cookies, a negative maxAge deletes them.
+// Scripts can read the CSRF cookie, e.g. after a page reload, but not the session cookie.
+func (h *SessionHandler) setCookies(w http.ResponseWriter, token, csrfToken string, maxAge int) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     sessionCookieName,
+		Value:    token,
+		Path:     "/",
+		MaxAge:   maxAge,
+		HttpOnly: true,
+		Secure:   h.cookie.Secure,
+		SameSite: h.cookie.SameSite,
+	})
+	http.SetCookie(w, &http.Cookie{
+		Name:     csrfCookieName,
+		Value:    csrfToken,
+		Path:     "/",
+		MaxAge:   maxAge,
+		Secure:   h.cookie.Secure,
+		SameSite: h.cookie.SameSite,
+	})
+	w.Header().Set("Cache-Control", "no-store")
+}
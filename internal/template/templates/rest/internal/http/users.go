@@ -2,22 +2,32 @@ package http
 
 import (
 	"net/http"
+	"strconv"
 
 	"example.com/rest/internal/domain"
 	"example.com/rest/internal/services"
+	"github.com/go-chi/chi/v5"
 )
 
 type UserHandler struct {
 	*baseHandler
-	userService   *services.UserService
-	generateToken func(userID int) (string, error)
+	userService    *services.UserService
+	tokenService   *services.TokenService
+	apiKeyService  *services.APIKeyService
+	accountService *services.AccountService
+	mfaService     *services.MFAService
+	oidcService    *services.OIDCService
 }
 
-func NewUserHandler(baseHandler *baseHandler, userService *services.UserService, generateToken func(int) (string, error)) *UserHandler {
+func NewUserHandler(baseHandler *baseHandler, userService *services.UserService, tokenService *services.TokenService, apiKeyService *services.APIKeyService, accountService *services.AccountService, mfaService *services.MFAService, oidcService *services.OIDCService) *UserHandler {
 	return &UserHandler{
-		baseHandler:   baseHandler,
-		userService:   userService,
-		generateToken: generateToken,
+		baseHandler:    baseHandler,
+		userService:    userService,
+		tokenService:   tokenService,
+		apiKeyService:  apiKeyService,
+		accountService: accountService,
+		mfaService:     mfaService,
+		oidcService:    oidcService,
 	}
 }
 
@@ -34,6 +44,11 @@ func (h *UserHandler) register(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// the user is created either way, they can request another email
+	if err := h.accountService.SendVerification(r.Context(), user); err != nil {
+		h.requestLogger(r).Error("failed to send verification email", "error", err)
+	}
+
 	h.json.Write(w, http.StatusCreated, map[string]any{"user": user})
 }
 
@@ -50,12 +65,123 @@ func (h *UserHandler) login(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	token, err := h.generateToken(user.ID)
+	h.completeLogin(w, r, user)
+}
+
+// oidcCallback exchanges the code and state the OIDC provider redirected back with for the tokens.
+func (h *UserHandler) oidcCallback(w http.ResponseWriter, r *http.Request) {
+	var req domain.OIDCCallbackRequest
+	if err := h.json.Read(r, &req); err != nil {
+		h.json.WriteError(w, r, err)
+		return
+	}
+
+	user, err := h.oidcService.Callback(r.Context(), &req)
 	if err != nil {
 		h.json.WriteError(w, r, err)
 		return
 	}
-	h.json.Write(w, http.StatusOK, map[string]any{"token": token, "user": user})
+
+	h.completeLogin(w, r, user)
+}
+
+// completeLogin issues the tokens of an authenticated user,
+// with MFA enabled it returns an MFA token instead and the tokens are issued by verifyMFA.
+func (h *UserHandler) completeLogin(w http.ResponseWriter, r *http.Request, user *domain.User) {
+	mfaToken, err := h.mfaService.Challenge(r.Context(), user.ID)
+	if err != nil {
+		h.json.WriteError(w, r, err)
+		return
+	}
+	if mfaToken != "" {
+		w.Header().Set("Cache-Control", "no-store")
+		h.json.Write(w, http.StatusOK, map[string]any{"mfa_required": true, "mfa_token": mfaToken})
+		return
+	}
+
+	tokens, err := h.tokenService.Issue(r.Context(), user.ID)
+	if err != nil {
+		h.json.WriteError(w, r, err)
+		return
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	h.json.Write(w, http.StatusOK, map[string]any{"token": tokens.AccessToken, "refresh_token": tokens.RefreshToken, "user": user})
+}
+
+// verifyMFA exchanges the MFA token of login and a code for the tokens.
+func (h *UserHandler) verifyMFA(w http.ResponseWriter, r *http.Request) {
+	var req domain.MFAVerifyRequest
+	if err := h.json.Read(r, &req); err != nil {
+		h.json.WriteError(w, r, err)
+		return
+	}
+
+	user, err := h.mfaService.Verify(r.Context(), &req)
+	if err != nil {
+		h.json.WriteError(w, r, err)
+		return
+	}
+
+	tokens, err := h.tokenService.Issue(r.Context(), user.ID)
+	if err != nil {
+		h.json.WriteError(w, r, err)
+		return
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	h.json.Write(w, http.StatusOK, map[string]any{"token": tokens.AccessToken, "refresh_token": tokens.RefreshToken, "user": user})
+}
+
+func (h *UserHandler) refreshToken(w http.ResponseWriter, r *http.Request) {
+	var req domain.RefreshRequest
+	if err := h.json.Read(r, &req); err != nil {
+		h.json.WriteError(w, r, err)
+		return
+	}
+
+	tokens, err := h.tokenService.Refresh(r.Context(), &req)
+	if err != nil {
+		h.json.WriteError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	h.json.Write(w, http.StatusOK, tokens)
+}
+
+func (h *UserHandler) logout(w http.ResponseWriter, r *http.Request) {
+	userID, err := h.getUserID(r)
+	if err != nil {
+		h.json.WriteError(w, r, err)
+		return
+	}
+
+	var req domain.RefreshRequest
+	if err := h.json.Read(r, &req); err != nil {
+		h.json.WriteError(w, r, err)
+		return
+	}
+
+	if err := h.tokenService.Logout(r.Context(), userID, &req); err != nil {
+		h.json.WriteError(w, r, err)
+		return
+	}
+
+	h.json.Write(w, http.StatusNoContent, nil)
+}
+
+func (h *UserHandler) logoutAll(w http.ResponseWriter, r *http.Request) {
+	userID, err := h.getUserID(r)
+	if err != nil {
+		h.json.WriteError(w, r, err)
+		return
+	}
+
+	if err := h.tokenService.LogoutAll(r.Context(), userID); err != nil {
+		h.json.WriteError(w, r, err)
+		return
+	}
+
+	h.json.Write(w, http.StatusNoContent, nil)
 }
 
 func (h *UserHandler) getUser(w http.ResponseWriter, r *http.Request) {
@@ -71,6 +197,12 @@ func (h *UserHandler) getUser(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	writeETag(w, user.Version)
+	if notModified(r, etag(user.Version)) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
 	h.json.Write(w, http.StatusOK, map[string]any{"user": user})
 }
 
@@ -81,18 +213,31 @@ func (h *UserHandler) updateUser(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	versions, err := h.ifMatchVersions(r)
+	if err != nil {
+		h.json.WriteError(w, r, err)
+		return
+	}
+
 	var req domain.UserPatch
 	if err := h.json.Read(r, &req); err != nil {
 		h.json.WriteError(w, r, err)
 		return
 	}
 
-	user, err := h.userService.Update(r.Context(), userID, &req)
+	user, err := h.userService.Update(r.Context(), userID, versions, &req)
 	if err != nil {
 		h.json.WriteError(w, r, err)
 		return
 	}
 
+	if req.Email != nil {
+		if err := h.accountService.SendVerification(r.Context(), user.ID); err != nil {
+			h.requestLogger(r).Error("failed to send verification email", "error", err)
+		}
+	}
+
+	writeETag(w, user.Version)
 	h.json.Write(w, http.StatusOK, map[string]any{"user": user})
 }
 
@@ -103,7 +248,136 @@ func (h *UserHandler) deleteUser(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if err := h.userService.Delete(r.Context(), userID); err != nil {
+	versions, err := h.ifMatchVersions(r)
+	if err != nil {
+		h.json.WriteError(w, r, err)
+		return
+	}
+
+	if err := h.userService.Delete(r.Context(), userID, versions); err != nil {
+		h.json.WriteError(w, r, err)
+		return
+	}
+
+	h.json.Write(w, http.StatusNoContent, nil)
+}
+
+func (h *UserHandler) requestVerification(w http.ResponseWriter, r *http.Request) {
+	userID, err := h.getUserID(r)
+	if err != nil {
+		h.json.WriteError(w, r, err)
+		return
+	}
+
+	if err := h.accountService.SendVerification(r.Context(), userID); err != nil {
+		h.json.WriteError(w, r, err)
+		return
+	}
+
+	h.json.Write(w, http.StatusAccepted, nil)
+}
+
+func (h *UserHandler) verifyEmail(w http.ResponseWriter, r *http.Request) {
+	var req domain.VerifyEmailRequest
+	if err := h.json.Read(r, &req); err != nil {
+		h.json.WriteError(w, r, err)
+		return
+	}
+
+	user, err := h.accountService.VerifyEmail(r.Context(), &req)
+	if err != nil {
+		h.json.WriteError(w, r, err)
+		return
+	}
+
+	h.json.Write(w, http.StatusOK, map[string]any{"user": user})
+}
+
+// forgotPassword always responds with 202, so it doesn't reveal whether an account exists.
+func (h *UserHandler) forgotPassword(w http.ResponseWriter, r *http.Request) {
+	var req domain.ForgotPasswordRequest
+	if err := h.json.Read(r, &req); err != nil {
+		h.json.WriteError(w, r, err)
+		return
+	}
+
+	if err := h.accountService.ForgotPassword(r.Context(), &req); err != nil {
+		h.json.WriteError(w, r, err)
+		return
+	}
+
+	h.json.Write(w, http.StatusAccepted, nil)
+}
+
+func (h *UserHandler) resetPassword(w http.ResponseWriter, r *http.Request) {
+	var req domain.ResetPasswordRequest
+	if err := h.json.Read(r, &req); err != nil {
+		h.json.WriteError(w, r, err)
+		return
+	}
+
+	if err := h.accountService.ResetPassword(r.Context(), &req); err != nil {
+		h.json.WriteError(w, r, err)
+		return
+	}
+
+	h.json.Write(w, http.StatusNoContent, nil)
+}
+
+func (h *UserHandler) listAPIKeys(w http.ResponseWriter, r *http.Request) {
+	userID, err := h.getUserID(r)
+	if err != nil {
+		h.json.WriteError(w, r, err)
+		return
+	}
+
+	keys, err := h.apiKeyService.List(r.Context(), userID)
+	if err != nil {
+		h.json.WriteError(w, r, err)
+		return
+	}
+
+	h.json.Write(w, http.StatusOK, map[string]any{"api_keys": keys})
+}
+
+func (h *UserHandler) createAPIKey(w http.ResponseWriter, r *http.Request) {
+	userID, err := h.getUserID(r)
+	if err != nil {
+		h.json.WriteError(w, r, err)
+		return
+	}
+
+	var req domain.CreateAPIKeyRequest
+	if err := h.json.Read(r, &req); err != nil {
+		h.json.WriteError(w, r, err)
+		return
+	}
+
+	key, rawKey, err := h.apiKeyService.Create(r.Context(), userID, &req)
+	if err != nil {
+		h.json.WriteError(w, r, err)
+		return
+	}
+
+	// the key is only returned once, it can't be retrieved later
+	w.Header().Set("Cache-Control", "no-store")
+	h.json.Write(w, http.StatusCreated, map[string]any{"api_key": key, "key": rawKey})
+}
+
+func (h *UserHandler) revokeAPIKey(w http.ResponseWriter, r *http.Request) {
+	userID, err := h.getUserID(r)
+	if err != nil {
+		h.json.WriteError(w, r, err)
+		return
+	}
+
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		h.json.WriteError(w, r, domain.Errorf(domain.INVALID_ERROR, "invalid api key id"))
+		return
+	}
+
+	if err := h.apiKeyService.Revoke(r.Context(), userID, id); err != nil {
 		h.json.WriteError(w, r, err)
 		return
 	}
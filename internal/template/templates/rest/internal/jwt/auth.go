@@ -1,40 +1,69 @@
 package jwt
 
 import (
+	"strconv"
+	"strings"
 	"time"
 
 	"example.com/rest/internal/domain"
 	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
 )
 
 type AuthService struct {
-	secret   string
+	keys     *KeySet
 	duration time.Duration
+	issuer   string
+	audience string
 }
 
-func NewAuthService(secret string, duration time.Duration) *AuthService {
+// NewAuthService creates a new auth service that signs and verifies tokens with the key set.
+// If issuer or audience are set, they are added to new tokens (iss and aud claims) and required when validating,
+// so tokens of another environment or service are rejected.
+func NewAuthService(keys *KeySet, duration time.Duration, issuer, audience string) *AuthService {
 	return &AuthService{
-		secret:   secret,
+		keys:     keys,
 		duration: duration,
+		issuer:   issuer,
+		audience: audience,
 	}
 }
 
 type customClaims struct {
-	UserID int `json:"user_id"`
+	UserID      int      `json:"user_id"`
+	Roles       []string `json:"roles,omitempty"`
+	Permissions []string `json:"permissions,omitempty"`
+	Scope       string   `json:"scope,omitempty"` // space separated scopes (RFC 8693)
 	jwt.RegisteredClaims
 }
 
-func (s *AuthService) GenerateToken(userID int) (string, error) {
+// GenerateToken creates an access token for the principal.
+// The token carries the user ID, roles, permissions and scopes of the principal and gets a unique ID (jti claim).
+func (s *AuthService) GenerateToken(principal *domain.Principal) (string, error) {
+	now := time.Now()
 	claims := customClaims{
-		UserID: userID,
+		UserID:      principal.UserID,
+		Roles:       principal.Roles,
+		Permissions: principal.Permissions,
+		Scope:       strings.Join(principal.Scopes, " "),
 		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(time.Now().Add(s.duration)),
-			IssuedAt:  jwt.NewNumericDate(time.Now()),
+			ID:        uuid.New().String(),
+			Subject:   strconv.Itoa(principal.UserID),
+			Issuer:    s.issuer,
+			ExpiresAt: jwt.NewNumericDate(now.Add(s.duration)),
+			IssuedAt:  jwt.NewNumericDate(now),
 		},
 	}
+	if s.audience != "" {
+		claims.Audience = jwt.ClaimStrings{s.audience}
+	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	tokenString, err := token.SignedString([]byte(s.secret))
+	key := s.keys.signing
+	token := jwt.NewWithClaims(key.Method, claims)
+	if key.ID != "" {
+		token.Header["kid"] = key.ID
+	}
+	tokenString, err := token.SignedString(key.private)
 	if err != nil {
 		return "", domain.Errorf(domain.INTERNAL_ERROR, "failed to generate token").Wrap(err)
 	}
@@ -42,25 +71,46 @@ func (s *AuthService) GenerateToken(userID int) (string, error) {
 	return tokenString, nil
 }
 
-func (s *AuthService) ValidateToken(tokenString string) (int, error) {
+// ValidateToken verifies the token and returns the principal it was issued for.
+// It returns an unauthorized error if the token is invalid, expired or issued for another issuer or audience.
+func (s *AuthService) ValidateToken(tokenString string) (*domain.Principal, error) {
+	options := []jwt.ParserOption{jwt.WithExpirationRequired()}
+	if s.issuer != "" {
+		options = append(options, jwt.WithIssuer(s.issuer))
+	}
+	if s.audience != "" {
+		options = append(options, jwt.WithAudience(s.audience))
+	}
+
 	// parse the token
 	token, err := jwt.ParseWithClaims(tokenString, &customClaims{}, func(token *jwt.Token) (interface{}, error) {
 		// This function mainly needs to return the key for validating the token.
-		// We verify the signing method to prevent attacks with other signing methods.
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+		// The key is picked by the kid header, and the signing method must be the one of the key
+		// to prevent attacks with other signing methods (e.g. an RSA public key used as HMAC secret).
+		kid, _ := token.Header["kid"].(string)
+		key, ok := s.keys.key(kid)
+		if !ok || token.Method.Alg() != key.Method.Alg() {
 			return nil, domain.Errorf(domain.UNAUTHORIZED_ERROR, "invalid token")
 		}
-		return []byte(s.secret), nil
-	})
+		return key.public, nil
+	}, options...)
 
 	if err != nil {
-		return 0, domain.Errorf(domain.UNAUTHORIZED_ERROR, "invalid token")
+		return nil, domain.Errorf(domain.UNAUTHORIZED_ERROR, "invalid token")
 	}
 
 	// get our custom claims
-	if claims, ok := token.Claims.(*customClaims); ok && token.Valid {
-		return claims.UserID, nil
+	claims, ok := token.Claims.(*customClaims)
+	if !ok || !token.Valid {
+		return nil, domain.Errorf(domain.UNAUTHORIZED_ERROR, "invalid token")
 	}
 
-	return 0, domain.Errorf(domain.UNAUTHORIZED_ERROR, "invalid token")
+	return &domain.Principal{
+		UserID:      claims.UserID,
+		Roles:       claims.Roles,
+		Permissions: claims.Permissions,
+		Scopes:      strings.Fields(claims.Scope),
+		TokenID:     claims.ID,
+		ExpiresAt:   claims.ExpiresAt.Time,
+	}, nil
 }
@@ -0,0 +1,126 @@
+package jwt
+
+import (
+	"crypto/x509"
+	"encoding/pem"
+	"slices"
+	"testing"
+	"time"
+
+	"example.com/rest/internal/domain"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func newTestAuthService(t *testing.T, signing *Key, verification ...*Key) *AuthService {
+	t.Helper()
+	set, err := NewKeySet(signing, verification...)
+	if err != nil {
+		t.Fatalf("NewKeySet: %v", err)
+	}
+	return NewAuthService(set, time.Minute, "issuer", "audience")
+}
+
+func TestGenerateAndValidateToken(t *testing.T) {
+	signing := parseTestKey(t, generateRSAKey(t), false)
+	s := newTestAuthService(t, signing)
+
+	token, err := s.GenerateToken(&domain.Principal{
+		UserID:      1,
+		Roles:       []string{"admin"},
+		Permissions: []string{"users:read"},
+		Scopes:      []string{"users:read", "account:write"},
+	})
+	if err != nil {
+		t.Fatalf("GenerateToken: %v", err)
+	}
+
+	principal, err := s.ValidateToken(token)
+	if err != nil {
+		t.Fatalf("ValidateToken: %v", err)
+	}
+	if principal.UserID != 1 || !principal.HasRole("admin") || !slices.Equal(principal.Scopes, []string{"users:read", "account:write"}) {
+		t.Errorf("principal = %+v", principal)
+	}
+	if principal.TokenID == "" {
+		t.Error("token has no jti")
+	}
+
+	// a service with only the public key verifies the token too
+	verifier := newTestAuthService(t, parseTestKey(t, generateECKey(t), false), parseTestKey(t, signing.private, true))
+	if _, err := verifier.ValidateToken(token); err != nil {
+		t.Errorf("ValidateToken with the public key: %v", err)
+	}
+}
+
+func TestValidateTokenRejects(t *testing.T) {
+	signing := parseTestKey(t, generateRSAKey(t), false)
+	s := newTestAuthService(t, signing)
+
+	claims := func() customClaims {
+		return customClaims{
+			UserID: 1,
+			RegisteredClaims: jwt.RegisteredClaims{
+				Issuer:    "issuer",
+				Audience:  jwt.ClaimStrings{"audience"},
+				ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Minute)),
+			},
+		}
+	}
+	sign := func(t *testing.T, method jwt.SigningMethod, kid string, c customClaims, key any) string {
+		t.Helper()
+		token := jwt.NewWithClaims(method, c)
+		if kid != "" {
+			token.Header["kid"] = kid
+		}
+		signed, err := token.SignedString(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return signed
+	}
+
+	// the public key as published, attackers use it as HMAC secret
+	der, err := x509.MarshalPKIXPublicKey(signing.public)
+	if err != nil {
+		t.Fatal(err)
+	}
+	publicPEM := pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})
+
+	expired := claims()
+	expired.ExpiresAt = jwt.NewNumericDate(time.Now().Add(-time.Minute))
+	noExpiry := claims()
+	noExpiry.ExpiresAt = nil
+	otherAudience := claims()
+	otherAudience.Audience = jwt.ClaimStrings{"other"}
+	otherIssuer := claims()
+	otherIssuer.Issuer = "other"
+
+	tests := []struct {
+		name  string
+		token string
+	}{
+		{"HS256 with the public key and kid", sign(t, jwt.SigningMethodHS256, signing.ID, claims(), publicPEM)},
+		{"HS256 with the public key without kid", sign(t, jwt.SigningMethodHS256, "", claims(), publicPEM)},
+		{"HS256 with the DER public key", sign(t, jwt.SigningMethodHS256, signing.ID, claims(), der)},
+		{"none", sign(t, jwt.SigningMethodNone, signing.ID, claims(), jwt.UnsafeAllowNoneSignatureType)},
+		{"unknown kid", sign(t, jwt.SigningMethodRS256, "unknown", claims(), signing.private)},
+		{"other key", sign(t, jwt.SigningMethodRS256, signing.ID, claims(), generateRSAKey(t))},
+		{"expired", sign(t, jwt.SigningMethodRS256, signing.ID, expired, signing.private)},
+		{"no expiry", sign(t, jwt.SigningMethodRS256, signing.ID, noExpiry, signing.private)},
+		{"other audience", sign(t, jwt.SigningMethodRS256, signing.ID, otherAudience, signing.private)},
+		{"other issuer", sign(t, jwt.SigningMethodRS256, signing.ID, otherIssuer, signing.private)},
+		{"malformed", "not.a.token"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := s.ValidateToken(tt.token); err == nil {
+				t.Error("ValidateToken succeeded")
+			}
+		})
+	}
+
+	// the valid token the cases are derived from
+	if _, err := s.ValidateToken(sign(t, jwt.SigningMethodRS256, signing.ID, claims(), signing.private)); err != nil {
+		t.Errorf("ValidateToken of a valid token: %v", err)
+	}
+}
@@ -0,0 +1,260 @@
+package jwt
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"net/http"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// Key is a key used to sign or verify tokens.
+// Asymmetric keys are identified by their RFC 7638 thumbprint, which is sent in the kid header of tokens.
+type Key struct {
+	ID      string
+	Method  jwt.SigningMethod
+	private crypto.PrivateKey // signing key, nil for verification-only keys
+	public  crypto.PublicKey  // verification key, the secret for HMAC keys
+}
+
+// NewHMACKey returns an HS256 key for the shared secret.
+// Every service that verifies tokens signed with it can also sign tokens, prefer asymmetric keys.
+func NewHMACKey(secret string) *Key {
+	return &Key{
+		Method:  jwt.SigningMethodHS256,
+		private: []byte(secret),
+		public:  []byte(secret),
+	}
+}
+
+// LoadKeyFile loads a key from a PEM file.
+// Private keys (PKCS #8, PKCS #1 RSA or SEC 1 EC) can sign and verify tokens, public keys (PKIX) can only verify.
+// The algorithm follows from the key type: RS256 for RSA, ES256 for ECDSA P-256 and EdDSA for Ed25519.
+func LoadKeyFile(path string) (*Key, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read key file: %w", err)
+	}
+	key, err := ParseKeyPEM(data)
+	if err != nil {
+		return nil, fmt.Errorf("invalid key file %s: %w", path, err)
+	}
+	return key, nil
+}
+
+// ParseKeyPEM parses a PEM encoded private or public key, see LoadKeyFile.
+func ParseKeyPEM(data []byte) (*Key, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("no PEM block found")
+	}
+
+	var parsed any
+	var err error
+	switch block.Type {
+	case "PRIVATE KEY":
+		parsed, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	case "RSA PRIVATE KEY":
+		parsed, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "EC PRIVATE KEY":
+		parsed, err = x509.ParseECPrivateKey(block.Bytes)
+	case "PUBLIC KEY":
+		parsed, err = x509.ParsePKIXPublicKey(block.Bytes)
+	default:
+		return nil, fmt.Errorf("unsupported PEM block type %q", block.Type)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	key := &Key{}
+	switch k := parsed.(type) {
+	case *rsa.PrivateKey:
+		key.private, key.public = k, &k.PublicKey
+	case *ecdsa.PrivateKey:
+		key.private, key.public = k, &k.PublicKey
+	case ed25519.PrivateKey:
+		key.private, key.public = k, k.Public()
+	case *rsa.PublicKey, *ecdsa.PublicKey, ed25519.PublicKey:
+		key.public = k
+	default:
+		return nil, fmt.Errorf("unsupported key type %T", parsed)
+	}
+
+	switch k := key.public.(type) {
+	case *rsa.PublicKey:
+		if k.N.BitLen() < 2048 {
+			return nil, fmt.Errorf("RSA keys must have at least 2048 bits")
+		}
+		key.Method = jwt.SigningMethodRS256
+	case *ecdsa.PublicKey:
+		if k.Curve != elliptic.P256() {
+			return nil, fmt.Errorf("ECDSA keys must use the P-256 curve")
+		}
+		key.Method = jwt.SigningMethodES256
+	case ed25519.PublicKey:
+		key.Method = jwt.SigningMethodEdDSA
+	}
+
+	key.ID, err = thumbprint(key.jwk())
+	if err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+// CanSign reports whether the key holds a private key or secret.
+func (k *Key) CanSign() bool {
+	return k.private != nil
+}
+
+// asymmetric reports whether the key is a public/private key pair, only those are published.
+func (k *Key) asymmetric() bool {
+	_, isSecret := k.public.([]byte)
+	return !isSecret
+}
+
+// jwk is a JSON Web Key (RFC 7517) holding a public key.
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid,omitempty"`
+	Use string `json:"use,omitempty"`
+	Alg string `json:"alg,omitempty"`
+	N   string `json:"n,omitempty"`   // RSA modulus
+	E   string `json:"e,omitempty"`   // RSA exponent
+	Crv string `json:"crv,omitempty"` // curve of EC and OKP keys
+	X   string `json:"x,omitempty"`   // EC x coordinate or OKP public key
+	Y   string `json:"y,omitempty"`   // EC y coordinate
+}
+
+// jwk returns the public key of an asymmetric key as a JSON Web Key.
+func (k *Key) jwk() jwk {
+	encode := base64.RawURLEncoding.EncodeToString
+	key := jwk{Kid: k.ID, Use: "sig", Alg: k.Method.Alg()}
+	switch public := k.public.(type) {
+	case *rsa.PublicKey:
+		key.Kty = "RSA"
+		key.N = encode(public.N.Bytes())
+		key.E = encode(big.NewInt(int64(public.E)).Bytes())
+	case *ecdsa.PublicKey:
+		// the uncompressed point is 0x04 followed by the x and y coordinates
+		point, _ := public.ECDH()
+		bytes := point.Bytes()[1:]
+		key.Kty = "EC"
+		key.Crv = "P-256"
+		key.X = encode(bytes[:len(bytes)/2])
+		key.Y = encode(bytes[len(bytes)/2:])
+	case ed25519.PublicKey:
+		key.Kty = "OKP"
+		key.Crv = "Ed25519"
+		key.X = encode(public)
+	}
+	return key
+}
+
+// thumbprint returns the RFC 7638 thumbprint of the key, the hash of its required members in lexicographic order.
+func thumbprint(key jwk) (string, error) {
+	var members any
+	switch key.Kty {
+	case "RSA":
+		members = struct {
+			E   string `json:"e"`
+			Kty string `json:"kty"`
+			N   string `json:"n"`
+		}{key.E, key.Kty, key.N}
+	case "EC":
+		members = struct {
+			Crv string `json:"crv"`
+			Kty string `json:"kty"`
+			X   string `json:"x"`
+			Y   string `json:"y"`
+		}{key.Crv, key.Kty, key.X, key.Y}
+	case "OKP":
+		members = struct {
+			Crv string `json:"crv"`
+			Kty string `json:"kty"`
+			X   string `json:"x"`
+		}{key.Crv, key.Kty, key.X}
+	default:
+		return "", fmt.Errorf("unsupported key type %q", key.Kty)
+	}
+
+	data, err := json.Marshal(members)
+	if err != nil {
+		return "", err
+	}
+	hash := sha256.Sum256(data)
+	return base64.RawURLEncoding.EncodeToString(hash[:]), nil
+}
+
+// KeySet holds the key that signs new tokens and the keys that are accepted when verifying tokens.
+// To rotate keys, sign with the new key and keep the old key for verification
+// until all tokens signed with it have expired.
+type KeySet struct {
+	signing *Key
+	keys    map[string]*Key
+}
+
+// NewKeySet creates a key set that signs with the signing key and verifies with it and the other keys.
+func NewKeySet(signing *Key, verification ...*Key) (*KeySet, error) {
+	if !signing.CanSign() {
+		return nil, fmt.Errorf("the signing key must be a private key")
+	}
+
+	set := &KeySet{signing: signing, keys: map[string]*Key{signing.ID: signing}}
+	for _, key := range verification {
+		if _, ok := set.keys[key.ID]; ok {
+			continue
+		}
+		if !key.asymmetric() {
+			return nil, fmt.Errorf("verification keys must be asymmetric")
+		}
+		set.keys[key.ID] = key
+	}
+	return set, nil
+}
+
+// key returns the key for the kid header of a token.
+// Tokens without a kid are verified with the signing key, this covers HMAC keys and tokens issued before keys had IDs.
+func (s *KeySet) key(kid string) (*Key, bool) {
+	if kid == "" {
+		return s.signing, true
+	}
+	key, ok := s.keys[kid]
+	return key, ok
+}
+
+// Handler returns an HTTP handler serving the public keys as a JSON Web Key Set.
+// Other services can use it to verify tokens without being able to sign them.
+// HMAC keys are never published.
+func (s *KeySet) Handler() http.Handler {
+	set := struct {
+		Keys []jwk `json:"keys"`
+	}{Keys: []jwk{}}
+	for _, key := range s.keys {
+		if key.asymmetric() {
+			set.Keys = append(set.Keys, key.jwk())
+		}
+	}
+	slices.SortFunc(set.Keys, func(a, b jwk) int { return strings.Compare(a.Kid, b.Kid) })
+	body, _ := json.Marshal(set)
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/jwk-set+json")
+		w.Header().Set("Cache-Control", "public, max-age=300")
+		w.Write(body)
+	})
+}
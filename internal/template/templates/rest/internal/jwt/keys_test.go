@@ -0,0 +1,187 @@
+package jwt
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"testing"
+)
+
+// parseTestKey returns the key for the PKCS #8 encoding of the private key, or the PKIX encoding with public.
+func parseTestKey(t *testing.T, private any, public bool) *Key {
+	t.Helper()
+
+	var block *pem.Block
+	if public {
+		der, err := x509.MarshalPKIXPublicKey(private.(crypto.Signer).Public())
+		if err != nil {
+			t.Fatal(err)
+		}
+		block = &pem.Block{Type: "PUBLIC KEY", Bytes: der}
+	} else {
+		der, err := x509.MarshalPKCS8PrivateKey(private)
+		if err != nil {
+			t.Fatal(err)
+		}
+		block = &pem.Block{Type: "PRIVATE KEY", Bytes: der}
+	}
+
+	key, err := ParseKeyPEM(pem.EncodeToMemory(block))
+	if err != nil {
+		t.Fatalf("ParseKeyPEM: %v", err)
+	}
+	return key
+}
+
+func generateRSAKey(t *testing.T) *rsa.PrivateKey {
+	t.Helper()
+	private, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return private
+}
+
+func generateECKey(t *testing.T) *ecdsa.PrivateKey {
+	t.Helper()
+	private, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return private
+}
+
+func TestThumbprint(t *testing.T) {
+	tests := []struct {
+		name string
+		key  jwk
+		want string
+	}{
+		{
+			// RFC 7638, section 3.1
+			name: "RSA",
+			key: jwk{
+				Kty: "RSA",
+				N:   "0vx7agoebGcQSuuPiLJXZptN9nndrQmbXEps2aiAFbWhM78LhWx4cbbfAAtVT86zwu1RK7aPFFxuhDR1L6tSoc_BJECPebWKRXjBZCiFV4n3oknjhMstn64tZ_2W-5JsGY4Hc5n9yBXArwl93lqt7_RN5w6Cf0h4QyQ5v-65YGjQR0_FDW2QvzqY368QQMicAtaSqzs8KJZgnYb9c7d0zgdAZHzu6qMQvRL5hajrn1n91CbOpbISD08qNLyrdkt-bFTWhAI4vMQFh6WeZu0fM4lFd2NcRwr3XPksINHaQ-G_xBniIqbw0Ls1jF44-csFCur-kEgU8awapJzKnqDKgw",
+				E:   "AQAB",
+				Alg: "RS256", // members other than the required ones are ignored
+				Kid: "2011-04-29",
+			},
+			want: "NzbLsXh8uDCcd-6MNwXF4W_7noWXFZAfHkxZsRGC9Xs",
+		},
+		{
+			// RFC 8037, appendix A.3
+			name: "OKP",
+			key: jwk{
+				Kty: "OKP",
+				Crv: "Ed25519",
+				X:   "11qYAYKxCrfVS_7TyWQHOg7hcvPapiMlrwIaaPcHURo",
+			},
+			want: "kPrK_qmxVWaYVA9wwBF6Iuo3vVzz7TxHCTwXBygrS4k",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := thumbprint(tt.key)
+			if err != nil {
+				t.Fatalf("thumbprint: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("thumbprint = %s, want %s", got, tt.want)
+			}
+		})
+	}
+
+	if _, err := thumbprint(jwk{Kty: "oct"}); err == nil {
+		t.Error("thumbprint of an oct key succeeded")
+	}
+}
+
+func TestParseKeyPEMKeyID(t *testing.T) {
+	_, ed, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		private any
+		alg     string
+	}{
+		{"RSA", generateRSAKey(t), "RS256"},
+		{"ECDSA", generateECKey(t), "ES256"},
+		{"Ed25519", ed, "EdDSA"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			private := parseTestKey(t, tt.private, false)
+			public := parseTestKey(t, tt.private, true)
+
+			if private.Method.Alg() != tt.alg {
+				t.Errorf("alg = %s, want %s", private.Method.Alg(), tt.alg)
+			}
+			if !private.CanSign() || public.CanSign() {
+				t.Errorf("CanSign = %v, %v, want true for the private and false for the public key", private.CanSign(), public.CanSign())
+			}
+			// the kid is derived from the public key, so both halves of a pair have the same one
+			if private.ID == "" || private.ID != public.ID {
+				t.Errorf("kid = %q and %q, want the same thumbprint", private.ID, public.ID)
+			}
+		})
+	}
+}
+
+func TestKeySetKey(t *testing.T) {
+	signing := parseTestKey(t, generateRSAKey(t), false)
+	old := parseTestKey(t, generateECKey(t), true)
+
+	set, err := NewKeySet(signing, old)
+	if err != nil {
+		t.Fatalf("NewKeySet: %v", err)
+	}
+
+	tests := []struct {
+		name string
+		kid  string
+		want *Key
+	}{
+		{"empty kid", "", signing},
+		{"signing key", signing.ID, signing},
+		{"verification key", old.ID, old},
+		{"unknown kid", "unknown", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			key, ok := set.key(tt.kid)
+			if ok != (tt.want != nil) || key != tt.want {
+				t.Errorf("key(%q) = %v, %v, want %v", tt.kid, key, ok, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewKeySet(t *testing.T) {
+	private := generateRSAKey(t)
+
+	if _, err := NewKeySet(parseTestKey(t, private, true)); err == nil {
+		t.Error("NewKeySet with a public signing key succeeded")
+	}
+	if _, err := NewKeySet(parseTestKey(t, private, false), NewHMACKey("secret")); err == nil {
+		t.Error("NewKeySet with an HMAC verification key succeeded")
+	}
+
+	// an HMAC key has no kid, tokens without one are verified with it
+	hmac := NewHMACKey("secret")
+	set, err := NewKeySet(hmac)
+	if err != nil {
+		t.Fatalf("NewKeySet: %v", err)
+	}
+	if key, ok := set.key(""); !ok || key != hmac {
+		t.Errorf("key(\"\") = %v, %v, want the HMAC key", key, ok)
+	}
+}
@@ -0,0 +1,74 @@
+package logging
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+	"time"
+)
+
+// Config configures the application logger.
+type Config struct {
+	Level          string        // "debug", "info", "warn" or "error"
+	Format         string        // "json" or "text"
+	File           string        // path of the log file, logs are written to stdout if empty
+	FileMaxSize    int64         // size in bytes at which the log file is rotated
+	FileMaxBackups int           // number of rotated files kept
+	SampleInitial  int           // records per message and interval that are always logged, 0 disables sampling
+	SampleEvery    int           // after SampleInitial, only every SampleEvery-th record is logged
+	SampleInterval time.Duration // interval after which the sampling counters are reset
+	RedactKeys     []string      // keys whose values are masked, defaults to DefaultRedactKeys
+}
+
+// DefaultRedactKeys are the keys whose values are masked in log records.
+// Keys match case-insensitively, and keys ending in "_" followed by one of them match too
+// (e.g. "new_password" and "refresh_token").
+var DefaultRedactKeys = []string{"password", "password_hash", "authorization", "token", "secret", "cookie", "api_key"}
+
+// New creates the application logger.
+// Records pass through sampling (debug and info only) and redaction before they are written,
+// so sensitive values are masked no matter where they are logged.
+// It returns the writer the logs go to, so other output like the access log can share it,
+// and a function that closes the log file, it must be called on shutdown.
+func New(cfg Config) (*slog.Logger, io.Writer, func() error, error) {
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(cfg.Level)); err != nil {
+		return nil, nil, nil, fmt.Errorf("invalid log level %q", cfg.Level)
+	}
+
+	var out io.Writer = os.Stdout
+	closeFn := func() error { return nil }
+	if cfg.File != "" {
+		file, err := OpenRotatingFile(cfg.File, cfg.FileMaxSize, cfg.FileMaxBackups)
+		if err != nil {
+			return nil, nil, nil, fmt.Errorf("failed to open log file: %w", err)
+		}
+		out = file
+		closeFn = file.Close
+	}
+
+	options := &slog.HandlerOptions{Level: level}
+	var handler slog.Handler
+	switch strings.ToLower(cfg.Format) {
+	case "json":
+		handler = slog.NewJSONHandler(out, options)
+	case "text":
+		handler = slog.NewTextHandler(out, options)
+	default:
+		return nil, nil, nil, fmt.Errorf("unknown log format %q", cfg.Format)
+	}
+
+	redactKeys := cfg.RedactKeys
+	if redactKeys == nil {
+		redactKeys = DefaultRedactKeys
+	}
+	handler = NewRedactingHandler(handler, redactKeys)
+
+	if cfg.SampleInitial > 0 {
+		handler = NewSamplingHandler(handler, cfg.SampleInitial, cfg.SampleEvery, cfg.SampleInterval)
+	}
+
+	return slog.New(handler), out, closeFn, nil
+}
@@ -0,0 +1,176 @@
+package logging
+
+import (
+	"context"
+	"encoding"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"reflect"
+	"strings"
+)
+
+// redacted replaces the values of sensitive keys.
+const redacted = "[REDACTED]"
+
+// RedactingHandler is a slog.Handler that masks the values of sensitive keys before passing records on.
+// Keys are matched at any depth: in groups, in maps and in structs (by their JSON field names).
+//
+// Attributes added with WithAttrs whose value is a slog.LogValuer are resolved when a record is written
+// instead of when they are added, as the slog handlers do. This lets request loggers carry values
+// that are only known later, like the route pattern.
+type RedactingHandler struct {
+	next slog.Handler
+	keys map[string]bool
+	lazy []slog.Attr // LogValuer attributes resolved on Handle
+}
+
+// NewRedactingHandler returns a handler that masks the values of keys before passing records to next.
+func NewRedactingHandler(next slog.Handler, keys []string) *RedactingHandler {
+	h := &RedactingHandler{next: next, keys: make(map[string]bool, len(keys))}
+	for _, key := range keys {
+		h.keys[normalizeKey(key)] = true
+	}
+	return h
+}
+
+// Enabled implements the slog.Handler interface.
+func (h *RedactingHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return h.next.Enabled(ctx, level)
+}
+
+// Handle implements the slog.Handler interface.
+func (h *RedactingHandler) Handle(ctx context.Context, r slog.Record) error {
+	record := slog.NewRecord(r.Time, r.Level, r.Message, r.PC)
+	for _, attr := range h.lazy {
+		record.AddAttrs(h.redactAttr(slog.Attr{Key: attr.Key, Value: attr.Value.Resolve()}))
+	}
+	r.Attrs(func(attr slog.Attr) bool {
+		record.AddAttrs(h.redactAttr(attr))
+		return true
+	})
+	return h.next.Handle(ctx, record)
+}
+
+// WithAttrs implements the slog.Handler interface.
+func (h *RedactingHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	lazy := h.lazy[:len(h.lazy):len(h.lazy)] // appending must not modify the parent's slice
+	redactedAttrs := make([]slog.Attr, 0, len(attrs))
+	for _, attr := range attrs {
+		if attr.Value.Kind() == slog.KindLogValuer && !h.sensitive(attr.Key) {
+			lazy = append(lazy, attr)
+			continue
+		}
+		redactedAttrs = append(redactedAttrs, h.redactAttr(attr))
+	}
+	return &RedactingHandler{next: h.next.WithAttrs(redactedAttrs), keys: h.keys, lazy: lazy}
+}
+
+// WithGroup implements the slog.Handler interface.
+// Pending LogValuer attributes are resolved, as they belong outside of the group.
+func (h *RedactingHandler) WithGroup(name string) slog.Handler {
+	next := h.next
+	if len(h.lazy) > 0 {
+		resolved := make([]slog.Attr, len(h.lazy))
+		for i, attr := range h.lazy {
+			resolved[i] = h.redactAttr(slog.Attr{Key: attr.Key, Value: attr.Value.Resolve()})
+		}
+		next = next.WithAttrs(resolved)
+	}
+	return &RedactingHandler{next: next.WithGroup(name), keys: h.keys}
+}
+
+// redactAttr masks the attribute if its key is sensitive and otherwise redacts its value.
+func (h *RedactingHandler) redactAttr(attr slog.Attr) slog.Attr {
+	if h.sensitive(attr.Key) {
+		return slog.String(attr.Key, redacted)
+	}
+
+	value := attr.Value.Resolve()
+	switch value.Kind() {
+	case slog.KindGroup:
+		group := value.Group()
+		redactedGroup := make([]slog.Attr, len(group))
+		for i, groupAttr := range group {
+			redactedGroup[i] = h.redactAttr(groupAttr)
+		}
+		return slog.Attr{Key: attr.Key, Value: slog.GroupValue(redactedGroup...)}
+	case slog.KindAny:
+		if v, ok := h.redactAny(value.Any()); ok {
+			return slog.Any(attr.Key, v)
+		}
+	}
+	return slog.Attr{Key: attr.Key, Value: value}
+}
+
+// redactAny redacts structs, maps and slices by converting them to their JSON representation.
+// It returns false if the value is logged as is (errors, stringers, text marshalers and scalars).
+func (h *RedactingHandler) redactAny(v any) (any, bool) {
+	switch v.(type) {
+	case nil, error, fmt.Stringer, encoding.TextMarshaler:
+		return nil, false
+	}
+
+	rv := reflect.ValueOf(v)
+	for rv.Kind() == reflect.Pointer {
+		if rv.IsNil() {
+			return nil, false
+		}
+		rv = rv.Elem()
+	}
+	switch rv.Kind() {
+	case reflect.Struct, reflect.Map, reflect.Slice, reflect.Array:
+	default:
+		return nil, false
+	}
+
+	data, err := json.Marshal(v)
+	if err != nil {
+		// the handler would fail to encode it as well, mask it to be safe
+		return redacted, true
+	}
+	var decoded any
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		return redacted, true
+	}
+	return h.redactJSON(decoded), true
+}
+
+// redactJSON masks sensitive keys in a decoded JSON value.
+func (h *RedactingHandler) redactJSON(v any) any {
+	switch v := v.(type) {
+	case map[string]any:
+		for key, value := range v {
+			if h.sensitive(key) {
+				v[key] = redacted
+				continue
+			}
+			v[key] = h.redactJSON(value)
+		}
+	case []any:
+		for i, value := range v {
+			v[i] = h.redactJSON(value)
+		}
+	}
+	return v
+}
+
+// sensitive reports whether the key is one of the redacted keys or ends in "_" followed by one.
+func (h *RedactingHandler) sensitive(key string) bool {
+	key = normalizeKey(key)
+	if h.keys[key] {
+		return true
+	}
+	for i := strings.IndexByte(key, '_'); i >= 0; i = strings.IndexByte(key, '_') {
+		key = key[i+1:]
+		if h.keys[key] {
+			return true
+		}
+	}
+	return false
+}
+
+// normalizeKey lowercases the key and treats dashes as underscores, so "X-Api-Key" matches "api_key".
+func normalizeKey(key string) string {
+	return strings.ReplaceAll(strings.ToLower(key), "-", "_")
+}
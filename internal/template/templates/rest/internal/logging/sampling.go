@@ -0,0 +1,89 @@
+package logging
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// SamplingHandler is a slog.Handler that limits high-volume debug and info messages.
+// Per interval, the first records of each level and message are logged and after that only every n-th.
+// Warnings and errors are never dropped.
+type SamplingHandler struct {
+	next    slog.Handler
+	sampler *sampler
+}
+
+// sampler holds the counters, it is shared by the handlers derived with WithAttrs and WithGroup.
+type sampler struct {
+	initial  int
+	every    int
+	interval time.Duration
+
+	mu          sync.Mutex
+	windowStart time.Time
+	counts      map[samplingKey]int
+}
+
+// samplingKey identifies the records that are counted together.
+type samplingKey struct {
+	level   slog.Level
+	message string
+}
+
+// NewSamplingHandler returns a handler that passes the first initial records per level and message
+// in every interval to next and after that every every-th record. If every is 0, the rest is dropped.
+func NewSamplingHandler(next slog.Handler, initial, every int, interval time.Duration) *SamplingHandler {
+	return &SamplingHandler{
+		next: next,
+		sampler: &sampler{
+			initial:  initial,
+			every:    every,
+			interval: interval,
+			counts:   make(map[samplingKey]int),
+		},
+	}
+}
+
+// Enabled implements the slog.Handler interface.
+func (h *SamplingHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return h.next.Enabled(ctx, level)
+}
+
+// Handle implements the slog.Handler interface.
+func (h *SamplingHandler) Handle(ctx context.Context, r slog.Record) error {
+	if r.Level < slog.LevelWarn && !h.sampler.sample(r.Time, samplingKey{r.Level, r.Message}) {
+		return nil
+	}
+	return h.next.Handle(ctx, r)
+}
+
+// WithAttrs implements the slog.Handler interface.
+func (h *SamplingHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &SamplingHandler{next: h.next.WithAttrs(attrs), sampler: h.sampler}
+}
+
+// WithGroup implements the slog.Handler interface.
+func (h *SamplingHandler) WithGroup(name string) slog.Handler {
+	return &SamplingHandler{next: h.next.WithGroup(name), sampler: h.sampler}
+}
+
+// sample counts the record and reports whether it should be logged.
+func (s *sampler) sample(now time.Time, key samplingKey) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// start a new window, this also drops the counters of messages that are no longer logged
+	if now.Sub(s.windowStart) >= s.interval {
+		s.windowStart = now
+		clear(s.counts)
+	}
+
+	s.counts[key]++
+	count := s.counts[key]
+	if count <= s.initial {
+		return true
+	}
+	return s.every > 0 && (count-s.initial)%s.every == 0
+}
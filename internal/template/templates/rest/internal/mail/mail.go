@@ -0,0 +1,95 @@
+// Package mail renders emails from templates and sends them through a Sender.
+package mail
+
+import (
+	"bytes"
+	"context"
+	"embed"
+	"fmt"
+	htmltemplate "html/template"
+	"strings"
+	texttemplate "text/template"
+)
+
+// Message is an email with a plain text and an HTML body.
+type Message struct {
+	From    string
+	To      string
+	Subject string
+	Text    string
+	HTML    string
+}
+
+// Sender delivers messages, e.g. over SMTP or into a local outbox.
+type Sender interface {
+	Send(ctx context.Context, msg *Message) error
+}
+
+//go:embed templates
+var templateFS embed.FS
+
+// Mailer renders messages from the embedded templates and sends them with the sender.
+//
+// Every email has three templates in the templates directory, e.g. for "verify_email":
+//
+//	verify_email.subject.tmpl  the subject, rendered as text
+//	verify_email.txt.tmpl      the plain text body
+//	verify_email.html.tmpl     the HTML body, values are escaped
+type Mailer struct {
+	sender Sender
+	from   string
+	text   *texttemplate.Template
+	html   *htmltemplate.Template
+}
+
+// NewMailer creates a mailer that sends messages from the from address with the sender.
+// It returns an error if the templates can't be parsed.
+func NewMailer(sender Sender, from string) (*Mailer, error) {
+	text, err := texttemplate.ParseFS(templateFS, "templates/*.subject.tmpl", "templates/*.txt.tmpl")
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse text templates: %w", err)
+	}
+
+	html, err := htmltemplate.ParseFS(templateFS, "templates/*.html.tmpl")
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse html templates: %w", err)
+	}
+
+	return &Mailer{
+		sender: sender,
+		from:   from,
+		text:   text,
+		html:   html,
+	}, nil
+}
+
+// Send renders the email with the data and sends it to the recipient.
+func (m *Mailer) Send(ctx context.Context, to, name string, data any) error {
+	msg, err := m.Render(to, name, data)
+	if err != nil {
+		return err
+	}
+	return m.sender.Send(ctx, msg)
+}
+
+// Render renders the email with the data without sending it.
+func (m *Mailer) Render(to, name string, data any) (*Message, error) {
+	var subject, text, html bytes.Buffer
+	if err := m.text.ExecuteTemplate(&subject, name+".subject.tmpl", data); err != nil {
+		return nil, fmt.Errorf("failed to render subject of %s: %w", name, err)
+	}
+	if err := m.text.ExecuteTemplate(&text, name+".txt.tmpl", data); err != nil {
+		return nil, fmt.Errorf("failed to render text of %s: %w", name, err)
+	}
+	if err := m.html.ExecuteTemplate(&html, name+".html.tmpl", data); err != nil {
+		return nil, fmt.Errorf("failed to render html of %s: %w", name, err)
+	}
+
+	return &Message{
+		From:    m.from,
+		To:      to,
+		Subject: strings.TrimSpace(subject.String()),
+		Text:    text.String(),
+		HTML:    html.String(),
+	}, nil
+}
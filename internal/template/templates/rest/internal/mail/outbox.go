@@ -0,0 +1,50 @@
+package mail
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Outbox is a Sender that writes messages to a file or stdout instead of delivering them.
+// It is meant for development and tests, where the links in the emails can be copied from the outbox.
+type Outbox struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+// NewOutbox creates an outbox writing to w, e.g. os.Stdout.
+func NewOutbox(w io.Writer) *Outbox {
+	return &Outbox{w: w}
+}
+
+// OpenFileOutbox creates an outbox appending to the file at path, creating it if needed.
+// The file is kept open until the returned close function is called.
+func OpenFileOutbox(path string) (*Outbox, func() error, error) {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to open mail outbox: %w", err)
+	}
+	return NewOutbox(file), file.Close, nil
+}
+
+// Send implements the Sender interface.
+// Messages are written readable rather than MIME encoded, with the headers and the text body,
+// so links can be copied as they are. Use Mailer.Render to check the HTML body.
+func (o *Outbox) Send(ctx context.Context, msg *Message) error {
+	// encoding validates the addresses and subject like a real sender would
+	if _, err := msg.Bytes(); err != nil {
+		return err
+	}
+
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	_, err := fmt.Fprintf(o.w, "----- %s\nFrom: %s\nTo: %s\nSubject: %s\n\n%s\n",
+		time.Now().UTC().Format(time.RFC3339), msg.From, msg.To, msg.Subject, strings.TrimRight(msg.Text, "\n"))
+	return err
+}
@@ -0,0 +1,50 @@
+package mail
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/mail"
+	"net/smtp"
+)
+
+// SMTPSender sends messages through an SMTP server.
+// The connection is upgraded with STARTTLS if the server supports it, credentials are only sent over TLS.
+type SMTPSender struct {
+	addr string
+	auth smtp.Auth
+}
+
+// NewSMTPSender creates a sender for the server at host:port.
+// If username is empty, messages are sent without authentication, e.g. to a local relay.
+func NewSMTPSender(host, port, username, password string) *SMTPSender {
+	var auth smtp.Auth
+	if username != "" {
+		auth = smtp.PlainAuth("", username, password, host)
+	}
+	return &SMTPSender{
+		addr: net.JoinHostPort(host, port),
+		auth: auth,
+	}
+}
+
+// Send implements the Sender interface.
+// The net/smtp package doesn't support contexts, the context is only checked before sending.
+func (s *SMTPSender) Send(ctx context.Context, msg *Message) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	body, err := msg.Bytes()
+	if err != nil {
+		return err
+	}
+
+	// the envelope needs the bare addresses, the headers may contain display names
+	from, _ := mail.ParseAddress(msg.From)
+	to, _ := mail.ParseAddress(msg.To)
+	if err := smtp.SendMail(s.addr, s.auth, from.Address, []string{to.Address}, body); err != nil {
+		return fmt.Errorf("failed to send mail: %w", err)
+	}
+	return nil
+}
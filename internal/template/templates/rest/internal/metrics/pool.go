@@ -0,0 +1,63 @@
+package metrics
+
+import (
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// poolCollector collects the statistics of a pgx connection pool on every scrape.
+type poolCollector struct {
+	pool *pgxpool.Pool
+
+	maxConns         *prometheus.Desc
+	totalConns       *prometheus.Desc
+	acquiredConns    *prometheus.Desc
+	idleConns        *prometheus.Desc
+	acquires         *prometheus.Desc
+	acquireDuration  *prometheus.Desc
+	emptyAcquires    *prometheus.Desc
+	canceledAcquires *prometheus.Desc
+	newConns         *prometheus.Desc
+	closedLifetime   *prometheus.Desc
+	closedIdle       *prometheus.Desc
+}
+
+func newPoolCollector(pool *pgxpool.Pool, name string) *poolCollector {
+	labels := prometheus.Labels{"db_name": name}
+	desc := func(name, help string) *prometheus.Desc {
+		return prometheus.NewDesc("pgxpool_"+name, help, nil, labels)
+	}
+	return &poolCollector{
+		pool:             pool,
+		maxConns:         desc("max_connections", "Maximum number of connections of the pool."),
+		totalConns:       desc("connections", "Number of open connections, acquired, idle and being established."),
+		acquiredConns:    desc("acquired_connections", "Number of connections in use."),
+		idleConns:        desc("idle_connections", "Number of idle connections."),
+		acquires:         desc("acquires_total", "Total number of connections acquired from the pool."),
+		acquireDuration:  desc("acquire_duration_seconds_total", "Total time spent acquiring connections."),
+		emptyAcquires:    desc("empty_acquires_total", "Total number of acquires that waited for a connection, as none was idle."),
+		canceledAcquires: desc("canceled_acquires_total", "Total number of acquires canceled by their context."),
+		newConns:         desc("new_connections_total", "Total number of connections opened."),
+		closedLifetime:   desc("max_lifetime_destroys_total", "Total number of connections closed for exceeding the maximum lifetime."),
+		closedIdle:       desc("max_idle_destroys_total", "Total number of connections closed for exceeding the maximum idle time."),
+	}
+}
+
+func (c *poolCollector) Describe(ch chan<- *prometheus.Desc) {
+	prometheus.DescribeByCollect(c, ch)
+}
+
+func (c *poolCollector) Collect(ch chan<- prometheus.Metric) {
+	stat := c.pool.Stat()
+	ch <- prometheus.MustNewConstMetric(c.maxConns, prometheus.GaugeValue, float64(stat.MaxConns()))
+	ch <- prometheus.MustNewConstMetric(c.totalConns, prometheus.GaugeValue, float64(stat.TotalConns()))
+	ch <- prometheus.MustNewConstMetric(c.acquiredConns, prometheus.GaugeValue, float64(stat.AcquiredConns()))
+	ch <- prometheus.MustNewConstMetric(c.idleConns, prometheus.GaugeValue, float64(stat.IdleConns()))
+	ch <- prometheus.MustNewConstMetric(c.acquires, prometheus.CounterValue, float64(stat.AcquireCount()))
+	ch <- prometheus.MustNewConstMetric(c.acquireDuration, prometheus.CounterValue, stat.AcquireDuration().Seconds())
+	ch <- prometheus.MustNewConstMetric(c.emptyAcquires, prometheus.CounterValue, float64(stat.EmptyAcquireCount()))
+	ch <- prometheus.MustNewConstMetric(c.canceledAcquires, prometheus.CounterValue, float64(stat.CanceledAcquireCount()))
+	ch <- prometheus.MustNewConstMetric(c.newConns, prometheus.CounterValue, float64(stat.NewConnsCount()))
+	ch <- prometheus.MustNewConstMetric(c.closedLifetime, prometheus.CounterValue, float64(stat.MaxLifetimeDestroyCount()))
+	ch <- prometheus.MustNewConstMetric(c.closedIdle, prometheus.CounterValue, float64(stat.MaxIdleDestroyCount()))
+}
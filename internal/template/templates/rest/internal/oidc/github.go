@@ -0,0 +1,86 @@
+package oidc
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// Endpoints of GitHub, its OAuth apps have no discovery and no ID tokens.
+const (
+	githubAuthorizeURL = "https://github.com/login/oauth/authorize"
+	githubTokenURL     = "https://github.com/login/oauth/access_token"
+	githubAPIURL       = "https://api.github.com"
+)
+
+// githubAuthCodeURL returns the URL of GitHub the user is sent to for signing in.
+// GitHub doesn't know nonces, the state and the PKCE code verifier bind the callback to the sign in.
+func (p *Provider) githubAuthCodeURL(redirectURI, state, verifier string) string {
+	query := url.Values{}
+	query.Set("client_id", p.config.ClientID)
+	query.Set("redirect_uri", redirectURI)
+	query.Set("scope", strings.Join(p.config.Scopes, " "))
+	query.Set("state", state)
+	query.Set("code_challenge", CodeChallenge(verifier))
+	query.Set("code_challenge_method", "S256")
+	return githubAuthorizeURL + "?" + query.Encode()
+}
+
+// githubUser is the part of the profile of a GitHub user that is used.
+type githubUser struct {
+	ID    int64  `json:"id"`
+	Login string `json:"login"`
+	Name  string `json:"name"`
+}
+
+// githubEmail is an email of a GitHub user, see GET /user/emails, which needs the user:email scope.
+type githubEmail struct {
+	Email    string `json:"email"`
+	Primary  bool   `json:"primary"`
+	Verified bool   `json:"verified"`
+}
+
+// exchangeGitHub exchanges the code for an access token and returns the identity from the profile of the user.
+// The subject is the numeric ID, logins can be renamed. The email is the primary email of the account.
+func (p *Provider) exchangeGitHub(ctx context.Context, code, redirectURI, verifier string) (*Identity, error) {
+	token, err := p.requestToken(ctx, githubTokenURL, code, redirectURI, verifier)
+	if err != nil {
+		return nil, err
+	}
+	if token.AccessToken == "" {
+		return nil, fmt.Errorf("%w: no access token in response", ErrExchange)
+	}
+
+	var user githubUser
+	err = getJSON(ctx, p.client, githubAPIURL+"/user", token.AccessToken, &user)
+	if err != nil {
+		return nil, fmt.Errorf("oidc: github profile: %w", err)
+	}
+	if user.ID == 0 {
+		return nil, fmt.Errorf("oidc: github profile: no user ID")
+	}
+
+	var emails []githubEmail
+	err = getJSON(ctx, p.client, githubAPIURL+"/user/emails", token.AccessToken, &emails)
+	if err != nil {
+		return nil, fmt.Errorf("oidc: github emails: %w", err)
+	}
+
+	identity := &Identity{
+		Subject: strconv.FormatInt(user.ID, 10),
+		Name:    user.Name,
+	}
+	if identity.Name == "" {
+		identity.Name = user.Login
+	}
+	for _, email := range emails {
+		if email.Primary {
+			identity.Email = email.Email
+			identity.EmailVerified = email.Verified
+			break
+		}
+	}
+	return identity, nil
+}
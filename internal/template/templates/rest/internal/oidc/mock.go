@@ -0,0 +1,333 @@
+package oidc
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// mockCodeTTL is how long codes of the mock provider can be exchanged.
+const mockCodeTTL = time.Minute
+
+// MockProvider is a minimal OpenID Connect provider for local development and tests.
+// Its sign in page only asks for an email, or takes it from the login_hint parameter to skip the page,
+// and reports any email as verified, so it must never be enabled in production.
+// Keys and codes are kept in memory, the key is generated on start.
+type MockProvider struct {
+	issuer string
+	path   string // path of the issuer URL, the provider is served below it
+	key    *ecdsa.PrivateKey
+	kid    string
+	mux    http.Handler
+
+	mu    sync.Mutex
+	codes map[string]mockCode
+}
+
+type mockCode struct {
+	clientID    string
+	redirectURI string
+	challenge   string
+	nonce       string
+	email       string
+	expiresAt   time.Time
+}
+
+// NewMockProvider creates a mock provider with the issuer URL, e.g. "http://localhost:8080/oidc/mock".
+// Browsers have to reach the sign in page at the issuer URL, see Path.
+func NewMockProvider(issuer string) (*MockProvider, error) {
+	u, err := url.Parse(issuer)
+	if err != nil || u.Scheme == "" || u.Host == "" || strings.Trim(u.Path, "/") == "" {
+		return nil, fmt.Errorf("oidc: invalid mock issuer %q, it needs a path like /oidc/mock", issuer)
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	kid, err := RandomString()
+	if err != nil {
+		return nil, err
+	}
+
+	m := &MockProvider{
+		issuer: strings.TrimSuffix(issuer, "/"),
+		path:   strings.TrimSuffix(u.Path, "/"),
+		key:    key,
+		kid:    kid[:16],
+		codes:  make(map[string]mockCode),
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /.well-known/openid-configuration", m.discovery)
+	mux.HandleFunc("GET /authorize", m.authorize)
+	mux.HandleFunc("POST /authorize", m.authorize)
+	mux.HandleFunc("POST /token", m.token)
+	mux.HandleFunc("GET /jwks", m.jwks)
+	m.mux = http.StripPrefix(m.path, mux)
+
+	return m, nil
+}
+
+// Issuer returns the issuer URL.
+func (m *MockProvider) Issuer() string {
+	return m.issuer
+}
+
+// Path returns the path of the issuer URL, the router mounts the provider there.
+func (m *MockProvider) Path() string {
+	return m.path
+}
+
+func (m *MockProvider) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	m.mux.ServeHTTP(w, r)
+}
+
+// Client returns an HTTP client that serves all requests with the mock provider in-process,
+// so the server side of the flow doesn't depend on how the issuer URL resolves.
+func (m *MockProvider) Client() *http.Client {
+	return &http.Client{Transport: handlerTransport{handler: m}}
+}
+
+func (m *MockProvider) discovery(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]any{
+		"issuer":                                m.issuer,
+		"authorization_endpoint":                m.issuer + "/authorize",
+		"token_endpoint":                        m.issuer + "/token",
+		"jwks_uri":                              m.issuer + "/jwks",
+		"response_types_supported":              []string{"code"},
+		"subject_types_supported":               []string{"public"},
+		"id_token_signing_alg_values_supported": []string{"ES256"},
+		"code_challenge_methods_supported":      []string{"S256"},
+		"scopes_supported":                      []string{"openid", "email", "profile"},
+	})
+}
+
+var mockSignInPage = template.Must(template.New("signin").Parse(`<!DOCTYPE html>
+<html>
+<head><title>Mock sign in</title></head>
+<body>
+<h1>Mock sign in</h1>
+<p>Any email is accepted and reported as verified.</p>
+{{if .Error}}<p style="color: red">{{.Error}}</p>{{end}}
+<form method="post">
+{{range $name, $value := .Params}}<input type="hidden" name="{{$name}}" value="{{$value}}">
+{{end}}<input type="email" name="email" value="{{.Email}}" placeholder="email" required autofocus>
+<button type="submit">Sign in</button>
+</form>
+</body>
+</html>
+`))
+
+// authorize shows the sign in page and redirects back with a code once an email is entered.
+func (m *MockProvider) authorize(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "invalid request", http.StatusBadRequest)
+		return
+	}
+
+	redirectURI := r.Form.Get("redirect_uri")
+	redirect, err := url.Parse(redirectURI)
+	if err != nil || !redirect.IsAbs() {
+		http.Error(w, "invalid redirect_uri", http.StatusBadRequest)
+		return
+	}
+	switch {
+	case r.Form.Get("client_id") == "":
+		http.Error(w, "client_id is required", http.StatusBadRequest)
+		return
+	case r.Form.Get("response_type") != "code":
+		http.Error(w, "response_type must be code", http.StatusBadRequest)
+		return
+	case r.Form.Get("code_challenge") == "" || r.Form.Get("code_challenge_method") != "S256":
+		http.Error(w, "a S256 code_challenge is required", http.StatusBadRequest)
+		return
+	}
+
+	email := r.Form.Get("email")
+	if email == "" {
+		email = r.Form.Get("login_hint")
+	}
+	if email == "" || !strings.Contains(email, "@") {
+		params := map[string]string{}
+		for _, name := range []string{"client_id", "redirect_uri", "response_type", "scope", "state", "nonce", "code_challenge", "code_challenge_method"} {
+			params[name] = r.Form.Get(name)
+		}
+		data := map[string]any{"Params": params, "Email": email}
+		if email != "" {
+			data["Error"] = "email is not valid"
+		}
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		mockSignInPage.Execute(w, data)
+		return
+	}
+
+	code, err := RandomString()
+	if err != nil {
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+
+	m.mu.Lock()
+	// drop expired codes so abandoned flows don't pile up
+	for c, mc := range m.codes {
+		if time.Now().After(mc.expiresAt) {
+			delete(m.codes, c)
+		}
+	}
+	m.codes[code] = mockCode{
+		clientID:    r.Form.Get("client_id"),
+		redirectURI: redirectURI,
+		challenge:   r.Form.Get("code_challenge"),
+		nonce:       r.Form.Get("nonce"),
+		email:       email,
+		expiresAt:   time.Now().Add(mockCodeTTL),
+	}
+	m.mu.Unlock()
+
+	query := redirect.Query()
+	query.Set("code", code)
+	query.Set("state", r.Form.Get("state"))
+	redirect.RawQuery = query.Encode()
+	http.Redirect(w, r, redirect.String(), http.StatusFound)
+}
+
+// token exchanges a code for an ID token signed with the key of the provider.
+func (m *MockProvider) token(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil || r.Form.Get("grant_type") != "authorization_code" {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "unsupported_grant_type"})
+		return
+	}
+
+	clientID, _, ok := r.BasicAuth()
+	if ok {
+		clientID, _ = url.QueryUnescape(clientID)
+	} else {
+		clientID = r.Form.Get("client_id")
+	}
+
+	m.mu.Lock()
+	code, ok := m.codes[r.Form.Get("code")]
+	delete(m.codes, r.Form.Get("code"))
+	m.mu.Unlock()
+
+	if !ok || time.Now().After(code.expiresAt) || code.clientID != clientID || code.redirectURI != r.Form.Get("redirect_uri") ||
+		CodeChallenge(r.Form.Get("code_verifier")) != code.challenge {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_grant"})
+		return
+	}
+
+	now := time.Now()
+	sum := sha256.Sum256([]byte(strings.ToLower(code.email)))
+	token := jwt.NewWithClaims(jwt.SigningMethodES256, jwt.MapClaims{
+		"iss":            m.issuer,
+		"sub":            "mock-" + hex.EncodeToString(sum[:10]), // stable per email
+		"aud":            code.clientID,
+		"iat":            now.Unix(),
+		"exp":            now.Add(time.Hour).Unix(),
+		"nonce":          code.nonce,
+		"email":          code.email,
+		"email_verified": true,
+		"name":           strings.SplitN(code.email, "@", 2)[0],
+	})
+	token.Header["kid"] = m.kid
+	idToken, err := token.SignedString(m.key)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "server_error"})
+		return
+	}
+
+	accessToken, err := RandomString()
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "server_error"})
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]any{
+		"access_token": accessToken,
+		"token_type":   "Bearer",
+		"expires_in":   int(time.Hour.Seconds()),
+		"id_token":     idToken,
+	})
+}
+
+func (m *MockProvider) jwks(w http.ResponseWriter, r *http.Request) {
+	pub := m.key.PublicKey
+	writeJSON(w, http.StatusOK, map[string]any{"keys": []jwk{{
+		Kty: "EC",
+		Kid: m.kid,
+		Use: "sig",
+		Alg: "ES256",
+		Crv: "P-256",
+		X:   base64.RawURLEncoding.EncodeToString(pub.X.FillBytes(make([]byte, 32))),
+		Y:   base64.RawURLEncoding.EncodeToString(pub.Y.FillBytes(make([]byte, 32))),
+	}}})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+// handlerTransport is a RoundTripper that serves requests with a handler instead of the network.
+type handlerTransport struct {
+	handler http.Handler
+}
+
+func (t handlerTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	rec := &responseRecorder{header: http.Header{}, status: http.StatusOK}
+	t.handler.ServeHTTP(rec, req)
+
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", rec.status, http.StatusText(rec.status)),
+		StatusCode:    rec.status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        rec.header,
+		Body:          io.NopCloser(&rec.body),
+		ContentLength: int64(rec.body.Len()),
+		Request:       req,
+	}, nil
+}
+
+// responseRecorder records the response of a handler for handlerTransport.
+type responseRecorder struct {
+	header      http.Header
+	status      int
+	body        bytes.Buffer
+	wroteHeader bool
+}
+
+func (r *responseRecorder) Header() http.Header {
+	return r.header
+}
+
+func (r *responseRecorder) WriteHeader(status int) {
+	if !r.wroteHeader {
+		r.status = status
+		r.wroteHeader = true
+	}
+}
+
+func (r *responseRecorder) Write(b []byte) (int, error) {
+	r.WriteHeader(http.StatusOK)
+	return r.body.Write(b)
+}
@@ -0,0 +1,320 @@
+// Package oidc implements the client side of OpenID Connect sign in with the authorization code flow
+// and PKCE (RFC 7636), e.g. "Sign in with Google".
+// The endpoints and keys of a provider are found with OpenID Connect Discovery from its issuer URL,
+// ID tokens are verified with the keys of the provider.
+// GitHub only speaks OAuth 2.0, its users are identified by their profile instead, see TypeGitHub.
+package oidc
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+var (
+	// ErrExchange is returned when the provider rejects the authorization code.
+	ErrExchange = errors.New("oidc: code exchange failed")
+	// ErrInvalidIDToken is returned when the ID token of the provider can't be verified.
+	ErrInvalidIDToken = errors.New("oidc: invalid ID token")
+)
+
+// Types of providers.
+const (
+	TypeOIDC   = "oidc"   // OpenID Connect provider, found by its issuer URL
+	TypeGitHub = "github" // GitHub OAuth app, the identity is read from the profile of the user
+)
+
+// Config configures a provider.
+type Config struct {
+	Name         string       // name of the provider in URLs, e.g. "google"
+	Type         string       // type of the provider, defaults to TypeOIDC
+	Issuer       string       // issuer URL, e.g. "https://accounts.google.com", unused for GitHub
+	ClientID     string       // client ID registered with the provider
+	ClientSecret string       // client secret, empty for public clients
+	Scopes       []string     // scopes to request, "openid" is always requested for OIDC, defaults to email and profile
+	HTTPClient   *http.Client // client for requests to the provider, defaults to one with a 10s timeout
+	Mock         bool         // the provider is the MockProvider, its emails can't be trusted
+}
+
+// Provider is an OpenID Connect provider.
+// The discovery document is fetched on first use and cached, the keys are refetched when
+// an ID token is signed with an unknown key, so rotated keys are picked up.
+type Provider struct {
+	config Config
+	client *http.Client
+
+	mu       sync.Mutex
+	metadata *metadata
+	keys     *keySet
+}
+
+// metadata is the part of the discovery document that is used.
+type metadata struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+// Identity is the user as identified by the provider.
+type Identity struct {
+	Subject       string // unique and stable ID of the user at the provider
+	Email         string
+	EmailVerified bool // whether the provider verified the user owns the email
+	Name          string
+}
+
+func NewProvider(config Config) *Provider {
+	if config.Type == "" {
+		config.Type = TypeOIDC
+	}
+	if config.Scopes == nil {
+		config.Scopes = []string{"email", "profile"}
+		if config.Type == TypeGitHub {
+			config.Scopes = []string{"read:user", "user:email"}
+		}
+	}
+	client := config.HTTPClient
+	if client == nil {
+		client = &http.Client{Timeout: 10 * time.Second}
+	}
+	return &Provider{
+		config: config,
+		client: client,
+	}
+}
+
+func (p *Provider) Name() string {
+	return p.config.Name
+}
+
+// Mock reports whether the provider is the MockProvider, which reports any email as verified.
+func (p *Provider) Mock() bool {
+	return p.config.Mock
+}
+
+// AuthCodeURL returns the URL of the provider the user is sent to for signing in.
+// The provider redirects back to the redirect URI with the code and the state.
+// The state, nonce and code verifier are random values the caller keeps until the callback.
+func (p *Provider) AuthCodeURL(ctx context.Context, redirectURI, state, nonce, verifier string) (string, error) {
+	if p.config.Type == TypeGitHub {
+		return p.githubAuthCodeURL(redirectURI, state, verifier), nil
+	}
+
+	md, err := p.discover(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	query := url.Values{}
+	query.Set("response_type", "code")
+	query.Set("client_id", p.config.ClientID)
+	query.Set("redirect_uri", redirectURI)
+	query.Set("scope", strings.Join(append([]string{"openid"}, p.config.Scopes...), " "))
+	query.Set("state", state)
+	query.Set("nonce", nonce)
+	query.Set("code_challenge", CodeChallenge(verifier))
+	query.Set("code_challenge_method", "S256")
+
+	sep := "?"
+	if strings.Contains(md.AuthorizationEndpoint, "?") {
+		sep = "&"
+	}
+	return md.AuthorizationEndpoint + sep + query.Encode(), nil
+}
+
+// Exchange exchanges the code of the callback for the tokens of the user, verifies the ID token
+// and returns the identity of the user.
+// The redirect URI, nonce and code verifier have to be those of AuthCodeURL.
+func (p *Provider) Exchange(ctx context.Context, code, redirectURI, nonce, verifier string) (*Identity, error) {
+	if p.config.Type == TypeGitHub {
+		return p.exchangeGitHub(ctx, code, redirectURI, verifier)
+	}
+
+	md, err := p.discover(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	token, err := p.requestToken(ctx, md.TokenEndpoint, code, redirectURI, verifier)
+	if err != nil {
+		return nil, err
+	}
+	if token.IDToken == "" {
+		return nil, fmt.Errorf("%w: no ID token in response", ErrExchange)
+	}
+
+	return p.verify(ctx, md, token.IDToken, nonce)
+}
+
+// tokenResponse is the part of the token response that is used.
+type tokenResponse struct {
+	IDToken          string `json:"id_token"`
+	AccessToken      string `json:"access_token"`
+	Error            string `json:"error"`
+	ErrorDescription string `json:"error_description"`
+}
+
+// requestToken posts the code to the token endpoint and returns the tokens.
+func (p *Provider) requestToken(ctx context.Context, endpoint, code, redirectURI, verifier string) (*tokenResponse, error) {
+	// GitHub takes the client credentials only in the form
+	credentialsInForm := p.config.Type == TypeGitHub
+
+	form := url.Values{}
+	form.Set("grant_type", "authorization_code")
+	form.Set("code", code)
+	form.Set("redirect_uri", redirectURI)
+	form.Set("code_verifier", verifier)
+	if p.config.ClientSecret == "" || credentialsInForm {
+		form.Set("client_id", p.config.ClientID)
+	}
+	if p.config.ClientSecret != "" && credentialsInForm {
+		form.Set("client_secret", p.config.ClientSecret)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if p.config.ClientSecret != "" && !credentialsInForm {
+		req.SetBasicAuth(url.QueryEscape(p.config.ClientID), url.QueryEscape(p.config.ClientSecret))
+	}
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var body tokenResponse
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(&body); err != nil {
+		return nil, fmt.Errorf("%w: %s: %v", ErrExchange, resp.Status, err)
+	}
+	// GitHub reports errors with 200 OK
+	if resp.StatusCode != http.StatusOK || body.Error != "" {
+		return nil, fmt.Errorf("%w: %s: %s", ErrExchange, resp.Status, strings.TrimSpace(body.Error+" "+body.ErrorDescription))
+	}
+	return &body, nil
+}
+
+// idTokenClaims are the claims of ID tokens that are used.
+type idTokenClaims struct {
+	jwt.RegisteredClaims
+	Nonce         string `json:"nonce"`
+	Email         string `json:"email"`
+	EmailVerified any    `json:"email_verified"` // a bool, some providers send a string
+	Name          string `json:"name"`
+}
+
+// verify checks the signature, issuer, audience, expiry and nonce of the ID token.
+func (p *Provider) verify(ctx context.Context, md *metadata, idToken, nonce string) (*Identity, error) {
+	var claims idTokenClaims
+	_, err := jwt.ParseWithClaims(idToken, &claims,
+		func(token *jwt.Token) (any, error) {
+			kid, _ := token.Header["kid"].(string)
+			return p.keys.get(ctx, kid)
+		},
+		jwt.WithValidMethods([]string{"RS256", "RS384", "RS512", "ES256", "ES384", "ES512"}),
+		jwt.WithIssuer(md.Issuer),
+		jwt.WithAudience(p.config.ClientID),
+		jwt.WithExpirationRequired(),
+		jwt.WithIssuedAt(),
+		jwt.WithLeeway(time.Minute),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidIDToken, err)
+	}
+
+	if claims.Nonce == "" || claims.Nonce != nonce {
+		return nil, fmt.Errorf("%w: nonce mismatch", ErrInvalidIDToken)
+	}
+	if claims.Subject == "" {
+		return nil, fmt.Errorf("%w: no subject", ErrInvalidIDToken)
+	}
+
+	verified := claims.EmailVerified == true || claims.EmailVerified == "true"
+	return &Identity{
+		Subject:       claims.Subject,
+		Email:         claims.Email,
+		EmailVerified: verified,
+		Name:          claims.Name,
+	}, nil
+}
+
+// discover fetches the discovery document of the issuer, a failed fetch is retried on the next call.
+func (p *Provider) discover(ctx context.Context) (*metadata, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.metadata != nil {
+		return p.metadata, nil
+	}
+
+	var md metadata
+	err := getJSON(ctx, p.client, strings.TrimSuffix(p.config.Issuer, "/")+"/.well-known/openid-configuration", "", &md)
+	if err != nil {
+		return nil, fmt.Errorf("oidc: discovery of %s: %w", p.config.Issuer, err)
+	}
+	if md.Issuer != p.config.Issuer {
+		return nil, fmt.Errorf("oidc: discovery of %s: issuer %q doesn't match", p.config.Issuer, md.Issuer)
+	}
+	if md.AuthorizationEndpoint == "" || md.TokenEndpoint == "" || md.JWKSURI == "" {
+		return nil, fmt.Errorf("oidc: discovery of %s: missing endpoints", p.config.Issuer)
+	}
+
+	p.metadata = &md
+	p.keys = newKeySet(p.client, md.JWKSURI)
+	return p.metadata, nil
+}
+
+// getJSON gets the URL, with the access token if not empty, and decodes the JSON response into v.
+func getJSON(ctx context.Context, client *http.Client, url, accessToken string, v any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	if accessToken != "" {
+		req.Header.Set("Authorization", "Bearer "+accessToken)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(v)
+}
+
+// RandomString returns a random URL-safe string with 256 bits, for states, nonces and code verifiers.
+func RandomString() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// CodeChallenge returns the S256 code challenge of the PKCE code verifier.
+func CodeChallenge(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
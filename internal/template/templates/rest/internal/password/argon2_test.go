@@ -0,0 +1,142 @@
+package password
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+// testArgon2Params are cheap parameters, so the tests run fast.
+var testArgon2Params = Argon2Params{
+	Memory:      64,
+	Iterations:  1,
+	Parallelism: 1,
+	SaltLength:  16,
+	KeyLength:   32,
+}
+
+func TestArgon2idRoundTrip(t *testing.T) {
+	a := NewArgon2id(testArgon2Params)
+
+	hash, err := a.Hash("correct horse battery staple")
+	if err != nil {
+		t.Fatalf("Hash: %v", err)
+	}
+	if !strings.HasPrefix(hash, "$argon2id$v=19$m=64,t=1,p=1$") {
+		t.Errorf("hash %q has unexpected prefix", hash)
+	}
+	if !a.Supports(hash) {
+		t.Errorf("Supports(%q) = false", hash)
+	}
+
+	tests := []struct {
+		password string
+		want     bool
+	}{
+		{"correct horse battery staple", true},
+		{"correct horse battery stapl", false},
+		{"", false},
+	}
+	for _, tt := range tests {
+		ok, err := a.Verify(tt.password, hash)
+		if err != nil {
+			t.Fatalf("Verify(%q): %v", tt.password, err)
+		}
+		if ok != tt.want {
+			t.Errorf("Verify(%q) = %v, want %v", tt.password, ok, tt.want)
+		}
+	}
+
+	other, err := a.Hash("correct horse battery staple")
+	if err != nil {
+		t.Fatalf("Hash: %v", err)
+	}
+	if other == hash {
+		t.Error("hashes of the same password are equal, the salt is not random")
+	}
+}
+
+func TestArgon2idNeedsRehash(t *testing.T) {
+	a := NewArgon2id(testArgon2Params)
+	hash, err := a.Hash("password")
+	if err != nil {
+		t.Fatalf("Hash: %v", err)
+	}
+
+	stronger := testArgon2Params
+	stronger.Iterations = 2
+	longerKey := testArgon2Params
+	longerKey.KeyLength = 64
+
+	tests := []struct {
+		name   string
+		params Argon2Params
+		hash   string
+		want   bool
+	}{
+		{"same params", testArgon2Params, hash, false},
+		{"more iterations", stronger, hash, true},
+		{"longer key", longerKey, hash, true},
+		{"malformed hash", testArgon2Params, "$argon2id$v=19$m=64", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := NewArgon2id(tt.params).NeedsRehash(tt.hash); got != tt.want {
+				t.Errorf("NeedsRehash = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseArgon2id(t *testing.T) {
+	const salt, key = "c2FsdHNhbHRzYWx0c2FsdA", "a2V5a2V5a2V5a2V5a2V5a2V5a2V5a2V5a2V5a2V5a2U"
+
+	p, gotSalt, gotKey, err := parseArgon2id("$argon2id$v=19$m=65536,t=3,p=4$" + salt + "$" + key)
+	if err != nil {
+		t.Fatalf("parseArgon2id: %v", err)
+	}
+	want := Argon2Params{Memory: 65536, Iterations: 3, Parallelism: 4, SaltLength: 16, KeyLength: 32}
+	if p != want {
+		t.Errorf("params = %+v, want %+v", p, want)
+	}
+	if string(gotSalt) != "saltsaltsaltsalt" {
+		t.Errorf("salt = %q", gotSalt)
+	}
+	if len(gotKey) != 32 {
+		t.Errorf("key has %d bytes, want 32", len(gotKey))
+	}
+
+	tests := []struct {
+		name string
+		hash string
+	}{
+		{"empty", ""},
+		{"bcrypt", "$2a$10$N9qo8uLOickgx2ZMRZoMyeIjZAgcfl7p92ldGxad68LJZdL17lhWy"},
+		{"argon2i", "$argon2i$v=19$m=65536,t=3,p=4$" + salt + "$" + key},
+		{"missing key", "$argon2id$v=19$m=65536,t=3,p=4$" + salt},
+		{"extra part", "$argon2id$v=19$m=65536,t=3,p=4$" + salt + "$" + key + "$x"},
+		{"old version", "$argon2id$v=16$m=65536,t=3,p=4$" + salt + "$" + key},
+		{"malformed version", "$argon2id$19$m=65536,t=3,p=4$" + salt + "$" + key},
+		{"malformed params", "$argon2id$v=19$m=65536;t=3;p=4$" + salt + "$" + key},
+		{"zero memory", "$argon2id$v=19$m=0,t=3,p=4$" + salt + "$" + key},
+		{"zero iterations", "$argon2id$v=19$m=65536,t=0,p=4$" + salt + "$" + key},
+		{"zero parallelism", "$argon2id$v=19$m=65536,t=3,p=0$" + salt + "$" + key},
+		{"invalid salt", "$argon2id$v=19$m=65536,t=3,p=4$not*base64$" + key},
+		{"invalid key", "$argon2id$v=19$m=65536,t=3,p=4$" + salt + "$not*base64"},
+		{"empty key", "$argon2id$v=19$m=65536,t=3,p=4$" + salt + "$"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, _, _, err := parseArgon2id(tt.hash); !errors.Is(err, ErrInvalidHash) {
+				t.Errorf("err = %v, want ErrInvalidHash", err)
+			}
+		})
+	}
+}
+
+func TestArgon2idVerifyMalformedHash(t *testing.T) {
+	ok, err := NewArgon2id(testArgon2Params).Verify("password", "$argon2id$v=19$m=64,t=1,p=1$c2FsdA")
+	if ok || !errors.Is(err, ErrInvalidHash) {
+		t.Errorf("Verify = %v, %v, want false, ErrInvalidHash", ok, err)
+	}
+}
@@ -0,0 +1,82 @@
+package password
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestBcryptRoundTrip(t *testing.T) {
+	b := NewBcrypt(bcrypt.MinCost)
+
+	hash, err := b.Hash("correct horse battery staple")
+	if err != nil {
+		t.Fatalf("Hash: %v", err)
+	}
+	if !b.Supports(hash) {
+		t.Errorf("Supports(%q) = false", hash)
+	}
+
+	tests := []struct {
+		password string
+		want     bool
+	}{
+		{"correct horse battery staple", true},
+		{"Correct horse battery staple", false},
+		{"", false},
+	}
+	for _, tt := range tests {
+		ok, err := b.Verify(tt.password, hash)
+		if err != nil {
+			t.Fatalf("Verify(%q): %v", tt.password, err)
+		}
+		if ok != tt.want {
+			t.Errorf("Verify(%q) = %v, want %v", tt.password, ok, tt.want)
+		}
+	}
+}
+
+func TestBcryptTooLong(t *testing.T) {
+	b := NewBcrypt(bcrypt.MinCost)
+
+	if _, err := b.Hash(strings.Repeat("a", 72)); err != nil {
+		t.Errorf("Hash of 72 bytes: %v", err)
+	}
+	if _, err := b.Hash(strings.Repeat("a", 73)); !errors.Is(err, ErrTooLong) {
+		t.Errorf("Hash of 73 bytes: err = %v, want ErrTooLong", err)
+	}
+}
+
+func TestBcryptNeedsRehash(t *testing.T) {
+	hash, err := NewBcrypt(bcrypt.MinCost).Hash("password")
+	if err != nil {
+		t.Fatalf("Hash: %v", err)
+	}
+
+	tests := []struct {
+		name string
+		cost int
+		hash string
+		want bool
+	}{
+		{"same cost", bcrypt.MinCost, hash, false},
+		{"higher cost", bcrypt.MinCost + 1, hash, true},
+		{"malformed hash", bcrypt.MinCost, "$2a$", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := NewBcrypt(tt.cost).NeedsRehash(tt.hash); got != tt.want {
+				t.Errorf("NeedsRehash = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBcryptVerifyMalformedHash(t *testing.T) {
+	ok, err := NewBcrypt(bcrypt.MinCost).Verify("password", "$2a$04$tooshort")
+	if ok || !errors.Is(err, ErrInvalidHash) {
+		t.Errorf("Verify = %v, %v, want false, ErrInvalidHash", ok, err)
+	}
+}
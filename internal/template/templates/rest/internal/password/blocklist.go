@@ -0,0 +1,57 @@
+package password
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// Blocklist is a set of passwords that must not be used, e.g. the most common or breached passwords.
+// Passwords are compared case-insensitively. A nil blocklist contains nothing.
+type Blocklist struct {
+	passwords map[string]struct{}
+}
+
+// LoadBlocklist reads a blocklist from a file with one password per line, e.g. a list from SecLists.
+// Empty lines and lines starting with "#" are skipped.
+func LoadBlocklist(path string) (*Blocklist, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open password blocklist: %w", err)
+	}
+	defer file.Close()
+
+	b := &Blocklist{passwords: make(map[string]struct{})}
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		b.passwords[strings.ToLower(line)] = struct{}{}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read password blocklist: %w", err)
+	}
+
+	return b, nil
+}
+
+// Contains reports whether the password is on the blocklist.
+func (b *Blocklist) Contains(password string) bool {
+	if b == nil {
+		return false
+	}
+	_, ok := b.passwords[strings.ToLower(password)]
+	return ok
+}
+
+// Len returns the number of passwords on the blocklist.
+func (b *Blocklist) Len() int {
+	if b == nil {
+		return 0
+	}
+	return len(b.passwords)
+}
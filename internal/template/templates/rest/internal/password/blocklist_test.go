@@ -0,0 +1,92 @@
+package password
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLoadBlocklist(t *testing.T) {
+	tests := []struct {
+		name     string
+		content  string
+		wantLen  int
+		contains []string
+		excludes []string
+	}{
+		{
+			name:     "passwords",
+			content:  "123456\npassword\nqwerty\n",
+			wantLen:  3,
+			contains: []string{"123456", "password", "PassWord", "qwerty"},
+			excludes: []string{"letmein", ""},
+		},
+		{
+			name:     "comments and empty lines",
+			content:  "# top passwords\n\n  dragon  \n#monkey\n\r\nmonkey\n",
+			wantLen:  2,
+			contains: []string{"dragon", "monkey"},
+			excludes: []string{"# top passwords", "#monkey"},
+		},
+		{
+			name:     "duplicates",
+			content:  "Password\npassword\nPASSWORD",
+			wantLen:  1,
+			contains: []string{"password"},
+		},
+		{
+			name:     "only comments",
+			content:  "# nothing here\n# yet\n",
+			wantLen:  0,
+			excludes: []string{"# nothing here"},
+		},
+		{
+			name:     "empty file",
+			content:  "",
+			wantLen:  0,
+			excludes: []string{""},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "blocklist.txt")
+			if err := os.WriteFile(path, []byte(tt.content), 0o600); err != nil {
+				t.Fatal(err)
+			}
+
+			b, err := LoadBlocklist(path)
+			if err != nil {
+				t.Fatalf("LoadBlocklist: %v", err)
+			}
+			if b.Len() != tt.wantLen {
+				t.Errorf("Len = %d, want %d", b.Len(), tt.wantLen)
+			}
+			for _, password := range tt.contains {
+				if !b.Contains(password) {
+					t.Errorf("Contains(%q) = false", password)
+				}
+			}
+			for _, password := range tt.excludes {
+				if b.Contains(password) {
+					t.Errorf("Contains(%q) = true", password)
+				}
+			}
+		})
+	}
+}
+
+func TestLoadBlocklistMissingFile(t *testing.T) {
+	if _, err := LoadBlocklist(filepath.Join(t.TempDir(), "missing.txt")); err == nil {
+		t.Error("LoadBlocklist of a missing file succeeded")
+	}
+}
+
+func TestNilBlocklist(t *testing.T) {
+	var b *Blocklist
+	if b.Contains("password") {
+		t.Error("Contains = true for a nil blocklist")
+	}
+	if b.Len() != 0 {
+		t.Errorf("Len = %d for a nil blocklist", b.Len())
+	}
+}
@@ -0,0 +1,74 @@
+// Package password hashes passwords with argon2id or bcrypt and checks them against a list of common passwords.
+// Hashes are strings in the PHC format, e.g. "$argon2id$v=19$m=19456,t=2,p=1$<salt>$<hash>",
+// or the bcrypt format "$2a$10$...", so the algorithm and its parameters are stored with every hash.
+package password
+
+import (
+	"errors"
+)
+
+var (
+	// ErrUnsupportedHash is returned for hashes of an algorithm no hasher supports.
+	ErrUnsupportedHash = errors.New("password: unsupported hash")
+	// ErrInvalidHash is returned for malformed hashes.
+	ErrInvalidHash = errors.New("password: invalid hash")
+	// ErrTooLong is returned by hashers that can't hash long passwords, e.g. bcrypt with more than 72 bytes.
+	ErrTooLong = errors.New("password: password too long")
+)
+
+// Hasher hashes passwords and verifies passwords against hashes.
+type Hasher interface {
+	// Hash returns the hash of the password with a random salt.
+	Hash(password string) (string, error)
+	// Verify reports whether the password matches the hash.
+	Verify(password, hash string) (bool, error)
+	// NeedsRehash reports whether the hash was made with another algorithm or other parameters than new hashes,
+	// it should be replaced with a new hash the next time the password is known, e.g. on login.
+	NeedsRehash(hash string) bool
+	// Supports reports whether the hash has the format of the hasher.
+	Supports(hash string) bool
+}
+
+// New returns a hasher that hashes with the preferred hasher and verifies hashes of all hashers,
+// e.g. argon2id for new hashes and bcrypt for hashes made before switching to argon2id.
+// Hashes of the legacy hashers need a rehash.
+func New(preferred Hasher, legacy ...Hasher) Hasher {
+	return &multiHasher{
+		preferred: preferred,
+		hashers:   append([]Hasher{preferred}, legacy...),
+	}
+}
+
+type multiHasher struct {
+	preferred Hasher
+	hashers   []Hasher
+}
+
+func (m *multiHasher) Hash(password string) (string, error) {
+	return m.preferred.Hash(password)
+}
+
+func (m *multiHasher) Verify(password, hash string) (bool, error) {
+	for _, hasher := range m.hashers {
+		if hasher.Supports(hash) {
+			return hasher.Verify(password, hash)
+		}
+	}
+	return false, ErrUnsupportedHash
+}
+
+func (m *multiHasher) NeedsRehash(hash string) bool {
+	if !m.preferred.Supports(hash) {
+		return true
+	}
+	return m.preferred.NeedsRehash(hash)
+}
+
+func (m *multiHasher) Supports(hash string) bool {
+	for _, hasher := range m.hashers {
+		if hasher.Supports(hash) {
+			return true
+		}
+	}
+	return false
+}
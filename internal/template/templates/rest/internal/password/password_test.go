@@ -0,0 +1,49 @@
+package password
+
+import (
+	"errors"
+	"testing"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestMultiHasher(t *testing.T) {
+	argon := NewArgon2id(testArgon2Params)
+	legacy := NewBcrypt(bcrypt.MinCost)
+	h := New(argon, legacy)
+
+	argonHash, err := h.Hash("password")
+	if err != nil {
+		t.Fatalf("Hash: %v", err)
+	}
+	if !argon.Supports(argonHash) {
+		t.Errorf("Hash = %q, want an argon2id hash", argonHash)
+	}
+	bcryptHash, err := legacy.Hash("password")
+	if err != nil {
+		t.Fatalf("Hash: %v", err)
+	}
+
+	tests := []struct {
+		name        string
+		hash        string
+		wantOK      bool
+		wantErr     error
+		needsRehash bool
+	}{
+		{"preferred", argonHash, true, nil, false},
+		{"legacy", bcryptHash, true, nil, true},
+		{"unsupported", "$scrypt$ln=16,r=8,p=1$c2FsdA$a2V5", false, ErrUnsupportedHash, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ok, err := h.Verify("password", tt.hash)
+			if ok != tt.wantOK || !errors.Is(err, tt.wantErr) {
+				t.Errorf("Verify = %v, %v, want %v, %v", ok, err, tt.wantOK, tt.wantErr)
+			}
+			if got := h.NeedsRehash(tt.hash); got != tt.needsRehash {
+				t.Errorf("NeedsRehash = %v, want %v", got, tt.needsRehash)
+			}
+		})
+	}
+}
@@ -0,0 +1,100 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+
+	"example.com/rest/internal/domain"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+type APIKeyRepo struct {
+	db *pgxpool.Pool
+}
+
+func NewAPIKeyRepo(db *pgxpool.Pool) *APIKeyRepo {
+	return &APIKeyRepo{db: db}
+}
+
+// Insert takes an API key and inserts it into the database.
+// It returns the inserted key or an error if the operation fails.
+func (r *APIKeyRepo) Insert(ctx context.Context, key *domain.APIKey) (_ *domain.APIKey, err error) {
+	const query = "INSERT INTO api_keys (user_id, name, prefix, key_hash, scopes, expires_at) VALUES ($1, $2, $3, $4, $5, $6) RETURNING *"
+	ctx, span := startSpan(ctx, "APIKeyRepo.Insert", query)
+	defer func() { endSpan(span, err) }()
+
+	return getOne[domain.APIKey](ctx, conn(ctx, r.db), query, key.UserID, key.Name, key.Prefix, key.KeyHash, key.Scopes, key.ExpiresAt)
+}
+
+// GetByHash takes a key hash and finds the API key in the database.
+// It returns the key or an error if the operation fails.
+// If the key is not found, it returns a domain.ErrNotFound.
+func (r *APIKeyRepo) GetByHash(ctx context.Context, keyHash string) (_ *domain.APIKey, err error) {
+	const query = "SELECT * FROM api_keys WHERE key_hash = $1"
+	ctx, span := startSpan(ctx, "APIKeyRepo.GetByHash", query)
+	defer func() { endSpan(span, err) }()
+
+	key, err := getOne[domain.APIKey](ctx, conn(ctx, r.db), query, keyHash)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, domain.ErrNotFound
+		}
+		return nil, err
+	}
+	return key, nil
+}
+
+// ListByUser takes a user ID and returns the keys of the user that are not revoked, the newest first.
+// It returns an error if the operation fails.
+func (r *APIKeyRepo) ListByUser(ctx context.Context, userID int) (_ []*domain.APIKey, err error) {
+	const query = "SELECT * FROM api_keys WHERE user_id = $1 AND revoked_at IS NULL ORDER BY id DESC"
+	ctx, span := startSpan(ctx, "APIKeyRepo.ListByUser", query)
+	defer func() { endSpan(span, err) }()
+
+	return getAll[domain.APIKey](ctx, conn(ctx, r.db), query, userID)
+}
+
+// TouchLastUsed takes a key ID and sets the time the key was last used.
+// To avoid a write on every request, the time is only updated if it is older than a minute.
+func (r *APIKeyRepo) TouchLastUsed(ctx context.Context, id int) (err error) {
+	const query = "UPDATE api_keys SET last_used_at = now() WHERE id = $1 AND (last_used_at IS NULL OR last_used_at < now() - interval '1 minute')"
+	ctx, span := startSpan(ctx, "APIKeyRepo.TouchLastUsed", query)
+	defer func() { endSpan(span, err) }()
+
+	_, err = conn(ctx, r.db).Exec(ctx, query, id)
+	return err
+}
+
+// Revoke takes a key ID and a user ID and revokes the key of the user.
+// If the key is not found or already revoked, it returns a domain.ErrNotFound.
+func (r *APIKeyRepo) Revoke(ctx context.Context, id, userID int) (err error) {
+	const query = "UPDATE api_keys SET revoked_at = now() WHERE id = $1 AND user_id = $2 AND revoked_at IS NULL"
+	ctx, span := startSpan(ctx, "APIKeyRepo.Revoke", query)
+	defer func() { endSpan(span, err) }()
+
+	result, err := conn(ctx, r.db).Exec(ctx, query, id, userID)
+	if err != nil {
+		return err
+	}
+
+	if result.RowsAffected() == 0 {
+		return domain.ErrNotFound
+	}
+
+	return nil
+}
+
+// RevokeUser takes a user ID and revokes all keys of the user.
+// It returns the number of revoked keys or an error if the operation fails.
+func (r *APIKeyRepo) RevokeUser(ctx context.Context, userID int) (_ int64, err error) {
+	const query = "UPDATE api_keys SET revoked_at = now() WHERE user_id = $1 AND revoked_at IS NULL"
+	ctx, span := startSpan(ctx, "APIKeyRepo.RevokeUser", query)
+	defer func() { endSpan(span, err) }()
+
+	result, err := conn(ctx, r.db).Exec(ctx, query, userID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
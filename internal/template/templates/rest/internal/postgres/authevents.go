@@ -0,0 +1,48 @@
+package postgres
+
+import (
+	"context"
+
+	"example.com/rest/internal/domain"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+type AuthEventRepo struct {
+	db *pgxpool.Pool
+}
+
+func NewAuthEventRepo(db *pgxpool.Pool) *AuthEventRepo {
+	return &AuthEventRepo{db: db}
+}
+
+// Insert takes an auth event and inserts it into the database.
+// Within a transaction, the event is inserted in a savepoint, so a failed insert doesn't abort the transaction.
+// It returns an error if the operation fails.
+func (r *AuthEventRepo) Insert(ctx context.Context, event *domain.AuthEvent) (err error) {
+	const query = "INSERT INTO auth_events (type, user_id, email, request_id, ip, user_agent) VALUES ($1, $2, $3, $4, $5, $6)"
+	ctx, span := startSpan(ctx, "AuthEventRepo.Insert", query)
+	defer func() { endSpan(span, err) }()
+
+	insert := func(ctx context.Context) error {
+		_, err := conn(ctx, r.db).Exec(ctx, query, event.Type, event.UserID, event.Email, event.RequestID, event.IP, event.UserAgent)
+		return err
+	}
+	if inTx(ctx) {
+		return withinTx(ctx, r.db, insert)
+	}
+	return insert(ctx)
+}
+
+// ListByUser takes a user ID, a limit and an offset and finds the auth events of the user, newest first.
+// It returns the events or an error if the operation fails.
+func (r *AuthEventRepo) ListByUser(ctx context.Context, userID, limit, offset int) (_ []*domain.AuthEvent, err error) {
+	const query = "SELECT * FROM auth_events WHERE user_id = $1 ORDER BY created_at DESC, id DESC LIMIT $2 OFFSET $3"
+	ctx, span := startSpan(ctx, "AuthEventRepo.ListByUser", query)
+	defer func() { endSpan(span, err) }()
+
+	events, err := getAll[domain.AuthEvent](ctx, conn(ctx, r.db), query, userID, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	return events, nil
+}
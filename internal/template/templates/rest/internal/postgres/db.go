@@ -5,24 +5,58 @@ import (
 	"fmt"
 	"time"
 
-	"github.com/jmoiron/sqlx"
-	_ "github.com/lib/pq"
+	"example.com/rest/internal/health"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
 )
 
-func New(url string) (*sqlx.DB, error) {
+// PoolConfig configures the connection pool.
+type PoolConfig struct {
+	MaxConns               int32
+	MinConns               int32 // connections kept open when idle, so bursts don't wait for new connections
+	MaxConnLifetime        time.Duration
+	MaxConnIdleTime        time.Duration
+	HealthCheckPeriod      time.Duration // how often idle connections are checked and closed if broken or too old
+	StatementCacheCapacity int           // prepared statements cached per connection, 0 disables the cache, e.g. for PgBouncer in transaction mode
+}
+
+// New connects to the database and registers a readiness check that pings the connection pool.
+// Queries are prepared on first use and the prepared statements are cached per connection,
+// unless the statement cache is disabled.
+func New(url string, pool PoolConfig, health *health.Registry) (*pgxpool.Pool, error) {
+	config, err := pgxpool.ParseConfig(url)
+	if err != nil {
+		return nil, fmt.Errorf("invalid database URL: %w", err)
+	}
+
+	config.MaxConns = pool.MaxConns
+	config.MinConns = pool.MinConns
+	config.MaxConnLifetime = pool.MaxConnLifetime
+	config.MaxConnIdleTime = pool.MaxConnIdleTime
+	config.HealthCheckPeriod = pool.HealthCheckPeriod
+	if pool.StatementCacheCapacity > 0 {
+		config.ConnConfig.DefaultQueryExecMode = pgx.QueryExecModeCacheStatement
+		config.ConnConfig.StatementCacheCapacity = pool.StatementCacheCapacity
+	} else {
+		// describes every query without preparing it, works with any connection pooler
+		config.ConnConfig.DefaultQueryExecMode = pgx.QueryExecModeExec
+		config.ConnConfig.StatementCacheCapacity = 0
+	}
+
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
-	db, err := sqlx.ConnectContext(ctx, "postgres", url)
+	db, err := pgxpool.NewWithConfig(ctx, config)
 	if err != nil {
 		return nil, fmt.Errorf("failed to connect to database: %w", err)
 	}
+	// the pool connects lazily, fail on start if the database can't be reached
+	if err := db.Ping(ctx); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to connect to database: %w", err)
+	}
 
-	// could be extracted to config
-	db.SetMaxOpenConns(20)
-	db.SetMaxIdleConns(10)
-	db.SetConnMaxIdleTime(5 * time.Minute)
-	db.SetConnMaxLifetime(1 * time.Hour)
+	health.Register("postgres", db.Ping)
 
 	return db, nil
 }
@@ -1,8 +1,42 @@
 package postgres
 
-import "errors"
+import (
+	"errors"
+	"fmt"
 
-var (
-	ErrNotFound = errors.New("not found")
-	ErrConflict = errors.New("conflict")
+	"example.com/rest/internal/domain"
+	"github.com/jackc/pgerrcode"
+	"github.com/jackc/pgx/v5/pgconn"
 )
+
+// mapError maps errors of the database onto the repository errors of the domain, so services don't
+// depend on the database. The database error stays wrapped, e.g. for the name of the violated constraint,
+// and for isRetryable. Repositories get their errors mapped by conn.
+func mapError(err error) error {
+	var pgErr *pgconn.PgError
+	if !errors.As(err, &pgErr) {
+		return err
+	}
+
+	switch pgErr.Code {
+	case pgerrcode.UniqueViolation:
+		return fmt.Errorf("%w: %w", domain.ErrConflict, err)
+	case pgerrcode.ForeignKeyViolation:
+		return fmt.Errorf("%w: %w", domain.ErrForeignKeyViolation, err)
+	case pgerrcode.CheckViolation:
+		return fmt.Errorf("%w: %w", domain.ErrCheckViolation, err)
+	case pgerrcode.SerializationFailure:
+		return fmt.Errorf("%w: %w", domain.ErrSerializationFailure, err)
+	}
+	return err
+}
+
+// isRetryable reports whether the transaction failed because of a serialization failure or deadlock,
+// which can succeed when run again.
+func isRetryable(err error) bool {
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		return pgErr.Code == pgerrcode.SerializationFailure || pgErr.Code == pgerrcode.DeadlockDetected
+	}
+	return false
+}
@@ -0,0 +1,145 @@
+package postgres
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"example.com/rest/internal/domain"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+type IdempotencyRepo struct {
+	db *pgxpool.Pool
+}
+
+func NewIdempotencyRepo(db *pgxpool.Pool) *IdempotencyRepo {
+	return &IdempotencyRepo{db: db}
+}
+
+// idempotencyRow is the database representation of domain.IdempotencyRecord.
+type idempotencyRow struct {
+	Scope       string    `db:"scope"`
+	Key         string    `db:"key"`
+	RequestHash string    `db:"request_hash"`
+	StatusCode  int       `db:"status_code"`
+	Header      []byte    `db:"response_header"`
+	Body        []byte    `db:"response_body"`
+	CreatedAt   time.Time `db:"created_at"`
+	ExpiresAt   time.Time `db:"expires_at"`
+}
+
+// Insert takes a new record and stores it as an in-progress request.
+// An expired record with the same scope and key is replaced.
+// If a record that has not expired already exists, it returns a domain.ErrConflict.
+func (r *IdempotencyRepo) Insert(ctx context.Context, record *domain.IdempotencyRecord) (err error) {
+	const query = `
+		INSERT INTO idempotency_keys (scope, key, request_hash, expires_at) VALUES ($1, $2, $3, $4)
+		ON CONFLICT (scope, key) DO UPDATE SET
+			request_hash = EXCLUDED.request_hash,
+			status_code = 0,
+			response_header = NULL,
+			response_body = NULL,
+			created_at = now(),
+			expires_at = EXCLUDED.expires_at
+		WHERE idempotency_keys.expires_at < now()
+		RETURNING key`
+	ctx, span := startSpan(ctx, "IdempotencyRepo.Insert", query)
+	defer func() { endSpan(span, err) }()
+
+	var key string
+	err = conn(ctx, r.db).QueryRow(ctx, query,
+		record.Scope, record.Key, record.RequestHash, record.ExpiresAt).Scan(&key)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return domain.ErrConflict
+		}
+		return err
+	}
+	return nil
+}
+
+// Get takes a scope and a key and finds the record in the database.
+// It returns the record or an error if the operation fails.
+// If the record is not found or has expired, it returns a domain.ErrNotFound.
+func (r *IdempotencyRepo) Get(ctx context.Context, scope, key string) (_ *domain.IdempotencyRecord, err error) {
+	const query = "SELECT * FROM idempotency_keys WHERE scope = $1 AND key = $2 AND expires_at >= now()"
+	ctx, span := startSpan(ctx, "IdempotencyRepo.Get", query)
+	defer func() { endSpan(span, err) }()
+
+	row, err := getOne[idempotencyRow](ctx, conn(ctx, r.db), query, scope, key)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, domain.ErrNotFound
+		}
+		return nil, err
+	}
+
+	record := &domain.IdempotencyRecord{
+		Scope:       row.Scope,
+		Key:         row.Key,
+		RequestHash: row.RequestHash,
+		StatusCode:  row.StatusCode,
+		Body:        row.Body,
+		CreatedAt:   row.CreatedAt,
+		ExpiresAt:   row.ExpiresAt,
+	}
+	if row.Header != nil {
+		if err := json.Unmarshal(row.Header, &record.Header); err != nil {
+			return nil, err
+		}
+	}
+	return record, nil
+}
+
+// Complete takes a record and stores its captured response.
+// If the record is not found, it returns a domain.ErrNotFound.
+func (r *IdempotencyRepo) Complete(ctx context.Context, record *domain.IdempotencyRecord) (err error) {
+	const query = "UPDATE idempotency_keys SET status_code = $1, response_header = $2, response_body = $3 WHERE scope = $4 AND key = $5"
+	ctx, span := startSpan(ctx, "IdempotencyRepo.Complete", query)
+	defer func() { endSpan(span, err) }()
+
+	header, err := json.Marshal(record.Header)
+	if err != nil {
+		return err
+	}
+
+	result, err := conn(ctx, r.db).Exec(ctx, query,
+		record.StatusCode, string(header), record.Body, record.Scope, record.Key)
+	if err != nil {
+		return err
+	}
+
+	if result.RowsAffected() == 0 {
+		return domain.ErrNotFound
+	}
+
+	return nil
+}
+
+// Delete takes a scope and a key and deletes the record from the database.
+// It returns an error if the operation fails. Deleting a missing record is not an error.
+func (r *IdempotencyRepo) Delete(ctx context.Context, scope, key string) (err error) {
+	const query = "DELETE FROM idempotency_keys WHERE scope = $1 AND key = $2"
+	ctx, span := startSpan(ctx, "IdempotencyRepo.Delete", query)
+	defer func() { endSpan(span, err) }()
+
+	_, err = conn(ctx, r.db).Exec(ctx, query, scope, key)
+	return err
+}
+
+// DeleteExpired deletes all expired records from the database.
+// It returns the number of deleted records or an error if the operation fails.
+func (r *IdempotencyRepo) DeleteExpired(ctx context.Context) (_ int64, err error) {
+	const query = "DELETE FROM idempotency_keys WHERE expires_at < now()"
+	ctx, span := startSpan(ctx, "IdempotencyRepo.DeleteExpired", query)
+	defer func() { endSpan(span, err) }()
+
+	result, err := conn(ctx, r.db).Exec(ctx, query)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
@@ -0,0 +1,115 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+
+	"example.com/rest/internal/domain"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+type IdentityRepo struct {
+	db *pgxpool.Pool
+}
+
+func NewIdentityRepo(db *pgxpool.Pool) *IdentityRepo {
+	return &IdentityRepo{db: db}
+}
+
+// Get takes a provider and a subject and finds the identity.
+// It returns the identity or an error if the operation fails.
+// If the identity is not found, it returns a domain.ErrNotFound.
+func (r *IdentityRepo) Get(ctx context.Context, provider, subject string) (_ *domain.Identity, err error) {
+	const query = "SELECT * FROM user_identities WHERE provider = $1 AND subject = $2"
+	ctx, span := startSpan(ctx, "IdentityRepo.Get", query)
+	defer func() { endSpan(span, err) }()
+
+	identity, err := getOne[domain.Identity](ctx, conn(ctx, r.db), query, provider, subject)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, domain.ErrNotFound
+		}
+		return nil, err
+	}
+	return identity, nil
+}
+
+// ListByUser takes a user ID and finds the identities linked to the user, oldest first.
+// It returns the identities or an error if the operation fails.
+func (r *IdentityRepo) ListByUser(ctx context.Context, userID int) (_ []*domain.Identity, err error) {
+	const query = "SELECT * FROM user_identities WHERE user_id = $1 ORDER BY id"
+	ctx, span := startSpan(ctx, "IdentityRepo.ListByUser", query)
+	defer func() { endSpan(span, err) }()
+
+	identities, err := getAll[domain.Identity](ctx, conn(ctx, r.db), query, userID)
+	if err != nil {
+		return nil, err
+	}
+	return identities, nil
+}
+
+// Insert takes an identity and links it to its user.
+// If the identity is already linked, it returns a domain.ErrConflict, if the user doesn't exist, a domain.ErrForeignKeyViolation.
+func (r *IdentityRepo) Insert(ctx context.Context, identity *domain.Identity) (err error) {
+	const query = "INSERT INTO user_identities (user_id, provider, subject, email) VALUES ($1, $2, $3, $4)"
+	ctx, span := startSpan(ctx, "IdentityRepo.Insert", query)
+	defer func() { endSpan(span, err) }()
+
+	_, err = conn(ctx, r.db).Exec(ctx, query, identity.UserID, identity.Provider, identity.Subject, identity.Email)
+	return err
+}
+
+// Touch takes an identity ID and an email and records a login with the identity.
+// It returns an error if the operation fails.
+func (r *IdentityRepo) Touch(ctx context.Context, id int, email string) (err error) {
+	const query = "UPDATE user_identities SET email = $2, last_login_at = now() WHERE id = $1"
+	ctx, span := startSpan(ctx, "IdentityRepo.Touch", query)
+	defer func() { endSpan(span, err) }()
+
+	_, err = conn(ctx, r.db).Exec(ctx, query, id, email)
+	return err
+}
+
+// InsertState takes a state and inserts it into the database.
+// It returns an error if the operation fails.
+func (r *IdentityRepo) InsertState(ctx context.Context, state *domain.OIDCState) (err error) {
+	const query = "INSERT INTO oidc_states (state_hash, binding_hash, provider, nonce, code_verifier, expires_at) VALUES ($1, $2, $3, $4, $5, $6)"
+	ctx, span := startSpan(ctx, "IdentityRepo.InsertState", query)
+	defer func() { endSpan(span, err) }()
+
+	_, err = conn(ctx, r.db).Exec(ctx, query, state.StateHash, state.BindingHash, state.Provider, state.Nonce, state.CodeVerifier, state.ExpiresAt)
+	return err
+}
+
+// ConsumeState takes a state hash and deletes the matching unexpired state, so every state can be used only once.
+// It returns the state or an error if the operation fails.
+// If no such state is found, it returns a domain.ErrNotFound.
+func (r *IdentityRepo) ConsumeState(ctx context.Context, stateHash string) (_ *domain.OIDCState, err error) {
+	const query = "DELETE FROM oidc_states WHERE state_hash = $1 AND expires_at > now() RETURNING *"
+	ctx, span := startSpan(ctx, "IdentityRepo.ConsumeState", query)
+	defer func() { endSpan(span, err) }()
+
+	state, err := getOne[domain.OIDCState](ctx, conn(ctx, r.db), query, stateHash)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, domain.ErrNotFound
+		}
+		return nil, err
+	}
+	return state, nil
+}
+
+// DeleteExpiredStates deletes all expired states from the database.
+// It returns the number of deleted states or an error if the operation fails.
+func (r *IdentityRepo) DeleteExpiredStates(ctx context.Context) (_ int64, err error) {
+	const query = "DELETE FROM oidc_states WHERE expires_at < now()"
+	ctx, span := startSpan(ctx, "IdentityRepo.DeleteExpiredStates", query)
+	defer func() { endSpan(span, err) }()
+
+	result, err := conn(ctx, r.db).Exec(ctx, query)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
@@ -0,0 +1,90 @@
+package postgres
+
+import (
+	"context"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// LoginFailureRepo counts failed logins per key, e.g. per account or per client IP, and stores lockouts.
+type LoginFailureRepo struct {
+	db *pgxpool.Pool
+}
+
+func NewLoginFailureRepo(db *pgxpool.Pool) *LoginFailureRepo {
+	return &LoginFailureRepo{db: db}
+}
+
+// LockedUntil takes a set of keys and finds the latest time until which one of them is locked.
+// It returns the zero time if none of the keys is locked or an error if the operation fails.
+func (r *LoginFailureRepo) LockedUntil(ctx context.Context, keys []string) (_ time.Time, err error) {
+	const query = "SELECT MAX(locked_until) FROM login_failures WHERE key = ANY($1) AND locked_until > now()"
+	ctx, span := startSpan(ctx, "LoginFailureRepo.LockedUntil", query)
+	defer func() { endSpan(span, err) }()
+
+	var lockedUntil *time.Time
+	err = conn(ctx, r.db).QueryRow(ctx, query, keys).Scan(&lockedUntil)
+	if err != nil || lockedUntil == nil {
+		return time.Time{}, err
+	}
+	return *lockedUntil, nil
+}
+
+// RecordFailure takes a key and counts a failed login for it.
+// Failures older than the window are forgotten, the count starts again at 1.
+// It returns the number of failures within the window or an error if the operation fails.
+func (r *LoginFailureRepo) RecordFailure(ctx context.Context, key string, window time.Duration) (_ int, err error) {
+	const query = `
+		INSERT INTO login_failures AS f (key, failures, last_failure_at) VALUES ($1, 1, now())
+		ON CONFLICT (key) DO UPDATE SET
+			failures = CASE WHEN f.last_failure_at < now() - make_interval(secs => $2::float8) THEN 1 ELSE f.failures + 1 END,
+			last_failure_at = now()
+		RETURNING failures`
+	ctx, span := startSpan(ctx, "LoginFailureRepo.RecordFailure", query)
+	defer func() { endSpan(span, err) }()
+
+	var failures int
+	err = conn(ctx, r.db).QueryRow(ctx, query, key, window.Seconds()).Scan(&failures)
+	if err != nil {
+		return 0, err
+	}
+	return failures, nil
+}
+
+// Lock takes a key and a time and rejects logins for the key until then.
+// It returns an error if the operation fails.
+func (r *LoginFailureRepo) Lock(ctx context.Context, key string, until time.Time) (err error) {
+	const query = "UPDATE login_failures SET locked_until = $2 WHERE key = $1"
+	ctx, span := startSpan(ctx, "LoginFailureRepo.Lock", query)
+	defer func() { endSpan(span, err) }()
+
+	_, err = conn(ctx, r.db).Exec(ctx, query, key, until)
+	return err
+}
+
+// Reset takes a key and forgets its failures and lockout, e.g. after a successful login.
+// It returns an error if the operation fails.
+func (r *LoginFailureRepo) Reset(ctx context.Context, key string) (err error) {
+	const query = "DELETE FROM login_failures WHERE key = $1"
+	ctx, span := startSpan(ctx, "LoginFailureRepo.Reset", query)
+	defer func() { endSpan(span, err) }()
+
+	_, err = conn(ctx, r.db).Exec(ctx, query, key)
+	return err
+}
+
+// DeleteStale deletes all keys that are not locked and had no failure within the window,
+// they behave the same as missing keys.
+// It returns the number of deleted keys or an error if the operation fails.
+func (r *LoginFailureRepo) DeleteStale(ctx context.Context, window time.Duration) (_ int64, err error) {
+	const query = "DELETE FROM login_failures WHERE last_failure_at < now() - make_interval(secs => $1::float8) AND (locked_until IS NULL OR locked_until < now())"
+	ctx, span := startSpan(ctx, "LoginFailureRepo.DeleteStale", query)
+	defer func() { endSpan(span, err) }()
+
+	result, err := conn(ctx, r.db).Exec(ctx, query, window.Seconds())
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
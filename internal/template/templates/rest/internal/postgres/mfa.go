@@ -0,0 +1,223 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+
+	"example.com/rest/internal/domain"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+type MFARepo struct {
+	db *pgxpool.Pool
+}
+
+func NewMFARepo(db *pgxpool.Pool) *MFARepo {
+	return &MFARepo{db: db}
+}
+
+// Get takes a user ID and finds the TOTP secret of the user.
+// It returns the secret or an error if the operation fails.
+// If the user has no secret, it returns a domain.ErrNotFound.
+func (r *MFARepo) Get(ctx context.Context, userID int) (_ *domain.MFA, err error) {
+	const query = "SELECT * FROM user_mfa WHERE user_id = $1"
+	ctx, span := startSpan(ctx, "MFARepo.Get", query)
+	defer func() { endSpan(span, err) }()
+
+	mfa, err := getOne[domain.MFA](ctx, conn(ctx, r.db), query, userID)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, domain.ErrNotFound
+		}
+		return nil, err
+	}
+	return mfa, nil
+}
+
+// Enroll takes a user ID and a secret and stores the unconfirmed secret of the user,
+// replacing a previous unconfirmed secret.
+// If the user already has a confirmed secret, it returns a domain.ErrConflict.
+func (r *MFARepo) Enroll(ctx context.Context, userID int, secret string) (err error) {
+	const query = `
+		INSERT INTO user_mfa (user_id, secret) VALUES ($1, $2)
+		ON CONFLICT (user_id) DO UPDATE SET secret = EXCLUDED.secret, last_used_step = 0, created_at = now()
+		WHERE user_mfa.confirmed_at IS NULL`
+	ctx, span := startSpan(ctx, "MFARepo.Enroll", query)
+	defer func() { endSpan(span, err) }()
+
+	result, err := conn(ctx, r.db).Exec(ctx, query, userID, secret)
+	if err != nil {
+		return err
+	}
+
+	if result.RowsAffected() == 0 {
+		return domain.ErrConflict
+	}
+
+	return nil
+}
+
+// Confirm takes a user ID and a set of recovery code hashes, confirms the secret of the user
+// and replaces the recovery codes, in one transaction.
+// If the user has no unconfirmed secret, it returns a domain.ErrNotFound.
+func (r *MFARepo) Confirm(ctx context.Context, userID int, codeHashes []string) (err error) {
+	const query = "UPDATE user_mfa SET confirmed_at = now() WHERE user_id = $1 AND confirmed_at IS NULL"
+	ctx, span := startSpan(ctx, "MFARepo.Confirm", query)
+	defer func() { endSpan(span, err) }()
+
+	return withinTx(ctx, r.db, func(ctx context.Context) error {
+		result, err := conn(ctx, r.db).Exec(ctx, query, userID)
+		if err != nil {
+			return err
+		}
+
+		if result.RowsAffected() == 0 {
+			return domain.ErrNotFound
+		}
+
+		return replaceRecoveryCodes(ctx, conn(ctx, r.db), userID, codeHashes)
+	})
+}
+
+// ReplaceRecoveryCodes takes a user ID and a set of recovery code hashes and replaces the recovery codes of the user.
+// It returns an error if the operation fails.
+func (r *MFARepo) ReplaceRecoveryCodes(ctx context.Context, userID int, codeHashes []string) (err error) {
+	ctx, span := startSpan(ctx, "MFARepo.ReplaceRecoveryCodes", "")
+	defer func() { endSpan(span, err) }()
+
+	return withinTx(ctx, r.db, func(ctx context.Context) error {
+		return replaceRecoveryCodes(ctx, conn(ctx, r.db), userID, codeHashes)
+	})
+}
+
+// replaceRecoveryCodes deletes the recovery codes of the user and inserts the new ones with COPY in the transaction.
+func replaceRecoveryCodes(ctx context.Context, tx queryer, userID int, codeHashes []string) error {
+	_, err := tx.Exec(ctx, "DELETE FROM mfa_recovery_codes WHERE user_id = $1", userID)
+	if err != nil {
+		return err
+	}
+
+	rows := make([][]any, len(codeHashes))
+	for i, hash := range codeHashes {
+		rows[i] = []any{userID, hash}
+	}
+	_, err = tx.CopyFrom(ctx, pgx.Identifier{"mfa_recovery_codes"}, []string{"user_id", "code_hash"}, pgx.CopyFromRows(rows))
+	return err
+}
+
+// UseStep takes a user ID and the time step of an accepted code and stores it as the last used step.
+// Only a later step than the stored one can be stored, so every code can be used only once.
+// Otherwise it returns a domain.ErrConflict.
+func (r *MFARepo) UseStep(ctx context.Context, userID int, step int64) (err error) {
+	const query = "UPDATE user_mfa SET last_used_step = $2 WHERE user_id = $1 AND last_used_step < $2"
+	ctx, span := startSpan(ctx, "MFARepo.UseStep", query)
+	defer func() { endSpan(span, err) }()
+
+	result, err := conn(ctx, r.db).Exec(ctx, query, userID, step)
+	if err != nil {
+		return err
+	}
+
+	if result.RowsAffected() == 0 {
+		return domain.ErrConflict
+	}
+
+	return nil
+}
+
+// UseRecoveryCode takes a user ID and a code hash and marks the unused recovery code of the user as used.
+// If no such code is found, it returns a domain.ErrNotFound.
+func (r *MFARepo) UseRecoveryCode(ctx context.Context, userID int, codeHash string) (err error) {
+	const query = "UPDATE mfa_recovery_codes SET used_at = now() WHERE user_id = $1 AND code_hash = $2 AND used_at IS NULL"
+	ctx, span := startSpan(ctx, "MFARepo.UseRecoveryCode", query)
+	defer func() { endSpan(span, err) }()
+
+	result, err := conn(ctx, r.db).Exec(ctx, query, userID, codeHash)
+	if err != nil {
+		return err
+	}
+
+	if result.RowsAffected() == 0 {
+		return domain.ErrNotFound
+	}
+
+	return nil
+}
+
+// Delete takes a user ID and removes the secret and recovery codes of the user in one round trip, which disables MFA.
+// It returns an error if the operation fails.
+func (r *MFARepo) Delete(ctx context.Context, userID int) (err error) {
+	const query = "DELETE FROM user_mfa WHERE user_id = $1"
+	ctx, span := startSpan(ctx, "MFARepo.Delete", query)
+	defer func() { endSpan(span, err) }()
+
+	// a batch runs in an implicit transaction, unless it is sent in one
+	batch := &pgx.Batch{}
+	batch.Queue(query, userID)
+	batch.Queue("DELETE FROM mfa_recovery_codes WHERE user_id = $1", userID)
+	return execBatch(ctx, conn(ctx, r.db), batch)
+}
+
+// InsertChallenge takes a challenge and inserts it into the database.
+// It returns an error if the operation fails.
+func (r *MFARepo) InsertChallenge(ctx context.Context, challenge *domain.MFAChallenge) (err error) {
+	const query = "INSERT INTO mfa_challenges (user_id, token_hash, expires_at) VALUES ($1, $2, $3)"
+	ctx, span := startSpan(ctx, "MFARepo.InsertChallenge", query)
+	defer func() { endSpan(span, err) }()
+
+	_, err = conn(ctx, r.db).Exec(ctx, query, challenge.UserID, challenge.TokenHash, challenge.ExpiresAt)
+	return err
+}
+
+// AttemptChallenge takes a token hash and counts an attempt on the matching challenge.
+// Only unused and unexpired challenges with fewer than maxAttempts attempts can be attempted.
+// It returns the challenge or an error if the operation fails.
+// If no such challenge is found, it returns a domain.ErrNotFound.
+func (r *MFARepo) AttemptChallenge(ctx context.Context, tokenHash string, maxAttempts int) (_ *domain.MFAChallenge, err error) {
+	const query = "UPDATE mfa_challenges SET attempts = attempts + 1 WHERE token_hash = $1 AND used_at IS NULL AND expires_at > now() AND attempts < $2 RETURNING *"
+	ctx, span := startSpan(ctx, "MFARepo.AttemptChallenge", query)
+	defer func() { endSpan(span, err) }()
+
+	challenge, err := getOne[domain.MFAChallenge](ctx, conn(ctx, r.db), query, tokenHash, maxAttempts)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, domain.ErrNotFound
+		}
+		return nil, err
+	}
+	return challenge, nil
+}
+
+// UseChallenge takes a challenge ID and marks the challenge as used.
+// If the challenge was already used, e.g. by a concurrent request, it returns a domain.ErrConflict.
+func (r *MFARepo) UseChallenge(ctx context.Context, id int) (err error) {
+	const query = "UPDATE mfa_challenges SET used_at = now() WHERE id = $1 AND used_at IS NULL"
+	ctx, span := startSpan(ctx, "MFARepo.UseChallenge", query)
+	defer func() { endSpan(span, err) }()
+
+	result, err := conn(ctx, r.db).Exec(ctx, query, id)
+	if err != nil {
+		return err
+	}
+
+	if result.RowsAffected() == 0 {
+		return domain.ErrConflict
+	}
+
+	return nil
+}
+
+// DeleteExpiredChallenges deletes all expired challenges from the database.
+// It returns the number of deleted challenges or an error if the operation fails.
+func (r *MFARepo) DeleteExpiredChallenges(ctx context.Context) (_ int64, err error) {
+	const query = "DELETE FROM mfa_challenges WHERE expires_at < now()"
+	ctx, span := startSpan(ctx, "MFARepo.DeleteExpiredChallenges", query)
+	defer func() { endSpan(span, err) }()
+
+	result, err := conn(ctx, r.db).Exec(ctx, query)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
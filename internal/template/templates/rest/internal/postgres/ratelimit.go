@@ -0,0 +1,60 @@
+package postgres
+
+import (
+	"context"
+
+	"example.com/rest/internal/ratelimit"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// RateLimitStore keeps token buckets in the database, so limits are shared between instances.
+type RateLimitStore struct {
+	db *pgxpool.Pool
+}
+
+func NewRateLimitStore(db *pgxpool.Pool) *RateLimitStore {
+	return &RateLimitStore{db: db}
+}
+
+// Take implements the ratelimit.Store interface.
+// The bucket is refilled and a token is taken in a single statement that locks the row,
+// so concurrent requests can't overspend.
+func (s *RateLimitStore) Take(ctx context.Context, key string, limit ratelimit.Limit) (_ ratelimit.Result, err error) {
+	const query = `
+		INSERT INTO rate_limits AS b (key, tokens, allowed, updated_at, full_at)
+		VALUES ($1, $2::float8 - 1, true, now(), now() + make_interval(secs => 1 / $3::float8))
+		ON CONFLICT (key) DO UPDATE SET (tokens, allowed, updated_at, full_at) = (
+			SELECT
+				CASE WHEN t >= 1 THEN t - 1 ELSE t END,
+				t >= 1,
+				now(),
+				now() + make_interval(secs => ($2::float8 - CASE WHEN t >= 1 THEN t - 1 ELSE t END) / $3::float8)
+			FROM (SELECT LEAST($2::float8, b.tokens + EXTRACT(EPOCH FROM now() - b.updated_at) * $3::float8) AS t) AS refill
+		)
+		RETURNING tokens, allowed`
+	ctx, span := startSpan(ctx, "RateLimitStore.Take", query)
+	defer func() { endSpan(span, err) }()
+
+	var tokens float64
+	var allowed bool
+	err = conn(ctx, s.db).QueryRow(ctx, query,
+		key, limit.Requests, float64(limit.Requests)/limit.Window.Seconds()).Scan(&tokens, &allowed)
+	if err != nil {
+		return ratelimit.Result{}, err
+	}
+	return ratelimit.NewResult(limit, tokens, allowed), nil
+}
+
+// DeleteFull deletes all buckets that have refilled completely, they behave the same as missing buckets.
+// It returns the number of deleted buckets or an error if the operation fails.
+func (s *RateLimitStore) DeleteFull(ctx context.Context) (_ int64, err error) {
+	const query = "DELETE FROM rate_limits WHERE full_at < now()"
+	ctx, span := startSpan(ctx, "RateLimitStore.DeleteFull", query)
+	defer func() { endSpan(span, err) }()
+
+	result, err := conn(ctx, s.db).Exec(ctx, query)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
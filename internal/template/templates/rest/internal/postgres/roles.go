@@ -0,0 +1,96 @@
+package postgres
+
+import (
+	"context"
+
+	"example.com/rest/internal/domain"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+type RoleRepo struct {
+	db *pgxpool.Pool
+}
+
+func NewRoleRepo(db *pgxpool.Pool) *RoleRepo {
+	return &RoleRepo{db: db}
+}
+
+// GetUserRoles takes a user ID and returns the names of the user's roles.
+// It returns an error if the operation fails.
+func (r *RoleRepo) GetUserRoles(ctx context.Context, userID int) (_ []string, err error) {
+	const query = `
+		SELECT roles.name FROM user_roles
+		JOIN roles ON roles.id = user_roles.role_id
+		WHERE user_roles.user_id = $1
+		ORDER BY roles.name`
+	ctx, span := startSpan(ctx, "RoleRepo.GetUserRoles", query)
+	defer func() { endSpan(span, err) }()
+
+	rows, _ := conn(ctx, r.db).Query(ctx, query, userID)
+	return pgx.CollectRows(rows, pgx.RowTo[string])
+}
+
+// GetUserPermissions takes a user ID and returns the names of the permissions granted by the user's roles.
+// It returns an error if the operation fails.
+func (r *RoleRepo) GetUserPermissions(ctx context.Context, userID int) (_ []string, err error) {
+	const query = `
+		SELECT DISTINCT permissions.name FROM user_roles
+		JOIN role_permissions ON role_permissions.role_id = user_roles.role_id
+		JOIN permissions ON permissions.id = role_permissions.permission_id
+		WHERE user_roles.user_id = $1
+		ORDER BY permissions.name`
+	ctx, span := startSpan(ctx, "RoleRepo.GetUserPermissions", query)
+	defer func() { endSpan(span, err) }()
+
+	rows, _ := conn(ctx, r.db).Query(ctx, query, userID)
+	return pgx.CollectRows(rows, pgx.RowTo[string])
+}
+
+// AssignRole takes a user ID and a role name and assigns the role to the user.
+// Assigning a role the user already has is not an error.
+// If the user or the role is not found, it returns a domain.ErrNotFound.
+func (r *RoleRepo) AssignRole(ctx context.Context, userID int, role string) (err error) {
+	const query = `
+		WITH target AS (
+			SELECT users.id AS user_id, roles.id AS role_id FROM users, roles
+			WHERE users.id = $1 AND roles.name = $2
+		), inserted AS (
+			INSERT INTO user_roles (user_id, role_id) SELECT user_id, role_id FROM target
+			ON CONFLICT DO NOTHING
+		)
+		SELECT count(*) FROM target`
+	ctx, span := startSpan(ctx, "RoleRepo.AssignRole", query)
+	defer func() { endSpan(span, err) }()
+
+	var count int
+	err = conn(ctx, r.db).QueryRow(ctx, query, userID, role).Scan(&count)
+	if err != nil {
+		return err
+	}
+
+	if count == 0 {
+		return domain.ErrNotFound
+	}
+
+	return nil
+}
+
+// RemoveRole takes a user ID and a role name and removes the role from the user.
+// If the user doesn't have the role, it returns a domain.ErrNotFound.
+func (r *RoleRepo) RemoveRole(ctx context.Context, userID int, role string) (err error) {
+	const query = "DELETE FROM user_roles USING roles WHERE roles.id = user_roles.role_id AND user_roles.user_id = $1 AND roles.name = $2"
+	ctx, span := startSpan(ctx, "RoleRepo.RemoveRole", query)
+	defer func() { endSpan(span, err) }()
+
+	result, err := conn(ctx, r.db).Exec(ctx, query, userID, role)
+	if err != nil {
+		return err
+	}
+
+	if result.RowsAffected() == 0 {
+		return domain.ErrNotFound
+	}
+
+	return nil
+}
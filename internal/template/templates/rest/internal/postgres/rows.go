@@ -0,0 +1,27 @@
+package postgres
+
+import (
+	"context"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// getOne runs the query and scans the only row into a T, matching the columns to the db tags of its fields.
+// It returns pgx.ErrNoRows if the query returns no row.
+func getOne[T any](ctx context.Context, q queryer, query string, args ...any) (*T, error) {
+	rows, _ := q.Query(ctx, query, args...) // the error is returned by the rows
+	return pgx.CollectExactlyOneRow(rows, pgx.RowToAddrOfStructByName[T])
+}
+
+// getAll runs the query and scans all rows into Ts, matching the columns to the db tags of their fields.
+// It returns an empty slice if the query returns no rows.
+func getAll[T any](ctx context.Context, q queryer, query string, args ...any) ([]*T, error) {
+	rows, _ := q.Query(ctx, query, args...)
+	return pgx.CollectRows(rows, pgx.RowToAddrOfStructByName[T])
+}
+
+// execBatch sends the queries of the batch in one round trip and closes the results.
+// It returns the error of the first query that failed.
+func execBatch(ctx context.Context, q queryer, batch *pgx.Batch) error {
+	return q.SendBatch(ctx, batch).Close()
+}
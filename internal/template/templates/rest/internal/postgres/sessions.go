@@ -0,0 +1,123 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+
+	"example.com/rest/internal/domain"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+type SessionRepo struct {
+	db *pgxpool.Pool
+}
+
+func NewSessionRepo(db *pgxpool.Pool) *SessionRepo {
+	return &SessionRepo{db: db}
+}
+
+// Insert takes a session and inserts it into the database.
+// It returns the inserted session or an error if the operation fails.
+func (r *SessionRepo) Insert(ctx context.Context, session *domain.Session) (_ *domain.Session, err error) {
+	const query = "INSERT INTO sessions (user_id, token_hash, user_agent, ip, expires_at) VALUES ($1, $2, $3, $4, $5) RETURNING *"
+	ctx, span := startSpan(ctx, "SessionRepo.Insert", query)
+	defer func() { endSpan(span, err) }()
+
+	inserted, err := getOne[domain.Session](ctx, conn(ctx, r.db), query, session.UserID, session.TokenHash, session.UserAgent, session.IP, session.ExpiresAt)
+	if err != nil {
+		return nil, err
+	}
+	return inserted, nil
+}
+
+// GetByHash takes a token hash and finds the session in the database.
+// It returns the session or an error if the operation fails.
+// If the session is not found, it returns a domain.ErrNotFound.
+func (r *SessionRepo) GetByHash(ctx context.Context, tokenHash string) (_ *domain.Session, err error) {
+	const query = "SELECT * FROM sessions WHERE token_hash = $1"
+	ctx, span := startSpan(ctx, "SessionRepo.GetByHash", query)
+	defer func() { endSpan(span, err) }()
+
+	session, err := getOne[domain.Session](ctx, conn(ctx, r.db), query, tokenHash)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, domain.ErrNotFound
+		}
+		return nil, err
+	}
+	return session, nil
+}
+
+// ListActive takes a user ID and returns the sessions of the user that are neither revoked nor expired,
+// the most recently used first. Sessions that timed out due to inactivity are filtered by the caller.
+// It returns an error if the operation fails.
+func (r *SessionRepo) ListActive(ctx context.Context, userID int) (_ []*domain.Session, err error) {
+	const query = "SELECT * FROM sessions WHERE user_id = $1 AND revoked_at IS NULL AND expires_at > now() ORDER BY last_seen_at DESC"
+	ctx, span := startSpan(ctx, "SessionRepo.ListActive", query)
+	defer func() { endSpan(span, err) }()
+
+	sessions, err := getAll[domain.Session](ctx, conn(ctx, r.db), query, userID)
+	if err != nil {
+		return nil, err
+	}
+	return sessions, nil
+}
+
+// Touch takes a session ID and sets the time the session was last seen.
+// To avoid a write on every request, the time is only updated if it is older than a minute.
+func (r *SessionRepo) Touch(ctx context.Context, id int) (err error) {
+	const query = "UPDATE sessions SET last_seen_at = now() WHERE id = $1 AND last_seen_at < now() - interval '1 minute'"
+	ctx, span := startSpan(ctx, "SessionRepo.Touch", query)
+	defer func() { endSpan(span, err) }()
+
+	_, err = conn(ctx, r.db).Exec(ctx, query, id)
+	return err
+}
+
+// Revoke takes a session ID and a user ID and revokes the session of the user.
+// If the session is not found or already revoked, it returns a domain.ErrNotFound.
+func (r *SessionRepo) Revoke(ctx context.Context, id, userID int) (err error) {
+	const query = "UPDATE sessions SET revoked_at = now() WHERE id = $1 AND user_id = $2 AND revoked_at IS NULL"
+	ctx, span := startSpan(ctx, "SessionRepo.Revoke", query)
+	defer func() { endSpan(span, err) }()
+
+	result, err := conn(ctx, r.db).Exec(ctx, query, id, userID)
+	if err != nil {
+		return err
+	}
+
+	if result.RowsAffected() == 0 {
+		return domain.ErrNotFound
+	}
+
+	return nil
+}
+
+// RevokeUser takes a user ID and revokes all sessions of the user.
+// It returns the number of revoked sessions or an error if the operation fails.
+func (r *SessionRepo) RevokeUser(ctx context.Context, userID int) (_ int64, err error) {
+	const query = "UPDATE sessions SET revoked_at = now() WHERE user_id = $1 AND revoked_at IS NULL"
+	ctx, span := startSpan(ctx, "SessionRepo.RevokeUser", query)
+	defer func() { endSpan(span, err) }()
+
+	result, err := conn(ctx, r.db).Exec(ctx, query, userID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+// DeleteExpired deletes all sessions that reached their absolute expiry.
+// It returns the number of deleted sessions or an error if the operation fails.
+func (r *SessionRepo) DeleteExpired(ctx context.Context) (_ int64, err error) {
+	const query = "DELETE FROM sessions WHERE expires_at < now()"
+	ctx, span := startSpan(ctx, "SessionRepo.DeleteExpired", query)
+	defer func() { endSpan(span, err) }()
+
+	result, err := conn(ctx, r.db).Exec(ctx, query)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
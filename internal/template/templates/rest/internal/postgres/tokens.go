@@ -0,0 +1,114 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+
+	"example.com/rest/internal/domain"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+type RefreshTokenRepo struct {
+	db *pgxpool.Pool
+}
+
+func NewRefreshTokenRepo(db *pgxpool.Pool) *RefreshTokenRepo {
+	return &RefreshTokenRepo{db: db}
+}
+
+// Insert takes a refresh token and inserts it into the database.
+// It returns an error if the operation fails.
+func (r *RefreshTokenRepo) Insert(ctx context.Context, token *domain.RefreshToken) (err error) {
+	const query = "INSERT INTO refresh_tokens (user_id, family_id, token_hash, expires_at) VALUES ($1, $2, $3, $4)"
+	ctx, span := startSpan(ctx, "RefreshTokenRepo.Insert", query)
+	defer func() { endSpan(span, err) }()
+
+	_, err = conn(ctx, r.db).Exec(ctx, query, token.UserID, token.FamilyID, token.TokenHash, token.ExpiresAt)
+	return err
+}
+
+// GetByHash takes a token hash and finds the refresh token in the database.
+// It returns the token or an error if the operation fails.
+// If the token is not found, it returns a domain.ErrNotFound.
+func (r *RefreshTokenRepo) GetByHash(ctx context.Context, tokenHash string) (_ *domain.RefreshToken, err error) {
+	const query = "SELECT * FROM refresh_tokens WHERE token_hash = $1"
+	ctx, span := startSpan(ctx, "RefreshTokenRepo.GetByHash", query)
+	defer func() { endSpan(span, err) }()
+
+	token, err := getOne[domain.RefreshToken](ctx, conn(ctx, r.db), query, tokenHash)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, domain.ErrNotFound
+		}
+		return nil, err
+	}
+	return token, nil
+}
+
+// Rotate takes the ID of a refresh token and its successor and exchanges the token for the successor
+// in one statement: the token is marked as used and the successor is inserted into the same family.
+// Only an unused and not revoked token can be rotated, so a token can be exchanged only once,
+// even by concurrent requests. Otherwise it returns a domain.ErrConflict.
+func (r *RefreshTokenRepo) Rotate(ctx context.Context, id int, next *domain.RefreshToken) (err error) {
+	const query = `WITH used AS (
+		UPDATE refresh_tokens SET used_at = now() WHERE id = $1 AND used_at IS NULL AND revoked_at IS NULL
+		RETURNING user_id, family_id
+	)
+	INSERT INTO refresh_tokens (user_id, family_id, token_hash, expires_at) SELECT user_id, family_id, $2, $3 FROM used`
+	ctx, span := startSpan(ctx, "RefreshTokenRepo.Rotate", query)
+	defer func() { endSpan(span, err) }()
+
+	result, err := conn(ctx, r.db).Exec(ctx, query, id, next.TokenHash, next.ExpiresAt)
+	if err != nil {
+		return err
+	}
+
+	if result.RowsAffected() == 0 {
+		return domain.ErrConflict
+	}
+
+	return nil
+}
+
+// RevokeFamily takes a family ID and revokes all tokens of the family.
+// It returns the number of revoked tokens or an error if the operation fails.
+func (r *RefreshTokenRepo) RevokeFamily(ctx context.Context, familyID string) (_ int64, err error) {
+	const query = "UPDATE refresh_tokens SET revoked_at = now() WHERE family_id = $1 AND revoked_at IS NULL"
+	ctx, span := startSpan(ctx, "RefreshTokenRepo.RevokeFamily", query)
+	defer func() { endSpan(span, err) }()
+
+	result, err := conn(ctx, r.db).Exec(ctx, query, familyID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+// RevokeUser takes a user ID and revokes all tokens of the user.
+// It returns the number of revoked tokens or an error if the operation fails.
+func (r *RefreshTokenRepo) RevokeUser(ctx context.Context, userID int) (_ int64, err error) {
+	const query = "UPDATE refresh_tokens SET revoked_at = now() WHERE user_id = $1 AND revoked_at IS NULL"
+	ctx, span := startSpan(ctx, "RefreshTokenRepo.RevokeUser", query)
+	defer func() { endSpan(span, err) }()
+
+	result, err := conn(ctx, r.db).Exec(ctx, query, userID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+// DeleteExpired deletes all expired tokens from the database.
+// It returns the number of deleted tokens or an error if the operation fails.
+func (r *RefreshTokenRepo) DeleteExpired(ctx context.Context) (_ int64, err error) {
+	const query = "DELETE FROM refresh_tokens WHERE expires_at < now()"
+	ctx, span := startSpan(ctx, "RefreshTokenRepo.DeleteExpired", query)
+	defer func() { endSpan(span, err) }()
+
+	result, err := conn(ctx, r.db).Exec(ctx, query)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
@@ -0,0 +1,212 @@
+package postgres
+
+import (
+	"context"
+	"math/rand/v2"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// TxOptions configures the transactions of a TxManager.
+type TxOptions struct {
+	Isolation  pgx.TxIsoLevel // empty uses the default of the database, read committed unless configured otherwise
+	ReadOnly   bool
+	MaxRetries int // how often the function is run again after a serialization failure or deadlock
+}
+
+// TxManager runs functions in a transaction that spans multiple repositories.
+// The transaction is placed in the context passed to the function, repositories called with that context
+// run their queries in it. Nested calls run in a savepoint of the outer transaction, so a failed nested call
+// is rolled back without aborting the outer transaction.
+type TxManager struct {
+	db       *pgxpool.Pool
+	defaults TxOptions
+}
+
+func NewTxManager(db *pgxpool.Pool, defaults TxOptions) *TxManager {
+	return &TxManager{
+		db:       db,
+		defaults: defaults,
+	}
+}
+
+// txKey is the context key of the transaction.
+// The transaction must not be used concurrently, so neither must the context.
+type txKey struct{}
+
+// WithinTx runs fn in a transaction with the default options, see WithinTxOptions.
+func (m *TxManager) WithinTx(ctx context.Context, fn func(ctx context.Context) error) error {
+	return m.WithinTxOptions(ctx, m.defaults, fn)
+}
+
+// WithinTxOptions runs fn in a transaction, which is committed if fn returns nil and rolled back otherwise.
+// After a serialization failure or deadlock, the transaction is rolled back and fn is run again in a new one,
+// up to MaxRetries times, so fn must not have side effects outside of the database.
+// Within a transaction, fn runs in a savepoint and the options are ignored, only the outermost call retries.
+func (m *TxManager) WithinTxOptions(ctx context.Context, opts TxOptions, fn func(ctx context.Context) error) error {
+	if tx, ok := ctx.Value(txKey{}).(pgx.Tx); ok {
+		return savepoint(ctx, tx, fn)
+	}
+
+	for attempt := 0; ; attempt++ {
+		err := m.run(ctx, opts, fn)
+		if err == nil || attempt >= opts.MaxRetries || !isRetryable(err) {
+			return err
+		}
+
+		// back off with jitter, so the conflicting transactions don't collide again
+		backoff := time.Duration(10<<attempt)*time.Millisecond + rand.N(10*time.Millisecond)
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(backoff):
+		}
+	}
+}
+
+// run runs fn in a new transaction.
+func (m *TxManager) run(ctx context.Context, opts TxOptions, fn func(ctx context.Context) error) (err error) {
+	ctx, span := startSpan(ctx, "TxManager.WithinTx", "")
+	defer func() { endSpan(span, err) }()
+
+	accessMode := pgx.ReadWrite
+	if opts.ReadOnly {
+		accessMode = pgx.ReadOnly
+	}
+	tx, err := m.db.BeginTx(ctx, pgx.TxOptions{IsoLevel: opts.Isolation, AccessMode: accessMode})
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	err = fn(context.WithValue(ctx, txKey{}, tx))
+	if err != nil {
+		return err
+	}
+
+	// serializable transactions can fail on commit
+	return mapError(tx.Commit(ctx))
+}
+
+// savepoint runs fn in a savepoint of the transaction, pgx names the savepoints of nested transactions.
+func savepoint(ctx context.Context, tx pgx.Tx, fn func(ctx context.Context) error) (err error) {
+	ctx, span := startSpan(ctx, "TxManager.Savepoint", "SAVEPOINT")
+	defer func() { endSpan(span, err) }()
+
+	nested, err := tx.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer nested.Rollback(ctx)
+
+	err = fn(context.WithValue(ctx, txKey{}, nested))
+	if err != nil {
+		return err
+	}
+
+	return nested.Commit(ctx)
+}
+
+// withinTx runs fn in a transaction without retries, for repository methods with multiple statements.
+// Called within a transaction of a TxManager, fn runs in a savepoint of it.
+func withinTx(ctx context.Context, db *pgxpool.Pool, fn func(ctx context.Context) error) error {
+	return NewTxManager(db, TxOptions{}).WithinTx(ctx, fn)
+}
+
+// inTx reports whether the context carries a transaction.
+func inTx(ctx context.Context) bool {
+	_, ok := ctx.Value(txKey{}).(pgx.Tx)
+	return ok
+}
+
+// queryer runs queries, it is implemented by *pgxpool.Pool and pgx.Tx.
+type queryer interface {
+	Exec(ctx context.Context, sql string, args ...any) (pgconn.CommandTag, error)
+	Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error)
+	QueryRow(ctx context.Context, sql string, args ...any) pgx.Row
+	SendBatch(ctx context.Context, batch *pgx.Batch) pgx.BatchResults
+	CopyFrom(ctx context.Context, table pgx.Identifier, columns []string, rows pgx.CopyFromSource) (int64, error)
+}
+
+// conn returns the transaction of the context, or else the connection pool.
+// Repositories run all queries on it, so they take part in the transactions of a TxManager
+// and get the errors of the database mapped onto the repository errors of the domain, see mapError.
+func conn(ctx context.Context, db *pgxpool.Pool) queryer {
+	if tx, ok := ctx.Value(txKey{}).(pgx.Tx); ok {
+		return mappedConn{q: tx}
+	}
+	return mappedConn{q: db}
+}
+
+// mappedConn runs queries on a queryer and maps their errors, see mapError.
+// The errors of rows and batches are mapped when they are read.
+type mappedConn struct {
+	q queryer
+}
+
+func (c mappedConn) Exec(ctx context.Context, sql string, args ...any) (pgconn.CommandTag, error) {
+	tag, err := c.q.Exec(ctx, sql, args...)
+	return tag, mapError(err)
+}
+
+func (c mappedConn) Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error) {
+	rows, err := c.q.Query(ctx, sql, args...)
+	return mappedRows{Rows: rows}, mapError(err)
+}
+
+func (c mappedConn) QueryRow(ctx context.Context, sql string, args ...any) pgx.Row {
+	return mappedRow{row: c.q.QueryRow(ctx, sql, args...)}
+}
+
+func (c mappedConn) SendBatch(ctx context.Context, batch *pgx.Batch) pgx.BatchResults {
+	return mappedBatchResults{BatchResults: c.q.SendBatch(ctx, batch)}
+}
+
+func (c mappedConn) CopyFrom(ctx context.Context, table pgx.Identifier, columns []string, rows pgx.CopyFromSource) (int64, error) {
+	n, err := c.q.CopyFrom(ctx, table, columns, rows)
+	return n, mapError(err)
+}
+
+// mappedRows maps the error of the rows, which holds the error of the query.
+type mappedRows struct {
+	pgx.Rows
+}
+
+func (r mappedRows) Err() error {
+	return mapError(r.Rows.Err())
+}
+
+// mappedRow maps the error of the scan, which holds the error of the query.
+type mappedRow struct {
+	row pgx.Row
+}
+
+func (r mappedRow) Scan(dest ...any) error {
+	return mapError(r.row.Scan(dest...))
+}
+
+// mappedBatchResults maps the errors of the queries of a batch.
+type mappedBatchResults struct {
+	pgx.BatchResults
+}
+
+func (b mappedBatchResults) Exec() (pgconn.CommandTag, error) {
+	tag, err := b.BatchResults.Exec()
+	return tag, mapError(err)
+}
+
+func (b mappedBatchResults) Query() (pgx.Rows, error) {
+	rows, err := b.BatchResults.Query()
+	return mappedRows{Rows: rows}, mapError(err)
+}
+
+func (b mappedBatchResults) QueryRow() pgx.Row {
+	return mappedRow{row: b.BatchResults.QueryRow()}
+}
+
+func (b mappedBatchResults) Close() error {
+	return mapError(b.BatchResults.Close())
+}
@@ -2,30 +2,31 @@ package postgres
 
 import (
 	"context"
-	"database/sql"
+	"errors"
 
 	"example.com/rest/internal/domain"
-	"github.com/jmoiron/sqlx"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
 )
 
 type UserRepo struct {
-	db *sqlx.DB
+	db *pgxpool.Pool
 }
 
-func NewUserRepo(db *sqlx.DB) *UserRepo {
+func NewUserRepo(db *pgxpool.Pool) *UserRepo {
 	return &UserRepo{db: db}
 }
 
 // Insert takes an email and a password hash and inserts a new user into the database.
 // It returns the ID of the created user or an error if the operation fails.
-// If the user already exists, it returns an ErrConflict.
-func (r *UserRepo) Insert(ctx context.Context, email, passwordHash string) (int, error) {
-	var id int
-	err := r.db.QueryRowxContext(ctx, "INSERT INTO users (email, password_hash) VALUES ($1, $2) ON CONFLICT DO NOTHING RETURNING id", email, passwordHash).Scan(&id)
+// If the user already exists, it returns a domain.ErrConflict.
+func (r *UserRepo) Insert(ctx context.Context, email, passwordHash string) (id int, err error) {
+	const query = "INSERT INTO users (email, password_hash) VALUES ($1, $2) RETURNING id"
+	ctx, span := startSpan(ctx, "UserRepo.Insert", query)
+	defer func() { endSpan(span, err) }()
+
+	err = conn(ctx, r.db).QueryRow(ctx, query, email, passwordHash).Scan(&id)
 	if err != nil {
-		if err == sql.ErrNoRows {
-			return 0, ErrConflict
-		}
 		return 0, err
 	}
 	return id, nil
@@ -33,67 +34,129 @@ func (r *UserRepo) Insert(ctx context.Context, email, passwordHash string) (int,
 
 // GetByID takes a user ID and finds the user in the database.
 // It returns the user or an error if the operation fails.
-// If the user is not found, it returns an ErrNotFound.
-func (r *UserRepo) GetByID(ctx context.Context, id int) (*domain.User, error) {
-	var user domain.User
-	err := r.db.QueryRowxContext(ctx, "SELECT * FROM users WHERE id = $1", id).StructScan(&user)
+// If the user is not found, it returns a domain.ErrNotFound.
+func (r *UserRepo) GetByID(ctx context.Context, id int) (_ *domain.User, err error) {
+	const query = "SELECT * FROM users WHERE id = $1"
+	ctx, span := startSpan(ctx, "UserRepo.GetByID", query)
+	defer func() { endSpan(span, err) }()
+
+	user, err := getOne[domain.User](ctx, conn(ctx, r.db), query, id)
 	if err != nil {
-		if err == sql.ErrNoRows {
-			return nil, ErrNotFound
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, domain.ErrNotFound
 		}
 		return nil, err
 	}
-	return &user, nil
+	return user, nil
 }
 
 // GetByEmail takes an email and finds the user in the database.
 // It returns the user or an error if the operation fails.
-// If the user is not found, it returns an ErrNotFound.
-func (r *UserRepo) GetByEmail(ctx context.Context, email string) (*domain.User, error) {
-	var user domain.User
-	err := r.db.QueryRowxContext(ctx, "SELECT * FROM users WHERE email = $1", email).StructScan(&user)
+// If the user is not found, it returns a domain.ErrNotFound.
+func (r *UserRepo) GetByEmail(ctx context.Context, email string) (_ *domain.User, err error) {
+	const query = "SELECT * FROM users WHERE email = $1"
+	ctx, span := startSpan(ctx, "UserRepo.GetByEmail", query)
+	defer func() { endSpan(span, err) }()
+
+	user, err := getOne[domain.User](ctx, conn(ctx, r.db), query, email)
 	if err != nil {
-		if err == sql.ErrNoRows {
-			return nil, ErrNotFound
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, domain.ErrNotFound
 		}
 		return nil, err
 	}
-	return &user, nil
+	return user, nil
+}
+
+// List returns a page of users ordered by ID.
+// It returns the users or an error if the operation fails.
+func (r *UserRepo) List(ctx context.Context, limit, offset int) (_ []*domain.User, err error) {
+	const query = "SELECT * FROM users ORDER BY id LIMIT $1 OFFSET $2"
+	ctx, span := startSpan(ctx, "UserRepo.List", query)
+	defer func() { endSpan(span, err) }()
+
+	users, err := getAll[domain.User](ctx, conn(ctx, r.db), query, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	return users, nil
 }
 
 // Update takes a user object and updates the user in the database overwriting the existing user.
 // It returns the updated user or an error if the operation fails.
-// If the user is not found (based on the user ID and version), it returns an ErrNotFound.
-func (r *UserRepo) Update(ctx context.Context, user *domain.User) (*domain.User, error) {
+// If the user is not found, it returns a domain.ErrNotFound, if it has another version by now, a domain.ErrStaleVersion.
+func (r *UserRepo) Update(ctx context.Context, user *domain.User) (_ *domain.User, err error) {
+	const query = "UPDATE users SET email = $1, email_verified_at = $2, password_hash = $3, updated_at = now(), version = version + 1 WHERE id = $4 AND version = $5 RETURNING *"
+	ctx, span := startSpan(ctx, "UserRepo.Update", query)
+	defer func() { endSpan(span, err) }()
+
 	// update the user with the new user object
-	var updated domain.User
-	err := r.db.QueryRowxContext(ctx, "UPDATE users SET email = $1, password_hash = $2, updated_at = now(), version = version + 1 WHERE id = $3 AND version = $4 RETURNING *", user.Email, user.PasswordHash, user.ID, user.Version).StructScan(&updated)
+	updated, err := getOne[domain.User](ctx, conn(ctx, r.db), query, user.Email, user.EmailVerifiedAt, user.PasswordHash, user.ID, user.Version)
 	if err != nil {
-		if err == sql.ErrNoRows {
-			return nil, ErrNotFound
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, r.missing(ctx, user.ID)
 		}
 		return nil, err
 	}
-	return &updated, nil
+	return updated, nil
 }
 
-// Delete takes a user ID and deletes the user from the database.
-// It returns an error if the operation fails.
-// If the user is not found, it returns an ErrNotFound.
-func (r *UserRepo) Delete(ctx context.Context, id int) error {
-	result, err := r.db.ExecContext(ctx, "DELETE FROM users WHERE id = $1", id)
+// UpdatePasswordHash takes a user ID, the current and a new password hash and replaces the hash,
+// e.g. with a hash of a newer algorithm. The version is kept, as the user didn't change.
+// If the user is not found or has another hash by now, it returns a domain.ErrNotFound.
+func (r *UserRepo) UpdatePasswordHash(ctx context.Context, id int, oldHash, newHash string) (err error) {
+	const query = "UPDATE users SET password_hash = $3 WHERE id = $1 AND password_hash = $2"
+	ctx, span := startSpan(ctx, "UserRepo.UpdatePasswordHash", query)
+	defer func() { endSpan(span, err) }()
+
+	result, err := conn(ctx, r.db).Exec(ctx, query, id, oldHash, newHash)
 	if err != nil {
 		return err
 	}
 
-	rowsAffected, err := result.RowsAffected()
+	if result.RowsAffected() == 0 {
+		return domain.ErrNotFound
+	}
+
+	return nil
+}
+
+// Delete takes a user ID and a version and deletes the user from the database.
+// A version of 0 deletes the user regardless of its version.
+// It returns an error if the operation fails.
+// If the user is not found, it returns a domain.ErrNotFound, if it has another version by now, a domain.ErrStaleVersion.
+func (r *UserRepo) Delete(ctx context.Context, id, version int) (err error) {
+	const query = "DELETE FROM users WHERE id = $1 AND ($2 = 0 OR version = $2)"
+	ctx, span := startSpan(ctx, "UserRepo.Delete", query)
+	defer func() { endSpan(span, err) }()
+
+	result, err := conn(ctx, r.db).Exec(ctx, query, id, version)
 	if err != nil {
 		return err
 	}
 
-	if rowsAffected == 0 {
-		return ErrNotFound
+	if result.RowsAffected() == 0 {
+		return r.missing(ctx, id)
 	}
 
 	return nil
 }
+
+// missing returns the error of an update or delete of the user that matched no row,
+// a domain.ErrStaleVersion if the user still exists and a domain.ErrNotFound otherwise.
+func (r *UserRepo) missing(ctx context.Context, id int) (err error) {
+	const query = "SELECT EXISTS (SELECT 1 FROM users WHERE id = $1)"
+	ctx, span := startSpan(ctx, "UserRepo.missing", query)
+	defer func() { endSpan(span, err) }()
+
+	var exists bool
+	err = conn(ctx, r.db).QueryRow(ctx, query, id).Scan(&exists)
+	if err != nil {
+		return err
+	}
+
+	if exists {
+		return domain.ErrStaleVersion
+	}
+	return domain.ErrNotFound
+}
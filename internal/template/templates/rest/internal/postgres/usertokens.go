@@ -0,0 +1,104 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+
+	"example.com/rest/internal/domain"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+type UserTokenRepo struct {
+	db *pgxpool.Pool
+}
+
+func NewUserTokenRepo(db *pgxpool.Pool) *UserTokenRepo {
+	return &UserTokenRepo{db: db}
+}
+
+// Insert takes a user token and inserts it into the database.
+// It returns an error if the operation fails.
+func (r *UserTokenRepo) Insert(ctx context.Context, token *domain.UserToken) (err error) {
+	const query = "INSERT INTO user_tokens (user_id, purpose, token_hash, email, expires_at) VALUES ($1, $2, $3, $4, $5)"
+	ctx, span := startSpan(ctx, "UserTokenRepo.Insert", query)
+	defer func() { endSpan(span, err) }()
+
+	_, err = conn(ctx, r.db).Exec(ctx, query, token.UserID, token.Purpose, token.TokenHash, token.Email, token.ExpiresAt)
+	return err
+}
+
+// Consume takes a token hash and a purpose and marks the matching token as used.
+// Only an unused and unexpired token can be consumed, so a token can be used only once, even by concurrent requests.
+// It returns the consumed token or an error if the operation fails.
+// If no such token is found, it returns a domain.ErrNotFound.
+func (r *UserTokenRepo) Consume(ctx context.Context, tokenHash string, purpose domain.TokenPurpose) (_ *domain.UserToken, err error) {
+	const query = "UPDATE user_tokens SET used_at = now() WHERE token_hash = $1 AND purpose = $2 AND used_at IS NULL AND expires_at > now() RETURNING *"
+	ctx, span := startSpan(ctx, "UserTokenRepo.Consume", query)
+	defer func() { endSpan(span, err) }()
+
+	token, err := getOne[domain.UserToken](ctx, conn(ctx, r.db), query, tokenHash, purpose)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, domain.ErrNotFound
+		}
+		return nil, err
+	}
+	return token, nil
+}
+
+// ResetPassword takes the hash of a password reset token and a new password hash, consumes the token
+// and sets the password of its user in one statement, so the token is only used up if the password is set.
+// The email of the user counts as verified, tokens sent to an email the user no longer has don't match.
+// It returns the updated user or an error if the operation fails.
+// If no such token is found, it returns a domain.ErrNotFound.
+func (r *UserTokenRepo) ResetPassword(ctx context.Context, tokenHash, passwordHash string) (_ *domain.User, err error) {
+	const query = `WITH token AS (
+		UPDATE user_tokens SET used_at = now()
+		WHERE token_hash = $1 AND purpose = 'reset_password' AND used_at IS NULL AND expires_at > now()
+		RETURNING user_id, email
+	)
+	UPDATE users SET password_hash = $2, email_verified_at = coalesce(email_verified_at, now()), updated_at = now(), version = version + 1
+	FROM token WHERE users.id = token.user_id AND users.email = token.email
+	RETURNING users.*`
+	ctx, span := startSpan(ctx, "UserTokenRepo.ResetPassword", query)
+	defer func() { endSpan(span, err) }()
+
+	user, err := getOne[domain.User](ctx, conn(ctx, r.db), query, tokenHash, passwordHash)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, domain.ErrNotFound
+		}
+		return nil, err
+	}
+	return user, nil
+}
+
+// InvalidateUser takes a user ID and a purpose and marks all unused tokens of the user for the purpose as used,
+// e.g. the other reset links once the password was reset.
+// It returns the number of invalidated tokens or an error if the operation fails.
+func (r *UserTokenRepo) InvalidateUser(ctx context.Context, userID int, purpose domain.TokenPurpose) (_ int64, err error) {
+	const query = "UPDATE user_tokens SET used_at = now() WHERE user_id = $1 AND purpose = $2 AND used_at IS NULL"
+	ctx, span := startSpan(ctx, "UserTokenRepo.InvalidateUser", query)
+	defer func() { endSpan(span, err) }()
+
+	result, err := conn(ctx, r.db).Exec(ctx, query, userID, purpose)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+// DeleteExpired deletes all expired tokens from the database.
+// It returns the number of deleted tokens or an error if the operation fails.
+func (r *UserTokenRepo) DeleteExpired(ctx context.Context) (_ int64, err error) {
+	const query = "DELETE FROM user_tokens WHERE expires_at < now()"
+	ctx, span := startSpan(ctx, "UserTokenRepo.DeleteExpired", query)
+	defer func() { endSpan(span, err) }()
+
+	result, err := conn(ctx, r.db).Exec(ctx, query)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
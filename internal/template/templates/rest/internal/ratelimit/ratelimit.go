@@ -0,0 +1,61 @@
+package ratelimit
+
+import (
+	"context"
+	"math"
+	"time"
+)
+
+// Limit allows Requests requests per Window.
+// It is enforced with a token bucket that holds Requests tokens and refills completely over Window,
+// so short bursts up to Requests are allowed while the average rate stays at Requests per Window.
+type Limit struct {
+	Requests int
+	Window   time.Duration
+}
+
+// rate returns the number of tokens added to the bucket per second.
+func (l Limit) rate() float64 {
+	return float64(l.Requests) / l.Window.Seconds()
+}
+
+// Result is the outcome of taking a token from a bucket.
+type Result struct {
+	Allowed    bool          // whether the request may proceed
+	Limit      int           // bucket capacity
+	Remaining  int           // whole tokens left in the bucket
+	Reset      time.Duration // time until the bucket is full again
+	RetryAfter time.Duration // time until the next token is available, only set if not allowed
+}
+
+// Store keeps the token buckets.
+type Store interface {
+	// Take removes a token from the bucket identified by key.
+	Take(ctx context.Context, key string, limit Limit) (Result, error)
+}
+
+// NewResult creates a result from the tokens left in a bucket after a take.
+// It is used by Store implementations.
+func NewResult(limit Limit, tokens float64, allowed bool) Result {
+	rate := limit.rate()
+	result := Result{
+		Allowed:   allowed,
+		Limit:     limit.Requests,
+		Remaining: max(int(math.Floor(tokens)), 0),
+		Reset:     seconds((float64(limit.Requests) - tokens) / rate),
+	}
+	if !allowed {
+		result.RetryAfter = seconds((1 - tokens) / rate)
+	}
+	return result
+}
+
+// refill returns the tokens in a bucket after elapsed time, capped at the bucket capacity.
+func refill(limit Limit, tokens float64, elapsed time.Duration) float64 {
+	return min(float64(limit.Requests), tokens+elapsed.Seconds()*limit.rate())
+}
+
+// seconds converts fractional seconds to a duration.
+func seconds(s float64) time.Duration {
+	return time.Duration(s * float64(time.Second))
+}
@@ -0,0 +1,330 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"example.com/rest/internal/domain"
+	"example.com/rest/internal/logging"
+)
+
+// Lifetimes of the tokens sent by email.
+const (
+	verifyEmailTTL   = 48 * time.Hour
+	resetPasswordTTL = time.Hour
+)
+
+// AccountService verifies email addresses and resets forgotten passwords with tokens sent by email.
+// Tokens are random strings like refresh tokens, they are stored hashed, expire and can be used only once.
+type AccountService struct {
+	userRepo  UserRepo
+	tokenRepo UserTokenRepo
+	tx        Transactor
+	passwords *Passwords
+	throttle  *LoginThrottle
+	audit     *AuditService
+	revokers  []CredentialRevoker
+	mailer    Mailer
+	appURL    string
+	sending   sync.WaitGroup // emails sent in the background, see Wait
+}
+
+type UserTokenRepo interface {
+	Insert(ctx context.Context, token *domain.UserToken) error
+	Consume(ctx context.Context, tokenHash string, purpose domain.TokenPurpose) (*domain.UserToken, error)
+	ResetPassword(ctx context.Context, tokenHash, passwordHash string) (*domain.User, error)
+	InvalidateUser(ctx context.Context, userID int, purpose domain.TokenPurpose) (int64, error)
+	DeleteExpired(ctx context.Context) (int64, error)
+}
+
+// CredentialRevoker revokes the credentials of a user, e.g. refresh tokens, sessions or API keys.
+type CredentialRevoker interface {
+	RevokeUser(ctx context.Context, userID int) (int64, error)
+}
+
+// Mailer renders an email from a template and sends it, see the mail package.
+type Mailer interface {
+	Send(ctx context.Context, to, template string, data any) error
+}
+
+// NewAccountService creates a new account service.
+// The links in the emails point to appURL, e.g. "https://app.example.com/verify-email?token=...",
+// the app posts the token to the API. The revokers are called when a password is reset.
+func NewAccountService(userRepo UserRepo, tokenRepo UserTokenRepo, tx Transactor, passwords *Passwords, throttle *LoginThrottle, audit *AuditService, mailer Mailer, appURL string, revokers ...CredentialRevoker) *AccountService {
+	return &AccountService{
+		userRepo:  userRepo,
+		tokenRepo: tokenRepo,
+		tx:        tx,
+		passwords: passwords,
+		throttle:  throttle,
+		audit:     audit,
+		revokers:  revokers,
+		mailer:    mailer,
+		appURL:    strings.TrimSuffix(appURL, "/"),
+	}
+}
+
+// errInvalidUserToken is returned for tokens that are unknown, expired or used.
+var errInvalidUserToken = domain.Errorf(domain.INVALID_ERROR, "invalid or expired token")
+
+// emailData is passed to the email templates.
+type emailData struct {
+	Email     string
+	URL       string
+	ExpiresIn string
+}
+
+// SendVerification sends an email with a verification link to the user.
+// Links sent before stop working, only the latest one can be used.
+func (s *AccountService) SendVerification(ctx context.Context, userID int) (err error) {
+	ctx, span := startSpan(ctx, "AccountService.SendVerification")
+	defer func() { endSpan(span, err) }()
+
+	user, err := s.userRepo.GetByID(ctx, userID)
+	if err != nil {
+		if errors.Is(err, domain.ErrNotFound) {
+			return domain.Errorf(domain.NOTFOUND_ERROR, "user not found")
+		}
+		return err
+	}
+
+	if user.EmailVerifiedAt != nil {
+		return domain.Errorf(domain.CONFLICT_ERROR, "email already verified")
+	}
+
+	return s.send(ctx, user, domain.PurposeVerifyEmail, verifyEmailTTL, "/verify-email", "verify_email")
+}
+
+// VerifyEmail marks the email of the user as verified.
+// The token only verifies the address it was sent to, not an address the user changed to since.
+func (s *AccountService) VerifyEmail(ctx context.Context, req *domain.VerifyEmailRequest) (_ *domain.User, err error) {
+	ctx, span := startSpan(ctx, "AccountService.VerifyEmail")
+	defer func() { endSpan(span, err) }()
+
+	// validate input
+	err = req.Validate()
+	if err != nil {
+		return nil, err
+	}
+
+	user, err := s.consume(ctx, req.Token, domain.PurposeVerifyEmail)
+	if err != nil {
+		return nil, err
+	}
+
+	if user.EmailVerifiedAt != nil {
+		return user, nil
+	}
+
+	now := time.Now()
+	user.EmailVerifiedAt = &now
+	user, err = s.update(ctx, user)
+	if err != nil {
+		return nil, err
+	}
+
+	logging.FromContext(ctx).Info("email verified", "verified_user_id", user.ID)
+	return user, nil
+}
+
+// ForgotPassword sends an email with a reset link if a user with the email exists.
+// The email is sent in the background and the result is the same for unknown emails,
+// so neither the response nor its timing reveal whether an account exists.
+func (s *AccountService) ForgotPassword(ctx context.Context, req *domain.ForgotPasswordRequest) (err error) {
+	ctx, span := startSpan(ctx, "AccountService.ForgotPassword")
+	defer func() { endSpan(span, err) }()
+
+	// validate input
+	err = req.Validate()
+	if err != nil {
+		return err
+	}
+
+	// keep the request logger and trace, but don't stop when the request ends
+	s.sending.Add(1)
+	go func(ctx context.Context) {
+		defer s.sending.Done()
+		if err := s.sendReset(ctx, req.Email); err != nil {
+			logging.FromContext(ctx).Error("failed to send password reset email", "error", err)
+		}
+	}(context.WithoutCancel(ctx))
+
+	return nil
+}
+
+// Wait waits for the emails that are still being sent in the background.
+// It is called on shutdown, after the server stopped accepting requests.
+func (s *AccountService) Wait() {
+	s.sending.Wait()
+}
+
+// sendReset sends the reset email to the user with the email, unknown emails are ignored.
+func (s *AccountService) sendReset(ctx context.Context, email string) (err error) {
+	ctx, span := startSpan(ctx, "AccountService.sendReset")
+	defer func() { endSpan(span, err) }()
+
+	user, err := s.userRepo.GetByEmail(ctx, email)
+	if err != nil {
+		if errors.Is(err, domain.ErrNotFound) {
+			logging.FromContext(ctx).Info("password reset requested for unknown email")
+			return nil
+		}
+		return err
+	}
+
+	return s.send(ctx, user, domain.PurposeResetPassword, resetPasswordTTL, "/reset-password", "reset_password")
+}
+
+// ResetPassword sets a new password for the user of the token.
+// All reset links of the user stop working, the user is logged out everywhere and their API keys are revoked,
+// as the old password may have been compromised. The email counts as verified, as the user received the link.
+// A locked account is unlocked, the user proved they own the email.
+func (s *AccountService) ResetPassword(ctx context.Context, req *domain.ResetPasswordRequest) (err error) {
+	ctx, span := startSpan(ctx, "AccountService.ResetPassword")
+	defer func() { endSpan(span, err) }()
+
+	// validate input
+	err = req.Validate()
+	if err != nil {
+		return err
+	}
+
+	passwordHash, err := s.passwords.hashNew(ctx, "new_password", req.NewPassword)
+	if err != nil {
+		return err
+	}
+
+	// the token is only used up if the whole reset succeeds
+	var userID int
+	err = s.tx.WithinTx(ctx, func(ctx context.Context) error {
+		user, err := s.tokenRepo.ResetPassword(ctx, hashToken(req.Token), passwordHash)
+		if err != nil {
+			if errors.Is(err, domain.ErrNotFound) {
+				return errInvalidUserToken
+			}
+			return err
+		}
+
+		_, err = s.tokenRepo.InvalidateUser(ctx, user.ID, domain.PurposeResetPassword)
+		if err != nil {
+			return err
+		}
+
+		for _, revoker := range s.revokers {
+			if _, err := revoker.RevokeUser(ctx, user.ID); err != nil {
+				return err
+			}
+		}
+
+		err = s.throttle.Reset(ctx, emailKey(user.Email))
+		if err != nil {
+			return err
+		}
+
+		s.audit.Record(ctx, domain.AuthEventPasswordReset, user.ID, user.Email)
+		userID = user.ID
+		return nil
+	})
+	if err != nil {
+		if errors.Is(err, domain.ErrSerializationFailure) {
+			return errSerializationFailure.Wrap(err)
+		}
+		return err
+	}
+
+	logging.FromContext(ctx).Info("password reset", "reset_user_id", userID)
+	return nil
+}
+
+// DeleteExpired removes all expired tokens and returns how many were removed.
+func (s *AccountService) DeleteExpired(ctx context.Context) (int64, error) {
+	return s.tokenRepo.DeleteExpired(ctx)
+}
+
+// send stores a new token for the purpose and emails the link with it to the user.
+func (s *AccountService) send(ctx context.Context, user *domain.User, purpose domain.TokenPurpose, ttl time.Duration, path, template string) error {
+	_, err := s.tokenRepo.InvalidateUser(ctx, user.ID, purpose)
+	if err != nil {
+		return err
+	}
+
+	token, err := generateRefreshToken()
+	if err != nil {
+		return err
+	}
+
+	err = s.tokenRepo.Insert(ctx, &domain.UserToken{
+		UserID:    user.ID,
+		Purpose:   purpose,
+		TokenHash: hashToken(token),
+		Email:     user.Email,
+		ExpiresAt: time.Now().Add(ttl),
+	})
+	if err != nil {
+		return err
+	}
+
+	return s.mailer.Send(ctx, user.Email, template, emailData{
+		Email:     user.Email,
+		URL:       s.appURL + path + "?token=" + url.QueryEscape(token),
+		ExpiresIn: formatTTL(ttl),
+	})
+}
+
+// consume uses up the token and returns its user.
+// Tokens sent to an email the user no longer has are rejected.
+func (s *AccountService) consume(ctx context.Context, token string, purpose domain.TokenPurpose) (*domain.User, error) {
+	userToken, err := s.tokenRepo.Consume(ctx, hashToken(token), purpose)
+	if err != nil {
+		if errors.Is(err, domain.ErrNotFound) {
+			return nil, errInvalidUserToken
+		}
+		return nil, err
+	}
+
+	user, err := s.userRepo.GetByID(ctx, userToken.UserID)
+	if err != nil {
+		if errors.Is(err, domain.ErrNotFound) {
+			return nil, errInvalidUserToken
+		}
+		return nil, err
+	}
+
+	if !strings.EqualFold(user.Email, userToken.Email) {
+		return nil, errInvalidUserToken
+	}
+	return user, nil
+}
+
+// update stores the user, a concurrent modification results in a conflict the client can retry.
+// The repository error stays wrapped, so a serialization failure is still retried in transactions.
+func (s *AccountService) update(ctx context.Context, user *domain.User) (*domain.User, error) {
+	updated, err := s.userRepo.Update(ctx, user)
+	if err != nil {
+		switch {
+		case errors.Is(err, domain.ErrNotFound):
+			return nil, domain.Errorf(domain.NOTFOUND_ERROR, "user not found").Wrap(err)
+		case errors.Is(err, domain.ErrStaleVersion):
+			return nil, domain.Errorf(domain.CONFLICT_ERROR, "update conflict").Wrap(err)
+		}
+		return nil, err
+	}
+	return updated, nil
+}
+
+// formatTTL formats the lifetime of a token for emails, e.g. "48 hours" instead of "48h0m0s".
+func formatTTL(ttl time.Duration) string {
+	switch {
+	case ttl == time.Hour:
+		return "1 hour"
+	case ttl%time.Hour == 0:
+		return fmt.Sprintf("%d hours", ttl/time.Hour)
+	default:
+		return fmt.Sprintf("%d minutes", ttl/time.Minute)
+	}
+}
@@ -0,0 +1,189 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base32"
+	"errors"
+	"strings"
+	"time"
+
+	"example.com/rest/internal/domain"
+	"example.com/rest/internal/logging"
+)
+
+// apiKeyTag starts every API key, so leaked keys are easy to recognize, e.g. by secret scanners.
+const apiKeyTag = "sk_"
+
+// APIKeyService manages the API keys of users and authenticates requests made with them.
+// API keys are random strings like refresh tokens, they are stored hashed and can be revoked.
+// A key acts as the user that created it, limited to the scopes of the key.
+type APIKeyService struct {
+	apiKeyRepo APIKeyRepo
+	grants     GrantRepo
+}
+
+type APIKeyRepo interface {
+	Insert(ctx context.Context, key *domain.APIKey) (*domain.APIKey, error)
+	GetByHash(ctx context.Context, keyHash string) (*domain.APIKey, error)
+	ListByUser(ctx context.Context, userID int) ([]*domain.APIKey, error)
+	TouchLastUsed(ctx context.Context, id int) error
+	Revoke(ctx context.Context, id, userID int) error
+}
+
+func NewAPIKeyService(repo APIKeyRepo, grants GrantRepo) *APIKeyService {
+	return &APIKeyService{
+		apiKeyRepo: repo,
+		grants:     grants,
+	}
+}
+
+// errInvalidAPIKey is returned for API keys that are unknown, expired or revoked.
+var errInvalidAPIKey = domain.Errorf(domain.UNAUTHORIZED_ERROR, "invalid api key")
+
+// Create creates an API key for the authenticated user.
+// It returns the stored key and the key itself, which is not stored and can't be shown again.
+// Keys can't create other keys, so a leaked key can't be used to persist access after it is revoked.
+func (s *APIKeyService) Create(ctx context.Context, userID int, req *domain.CreateAPIKeyRequest) (_ *domain.APIKey, _ string, err error) {
+	ctx, span := startSpan(ctx, "APIKeyService.Create")
+	defer func() { endSpan(span, err) }()
+
+	// validate input
+	err = req.Validate()
+	if err != nil {
+		return nil, "", err
+	}
+
+	if principal, ok := domain.PrincipalFromContext(ctx); ok && principal.APIKeyID != 0 {
+		return nil, "", domain.Errorf(domain.FORBIDDEN_ERROR, "api keys can't create api keys")
+	}
+
+	prefix, secret, err := generateAPIKey()
+	if err != nil {
+		return nil, "", err
+	}
+	rawKey := prefix + "_" + secret
+
+	scopes := req.Scopes
+	if scopes == nil {
+		scopes = []string{}
+	}
+
+	key, err := s.apiKeyRepo.Insert(ctx, &domain.APIKey{
+		UserID:    userID,
+		Name:      strings.TrimSpace(req.Name),
+		Prefix:    prefix,
+		KeyHash:   hashToken(rawKey),
+		Scopes:    scopes,
+		ExpiresAt: req.ExpiresAt,
+	})
+	if err != nil {
+		if errors.Is(err, domain.ErrForeignKeyViolation) {
+			// deleted concurrently
+			return nil, "", domain.Errorf(domain.NOTFOUND_ERROR, "user not found")
+		}
+		return nil, "", err
+	}
+
+	logging.FromContext(ctx).Info("api key created", "api_key_id", key.ID, "api_key_prefix", key.Prefix)
+	return key, rawKey, nil
+}
+
+// List returns the API keys of the user that are not revoked.
+func (s *APIKeyService) List(ctx context.Context, userID int) (_ []*domain.APIKey, err error) {
+	ctx, span := startSpan(ctx, "APIKeyService.List")
+	defer func() { endSpan(span, err) }()
+
+	err = Authorize(ctx, OwnsAccount(userID))
+	if err != nil {
+		return nil, err
+	}
+
+	return s.apiKeyRepo.ListByUser(ctx, userID)
+}
+
+// Revoke revokes the API key of the user, requests with the key are rejected immediately.
+func (s *APIKeyService) Revoke(ctx context.Context, userID, id int) (err error) {
+	ctx, span := startSpan(ctx, "APIKeyService.Revoke")
+	defer func() { endSpan(span, err) }()
+
+	err = Authorize(ctx, OwnsAccount(userID))
+	if err != nil {
+		return err
+	}
+
+	err = s.apiKeyRepo.Revoke(ctx, id, userID)
+	if err != nil {
+		if errors.Is(err, domain.ErrNotFound) {
+			return domain.Errorf(domain.NOTFOUND_ERROR, "api key not found")
+		}
+		return err
+	}
+
+	logging.FromContext(ctx).Info("api key revoked", "api_key_id", id)
+	return nil
+}
+
+// Authenticate validates the API key and returns the principal it acts as.
+// Unlike access tokens, the roles and permissions are read on every request,
+// so role changes and revocations take effect immediately.
+func (s *APIKeyService) Authenticate(ctx context.Context, rawKey string) (_ *domain.Principal, err error) {
+	ctx, span := startSpan(ctx, "APIKeyService.Authenticate")
+	defer func() { endSpan(span, err) }()
+
+	if !strings.HasPrefix(rawKey, apiKeyTag) {
+		return nil, errInvalidAPIKey
+	}
+
+	key, err := s.apiKeyRepo.GetByHash(ctx, hashToken(rawKey))
+	if err != nil {
+		if errors.Is(err, domain.ErrNotFound) {
+			return nil, errInvalidAPIKey
+		}
+		return nil, err
+	}
+
+	if key.RevokedAt != nil || (key.ExpiresAt != nil && time.Now().After(*key.ExpiresAt)) {
+		return nil, errInvalidAPIKey
+	}
+
+	err = s.apiKeyRepo.TouchLastUsed(ctx, key.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	roles, err := s.grants.GetUserRoles(ctx, key.UserID)
+	if err != nil {
+		return nil, err
+	}
+
+	permissions, err := s.grants.GetUserPermissions(ctx, key.UserID)
+	if err != nil {
+		return nil, err
+	}
+
+	principal := &domain.Principal{
+		UserID:      key.UserID,
+		Roles:       roles,
+		Permissions: permissions,
+		Scopes:      key.Scopes,
+		APIKeyID:    key.ID,
+	}
+	if key.ExpiresAt != nil {
+		principal.ExpiresAt = *key.ExpiresAt
+	}
+	return principal, nil
+}
+
+// apiKeyEncoding encodes keys without characters that need escaping or are easily confused when copied.
+var apiKeyEncoding = base32.NewEncoding("abcdefghijklmnopqrstuvwxyz234567").WithPadding(base32.NoPadding)
+
+// generateAPIKey returns the public prefix and the secret of a new key.
+// The prefix has 40 random bits to be unique, the secret 256 bits like refresh tokens.
+func generateAPIKey() (prefix, secret string, err error) {
+	b := make([]byte, 5+32)
+	if _, err := rand.Read(b); err != nil {
+		return "", "", err
+	}
+	return apiKeyTag + apiKeyEncoding.EncodeToString(b[:5]), apiKeyEncoding.EncodeToString(b[5:]), nil
+}
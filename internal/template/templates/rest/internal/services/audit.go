@@ -0,0 +1,78 @@
+package services
+
+import (
+	"context"
+
+	"example.com/rest/internal/domain"
+	"example.com/rest/internal/logging"
+)
+
+// AuditService records authentication events, e.g. logins and password changes, in the audit trail.
+// Every event carries the request ID, client IP and user agent of the request, see domain.Client.
+type AuditService struct {
+	eventRepo AuthEventRepo
+	tx        Transactor
+}
+
+type AuthEventRepo interface {
+	Insert(ctx context.Context, event *domain.AuthEvent) error
+	ListByUser(ctx context.Context, userID, limit, offset int) ([]*domain.AuthEvent, error)
+}
+
+func NewAuditService(repo AuthEventRepo, tx Transactor) *AuditService {
+	return &AuditService{
+		eventRepo: repo,
+		tx:        tx,
+	}
+}
+
+// Record stores an event of the user, the user ID is 0 and the email empty if they are unknown.
+// A failure is logged but not returned, so auditing never fails the operation it records.
+// Within a transaction the event is stored in a savepoint, so a failed insert doesn't abort the transaction,
+// and the event is rolled back with it.
+func (s *AuditService) Record(ctx context.Context, eventType domain.AuthEventType, userID int, email string) {
+	ctx, span := startSpan(ctx, "AuditService.Record")
+
+	client := domain.ClientFromContext(ctx)
+	event := &domain.AuthEvent{
+		Type:      eventType,
+		RequestID: client.RequestID,
+		IP:        client.IP,
+		UserAgent: truncate(client.UserAgent, 255),
+	}
+	if userID != 0 {
+		event.UserID = &userID
+	}
+	if email != "" {
+		event.Email = &email
+	}
+
+	err := s.tx.WithinTx(ctx, func(ctx context.Context) error {
+		return s.eventRepo.Insert(ctx, event)
+	})
+	endSpan(span, err)
+	if err != nil {
+		logging.FromContext(ctx).Error("failed to record auth event", "type", eventType, "error", err)
+	}
+}
+
+// ListByUser returns the events of the user, newest first. It requires the users:read permission for other users.
+func (s *AuditService) ListByUser(ctx context.Context, userID, limit, offset int) (_ []*domain.AuthEvent, err error) {
+	ctx, span := startSpan(ctx, "AuditService.ListByUser")
+	defer func() { endSpan(span, err) }()
+
+	err = Authorize(ctx, IsOwner(userID), HasPermission(PermissionUsersRead))
+	if err != nil {
+		return nil, err
+	}
+
+	return s.eventRepo.ListByUser(ctx, userID, limit, offset)
+}
+
+// truncate shortens the string to at most n runes, e.g. user agents sent by clients.
+func truncate(s string, n int) string {
+	if runes := []rune(s); len(runes) > n {
+		return string(runes[:n])
+	}
+	return s
+}
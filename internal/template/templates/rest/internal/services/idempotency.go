@@ -0,0 +1,89 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"example.com/rest/internal/domain"
+)
+
+type IdempotencyService struct {
+	idempotencyRepo IdempotencyRepo
+	ttl             time.Duration
+}
+
+type IdempotencyRepo interface {
+	Insert(ctx context.Context, record *domain.IdempotencyRecord) error
+	Get(ctx context.Context, scope, key string) (*domain.IdempotencyRecord, error)
+	Complete(ctx context.Context, record *domain.IdempotencyRecord) error
+	Delete(ctx context.Context, scope, key string) error
+	DeleteExpired(ctx context.Context) (int64, error)
+}
+
+// NewIdempotencyService creates a new idempotency service.
+// Captured responses are kept for the ttl duration.
+func NewIdempotencyService(repo IdempotencyRepo, ttl time.Duration) *IdempotencyService {
+	return &IdempotencyService{
+		idempotencyRepo: repo,
+		ttl:             ttl,
+	}
+}
+
+// Begin claims the key for a new request.
+// It returns nil if the request should be processed, or the completed record if the response should be replayed.
+// It returns a conflict error if a request with the same key is still in progress,
+// and an invalid error if the key was used for a different request.
+func (s *IdempotencyService) Begin(ctx context.Context, scope, key, requestHash string) (*domain.IdempotencyRecord, error) {
+	if key == "" || len(key) > 255 {
+		return nil, domain.Errorf(domain.INVALID_ERROR, "idempotency key must be between 1 and 255 characters long")
+	}
+
+	err := s.idempotencyRepo.Insert(ctx, &domain.IdempotencyRecord{
+		Scope:       scope,
+		Key:         key,
+		RequestHash: requestHash,
+		ExpiresAt:   time.Now().Add(s.ttl),
+	})
+	if err == nil {
+		return nil, nil
+	}
+	if !errors.Is(err, domain.ErrConflict) {
+		return nil, err
+	}
+
+	// the key was used before
+	record, err := s.idempotencyRepo.Get(ctx, scope, key)
+	if err != nil {
+		if errors.Is(err, domain.ErrNotFound) {
+			// expired between insert and get
+			return nil, domain.Errorf(domain.CONFLICT_ERROR, "idempotency key is being reused, try again")
+		}
+		return nil, err
+	}
+
+	if record.RequestHash != requestHash {
+		return nil, domain.Errorf(domain.INVALID_ERROR, "idempotency key was already used for a different request")
+	}
+
+	if !record.Completed() {
+		return nil, domain.Errorf(domain.CONFLICT_ERROR, "a request with this idempotency key is still in progress")
+	}
+
+	return record, nil
+}
+
+// Complete stores the captured response so it can be replayed for duplicate requests.
+func (s *IdempotencyService) Complete(ctx context.Context, record *domain.IdempotencyRecord) error {
+	return s.idempotencyRepo.Complete(ctx, record)
+}
+
+// Release frees the key of a request that did not complete, so it can be retried.
+func (s *IdempotencyService) Release(ctx context.Context, scope, key string) error {
+	return s.idempotencyRepo.Delete(ctx, scope, key)
+}
+
+// DeleteExpired removes all expired records and returns how many were removed.
+func (s *IdempotencyService) DeleteExpired(ctx context.Context) (int64, error) {
+	return s.idempotencyRepo.DeleteExpired(ctx)
+}
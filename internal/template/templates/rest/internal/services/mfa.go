@@ -0,0 +1,479 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"time"
+
+	"example.com/rest/internal/domain"
+	"example.com/rest/internal/logging"
+	"example.com/rest/internal/totp"
+)
+
+const (
+	mfaChallengeTTL         = 5 * time.Minute
+	mfaChallengeMaxAttempts = 5
+	recoveryCodeCount       = 10
+)
+
+// MFAService manages TOTP two-factor authentication.
+// Users enroll a secret in their authenticator app and confirm it with a code, which enables MFA
+// and returns one-time recovery codes for when the app is lost.
+// With MFA enabled, login returns a challenge token, which is exchanged together with a code for the real credentials.
+type MFAService struct {
+	mfaRepo  MFARepo
+	userRepo UserRepo
+	throttle *LoginThrottle
+	audit    *AuditService
+	issuer   string
+}
+
+type MFARepo interface {
+	Get(ctx context.Context, userID int) (*domain.MFA, error)
+	Enroll(ctx context.Context, userID int, secret string) error
+	Confirm(ctx context.Context, userID int, codeHashes []string) error
+	ReplaceRecoveryCodes(ctx context.Context, userID int, codeHashes []string) error
+	UseStep(ctx context.Context, userID int, step int64) error
+	UseRecoveryCode(ctx context.Context, userID int, codeHash string) error
+	Delete(ctx context.Context, userID int) error
+	InsertChallenge(ctx context.Context, challenge *domain.MFAChallenge) error
+	AttemptChallenge(ctx context.Context, tokenHash string, maxAttempts int) (*domain.MFAChallenge, error)
+	UseChallenge(ctx context.Context, id int) error
+	DeleteExpiredChallenges(ctx context.Context) (int64, error)
+}
+
+// NewMFAService creates a new MFA service.
+// The issuer is shown next to the account in authenticator apps, e.g. the name of the app.
+func NewMFAService(mfaRepo MFARepo, userRepo UserRepo, throttle *LoginThrottle, audit *AuditService, issuer string) *MFAService {
+	return &MFAService{
+		mfaRepo:  mfaRepo,
+		userRepo: userRepo,
+		throttle: throttle,
+		audit:    audit,
+		issuer:   issuer,
+	}
+}
+
+var (
+	errInvalidMFACode      = domain.Errorf(domain.UNAUTHORIZED_ERROR, "invalid code")
+	errInvalidMFAChallenge = domain.Errorf(domain.UNAUTHORIZED_ERROR, "invalid or expired mfa token, log in again")
+	errMFANotEnabled       = domain.Errorf(domain.NOTFOUND_ERROR, "two-factor authentication is not enabled")
+)
+
+// Enroll generates a new secret for the user, MFA is enabled once it is confirmed.
+// Enrolling again before confirming replaces the secret.
+func (s *MFAService) Enroll(ctx context.Context, userID int) (_ *domain.MFAEnrollment, err error) {
+	ctx, span := startSpan(ctx, "MFAService.Enroll")
+	defer func() { endSpan(span, err) }()
+
+	err = checkNotAPIKey(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	user, err := s.userRepo.GetByID(ctx, userID)
+	if err != nil {
+		if errors.Is(err, domain.ErrNotFound) {
+			return nil, domain.Errorf(domain.NOTFOUND_ERROR, "user not found")
+		}
+		return nil, err
+	}
+
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.mfaRepo.Enroll(ctx, userID, secret)
+	if err != nil {
+		if errors.Is(err, domain.ErrConflict) {
+			return nil, domain.Errorf(domain.CONFLICT_ERROR, "two-factor authentication is already enabled")
+		}
+		return nil, err
+	}
+
+	return &domain.MFAEnrollment{
+		Secret: secret,
+		URI:    totp.URI(s.issuer, user.Email, secret),
+	}, nil
+}
+
+// Confirm enables MFA with a code from the authenticator app, which proves the secret was stored.
+// It returns the recovery codes, they are shown to the user once and only their hashes are stored.
+func (s *MFAService) Confirm(ctx context.Context, userID int, req *domain.MFACodeRequest) (_ []string, err error) {
+	ctx, span := startSpan(ctx, "MFAService.Confirm")
+	defer func() { endSpan(span, err) }()
+
+	err = checkNotAPIKey(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	// validate input
+	err = req.Validate()
+	if err != nil {
+		return nil, err
+	}
+
+	mfa, err := s.mfaRepo.Get(ctx, userID)
+	if err != nil {
+		if errors.Is(err, domain.ErrNotFound) {
+			return nil, domain.Errorf(domain.NOTFOUND_ERROR, "enroll in two-factor authentication first")
+		}
+		return nil, err
+	}
+
+	if mfa.ConfirmedAt != nil {
+		return nil, domain.Errorf(domain.CONFLICT_ERROR, "two-factor authentication is already enabled")
+	}
+
+	err = s.checkThrottled(ctx, userID, func() error {
+		return s.checkCode(ctx, mfa, req.Code)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	codes, hashes, err := generateRecoveryCodes()
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.mfaRepo.Confirm(ctx, userID, hashes)
+	if err != nil {
+		if errors.Is(err, domain.ErrNotFound) {
+			return nil, domain.Errorf(domain.CONFLICT_ERROR, "two-factor authentication is already enabled")
+		}
+		return nil, err
+	}
+
+	logging.FromContext(ctx).Info("mfa enabled", "mfa_user_id", userID)
+	return codes, nil
+}
+
+// RegenerateRecoveryCodes replaces the recovery codes of the user, e.g. when they are used up.
+// It requires a code from the authenticator app.
+func (s *MFAService) RegenerateRecoveryCodes(ctx context.Context, userID int, req *domain.MFACodeRequest) (_ []string, err error) {
+	ctx, span := startSpan(ctx, "MFAService.RegenerateRecoveryCodes")
+	defer func() { endSpan(span, err) }()
+
+	err = checkNotAPIKey(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	// validate input
+	err = req.Validate()
+	if err != nil {
+		return nil, err
+	}
+
+	mfa, err := s.getEnabled(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.checkThrottled(ctx, userID, func() error {
+		return s.checkCode(ctx, mfa, req.Code)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	codes, hashes, err := generateRecoveryCodes()
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.mfaRepo.ReplaceRecoveryCodes(ctx, userID, hashes)
+	if err != nil {
+		return nil, err
+	}
+
+	logging.FromContext(ctx).Info("mfa recovery codes regenerated", "mfa_user_id", userID)
+	return codes, nil
+}
+
+// Disable turns off MFA for the user, it requires a code from the authenticator app or a recovery code,
+// so a stolen access token alone can't remove the second factor. Failed codes are throttled like in Verify.
+func (s *MFAService) Disable(ctx context.Context, userID int, req *domain.MFACodeRequest) (err error) {
+	ctx, span := startSpan(ctx, "MFAService.Disable")
+	defer func() { endSpan(span, err) }()
+
+	err = checkNotAPIKey(ctx)
+	if err != nil {
+		return err
+	}
+
+	// validate input
+	err = req.Validate()
+	if err != nil {
+		return err
+	}
+
+	mfa, err := s.getEnabled(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	err = s.checkThrottled(ctx, userID, func() error {
+		return s.checkCodeOrRecoveryCode(ctx, mfa, req.Code)
+	})
+	if err != nil {
+		return err
+	}
+
+	err = s.mfaRepo.Delete(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	logging.FromContext(ctx).Info("mfa disabled", "mfa_user_id", userID)
+	return nil
+}
+
+// Challenge starts the second step of the login of the user, it is called after the password was checked.
+// It returns the challenge token for the client, or an empty token if the user has no MFA enabled.
+func (s *MFAService) Challenge(ctx context.Context, userID int) (_ string, err error) {
+	ctx, span := startSpan(ctx, "MFAService.Challenge")
+	defer func() { endSpan(span, err) }()
+
+	_, err = s.getEnabled(ctx, userID)
+	if err != nil {
+		if errors.Is(err, errMFANotEnabled) {
+			return "", nil
+		}
+		return "", err
+	}
+
+	token, err := generateRefreshToken()
+	if err != nil {
+		return "", err
+	}
+
+	err = s.mfaRepo.InsertChallenge(ctx, &domain.MFAChallenge{
+		UserID:    userID,
+		TokenHash: hashToken(token),
+		ExpiresAt: time.Now().Add(mfaChallengeTTL),
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return token, nil
+}
+
+// Verify checks the code for the challenge and returns the user, who can then be logged in.
+// A code from the authenticator app or a recovery code is accepted.
+// Every challenge allows a few attempts and can be used only once, failed codes are throttled like failed passwords.
+func (s *MFAService) Verify(ctx context.Context, req *domain.MFAVerifyRequest) (_ *domain.User, err error) {
+	ctx, span := startSpan(ctx, "MFAService.Verify")
+	defer func() { endSpan(span, err) }()
+
+	// validate input
+	err = req.Validate()
+	if err != nil {
+		return nil, err
+	}
+
+	challenge, err := s.mfaRepo.AttemptChallenge(ctx, hashToken(req.MFAToken), mfaChallengeMaxAttempts)
+	if err != nil {
+		if errors.Is(err, domain.ErrNotFound) {
+			return nil, errInvalidMFAChallenge
+		}
+		return nil, err
+	}
+
+	// new challenges are cheap to get with the password, so failed codes are also counted across them
+	err = s.throttle.Check(ctx, mfaKey(challenge.UserID))
+	if err != nil {
+		return nil, err
+	}
+
+	user, err := s.userRepo.GetByID(ctx, challenge.UserID)
+	if err != nil {
+		if errors.Is(err, domain.ErrNotFound) {
+			return nil, errInvalidMFAChallenge
+		}
+		return nil, err
+	}
+
+	mfa, err := s.getEnabled(ctx, user.ID)
+	if err != nil {
+		if errors.Is(err, errMFANotEnabled) {
+			return nil, errInvalidMFAChallenge
+		}
+		return nil, err
+	}
+
+	err = s.checkCodeOrRecoveryCode(ctx, mfa, req.Code)
+	if err != nil {
+		if errors.Is(err, errInvalidMFACode) {
+			return nil, s.codeFailed(ctx, user)
+		}
+		return nil, err
+	}
+
+	err = s.mfaRepo.UseChallenge(ctx, challenge.ID)
+	if err != nil {
+		if errors.Is(err, domain.ErrConflict) {
+			return nil, errInvalidMFAChallenge
+		}
+		return nil, err
+	}
+
+	err = s.throttle.Reset(ctx, mfaKey(user.ID))
+	if err != nil {
+		return nil, err
+	}
+
+	logging.FromContext(ctx).Info("mfa verified", "mfa_user_id", user.ID)
+	return user, nil
+}
+
+// codeFailed counts and records a failed code of the second login step.
+// It returns the error for the client.
+func (s *MFAService) codeFailed(ctx context.Context, user *domain.User) error {
+	s.audit.Record(ctx, domain.AuthEventLoginFailed, user.ID, user.Email)
+
+	locked, err := s.throttle.Fail(ctx, mfaKey(user.ID))
+	if err != nil {
+		return err
+	}
+
+	if locked {
+		logging.FromContext(ctx).Warn("login locked after failed attempts", "login_user_id", user.ID)
+		s.audit.Record(ctx, domain.AuthEventLockout, user.ID, user.Email)
+	}
+	return errInvalidMFACode
+}
+
+// checkThrottled runs the check of a code for managing MFA under the throttle of the second login step,
+// so a stolen access token can't be used to guess codes either.
+func (s *MFAService) checkThrottled(ctx context.Context, userID int, check func() error) error {
+	err := s.throttle.Check(ctx, mfaKey(userID))
+	if err != nil {
+		return err
+	}
+
+	err = check()
+	if err != nil {
+		if !errors.Is(err, errInvalidMFACode) {
+			return err
+		}
+		locked, failErr := s.throttle.Fail(ctx, mfaKey(userID))
+		if failErr != nil {
+			return failErr
+		}
+		if locked {
+			logging.FromContext(ctx).Warn("mfa locked after failed attempts", "mfa_user_id", userID)
+		}
+		return err
+	}
+
+	return s.throttle.Reset(ctx, mfaKey(userID))
+}
+
+// DeleteExpired removes all expired challenges and returns how many were removed.
+func (s *MFAService) DeleteExpired(ctx context.Context) (int64, error) {
+	return s.mfaRepo.DeleteExpiredChallenges(ctx)
+}
+
+// checkNotAPIKey rejects API keys, they bypass MFA and must not be able to change it.
+func checkNotAPIKey(ctx context.Context) error {
+	if principal, ok := domain.PrincipalFromContext(ctx); ok && principal.APIKeyID != 0 {
+		return domain.Errorf(domain.FORBIDDEN_ERROR, "api keys can't manage two-factor authentication")
+	}
+	return nil
+}
+
+// Enabled reports whether the user has two-factor authentication enabled.
+func (s *MFAService) Enabled(ctx context.Context, userID int) (_ bool, err error) {
+	ctx, span := startSpan(ctx, "MFAService.Enabled")
+	defer func() { endSpan(span, err) }()
+
+	_, err = s.getEnabled(ctx, userID)
+	if err != nil {
+		if errors.Is(err, errMFANotEnabled) {
+			return false, nil
+		}
+		return false, err
+	}
+	return true, nil
+}
+
+// getEnabled returns the confirmed secret of the user.
+func (s *MFAService) getEnabled(ctx context.Context, userID int) (*domain.MFA, error) {
+	mfa, err := s.mfaRepo.Get(ctx, userID)
+	if err != nil {
+		if errors.Is(err, domain.ErrNotFound) {
+			return nil, errMFANotEnabled
+		}
+		return nil, err
+	}
+
+	if mfa.ConfirmedAt == nil {
+		return nil, errMFANotEnabled
+	}
+	return mfa, nil
+}
+
+// checkCode validates a code from the authenticator app and marks its time step as used,
+// so the same code can't be used twice.
+func (s *MFAService) checkCode(ctx context.Context, mfa *domain.MFA, code string) error {
+	step, ok := totp.Validate(mfa.Secret, strings.TrimSpace(code), time.Now())
+	if !ok || step <= mfa.LastUsedStep {
+		return errInvalidMFACode
+	}
+
+	err := s.mfaRepo.UseStep(ctx, mfa.UserID, step)
+	if err != nil {
+		if errors.Is(err, domain.ErrConflict) {
+			return errInvalidMFACode
+		}
+		return err
+	}
+	return nil
+}
+
+// checkCodeOrRecoveryCode accepts a code from the authenticator app or an unused recovery code.
+func (s *MFAService) checkCodeOrRecoveryCode(ctx context.Context, mfa *domain.MFA, code string) error {
+	if len(strings.TrimSpace(code)) == 6 {
+		return s.checkCode(ctx, mfa, code)
+	}
+
+	err := s.mfaRepo.UseRecoveryCode(ctx, mfa.UserID, hashToken(normalizeRecoveryCode(code)))
+	if err != nil {
+		if errors.Is(err, domain.ErrNotFound) {
+			return errInvalidMFACode
+		}
+		return err
+	}
+
+	logging.FromContext(ctx).Info("mfa recovery code used", "mfa_user_id", mfa.UserID)
+	return nil
+}
+
+// generateRecoveryCodes returns new recovery codes like "3f9a1-c07e2" and their hashes.
+func generateRecoveryCodes() (codes, hashes []string, err error) {
+	for range recoveryCodeCount {
+		b := make([]byte, 5)
+		if _, err := rand.Read(b); err != nil {
+			return nil, nil, err
+		}
+		code := hex.EncodeToString(b)
+
+		codes = append(codes, code[:5]+"-"+code[5:])
+		hashes = append(hashes, hashToken(code))
+	}
+	return codes, hashes, nil
+}
+
+// normalizeRecoveryCode removes the separator and whitespace users may type or copy.
+func normalizeRecoveryCode(code string) string {
+	code = strings.ToLower(strings.TrimSpace(code))
+	return strings.ReplaceAll(code, "-", "")
+}
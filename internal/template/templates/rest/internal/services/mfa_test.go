@@ -0,0 +1,70 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"example.com/rest/internal/domain"
+	"example.com/rest/internal/totp"
+)
+
+// fakeMFARepo stores the last used step like the database, the other methods are not implemented.
+type fakeMFARepo struct {
+	MFARepo
+	mfa *domain.MFA
+}
+
+func (r *fakeMFARepo) UseStep(ctx context.Context, userID int, step int64) error {
+	if step <= r.mfa.LastUsedStep {
+		return domain.ErrConflict
+	}
+	r.mfa.LastUsedStep = step
+	return nil
+}
+
+func TestMFACheckCodeRejectsReplay(t *testing.T) {
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+	code, err := totp.Code(secret, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mfa := &domain.MFA{UserID: 1, Secret: secret}
+	s := &MFAService{mfaRepo: &fakeMFARepo{mfa: mfa}}
+	ctx := context.Background()
+
+	if err := s.checkCode(ctx, mfa, code); err != nil {
+		t.Fatalf("first use: %v", err)
+	}
+	if mfa.LastUsedStep == 0 {
+		t.Fatal("the step of the code was not stored")
+	}
+
+	if err := s.checkCode(ctx, mfa, code); !errors.Is(err, errInvalidMFACode) {
+		t.Errorf("replay: err = %v, want errInvalidMFACode", err)
+	}
+}
+
+func TestMFACheckCodeRejectsEarlierStep(t *testing.T) {
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+	code, err := totp.Code(secret, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// a code of a later step was used already
+	mfa := &domain.MFA{UserID: 1, Secret: secret, LastUsedStep: time.Now().Add(time.Minute).Unix() / 30}
+	s := &MFAService{mfaRepo: &fakeMFARepo{mfa: mfa}}
+
+	if err := s.checkCode(context.Background(), mfa, code); !errors.Is(err, errInvalidMFACode) {
+		t.Errorf("err = %v, want errInvalidMFACode", err)
+	}
+}
@@ -0,0 +1,301 @@
+package services
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"slices"
+	"time"
+
+	"example.com/rest/internal/domain"
+	"example.com/rest/internal/logging"
+	"example.com/rest/internal/oidc"
+)
+
+// oidcStateTTL is how long the user has to sign in at the provider.
+const oidcStateTTL = 10 * time.Minute
+
+// OIDCService signs users in with OpenID Connect providers, e.g. Google.
+// The app sends the user to the URL returned by Authorize, the provider redirects back to the app,
+// which posts the code and state with the binding from Authorize to the API, see Callback.
+// The returned user then gets the usual tokens or session, so the rest of the API doesn't know how the user signed in.
+type OIDCService struct {
+	providers    map[string]*oidc.Provider
+	redirectURL  string
+	identityRepo IdentityRepo
+	userRepo     UserRepo
+	tx           Transactor
+	passwords    *Passwords
+	audit        *AuditService
+}
+
+type IdentityRepo interface {
+	Get(ctx context.Context, provider, subject string) (*domain.Identity, error)
+	ListByUser(ctx context.Context, userID int) ([]*domain.Identity, error)
+	Insert(ctx context.Context, identity *domain.Identity) error
+	Touch(ctx context.Context, id int, email string) error
+	InsertState(ctx context.Context, state *domain.OIDCState) error
+	ConsumeState(ctx context.Context, stateHash string) (*domain.OIDCState, error)
+	DeleteExpiredStates(ctx context.Context) (int64, error)
+}
+
+// NewOIDCService creates a new OIDC service.
+// The redirect URL is the page of the app the providers redirect back to, it has to be registered with every provider.
+func NewOIDCService(providers []*oidc.Provider, redirectURL string, identityRepo IdentityRepo, userRepo UserRepo, tx Transactor, passwords *Passwords, audit *AuditService) *OIDCService {
+	byName := make(map[string]*oidc.Provider, len(providers))
+	for _, p := range providers {
+		byName[p.Name()] = p
+	}
+	return &OIDCService{
+		providers:    byName,
+		redirectURL:  redirectURL,
+		identityRepo: identityRepo,
+		userRepo:     userRepo,
+		tx:           tx,
+		passwords:    passwords,
+		audit:        audit,
+	}
+}
+
+var (
+	errOIDCFailed       = domain.Errorf(domain.UNAUTHORIZED_ERROR, "sign in failed, try again")
+	errInvalidOIDCState = domain.Errorf(domain.UNAUTHORIZED_ERROR, "invalid or expired state, sign in again")
+)
+
+// Providers returns the names of the configured providers, sorted.
+func (s *OIDCService) Providers() []string {
+	names := make([]string, 0, len(s.providers))
+	for name := range s.providers {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names
+}
+
+// Authorize starts a sign in with the provider and returns the URL of the provider to send the user to
+// and the binding, which the client keeps and sends with the callback.
+// The state, nonce and PKCE code verifier are stored until the callback.
+func (s *OIDCService) Authorize(ctx context.Context, providerName string) (_, _ string, err error) {
+	ctx, span := startSpan(ctx, "OIDCService.Authorize")
+	defer func() { endSpan(span, err) }()
+
+	provider, ok := s.providers[providerName]
+	if !ok {
+		return "", "", domain.Errorf(domain.NOTFOUND_ERROR, "provider not found")
+	}
+
+	state, err := oidc.RandomString()
+	if err != nil {
+		return "", "", err
+	}
+	nonce, err := oidc.RandomString()
+	if err != nil {
+		return "", "", err
+	}
+	verifier, err := oidc.RandomString()
+	if err != nil {
+		return "", "", err
+	}
+	binding, err := oidc.RandomString()
+	if err != nil {
+		return "", "", err
+	}
+
+	url, err := provider.AuthCodeURL(ctx, s.redirectURL, state, nonce, verifier)
+	if err != nil {
+		return "", "", err
+	}
+
+	err = s.identityRepo.InsertState(ctx, &domain.OIDCState{
+		StateHash:    hashToken(state),
+		BindingHash:  hashToken(binding),
+		Provider:     providerName,
+		Nonce:        nonce,
+		CodeVerifier: verifier,
+		ExpiresAt:    time.Now().Add(oidcStateTTL),
+	})
+	if err != nil {
+		return "", "", err
+	}
+
+	return url, binding, nil
+}
+
+// Callback completes a sign in with the code and state the provider redirected back with and returns the user.
+// Known identities sign in their user. Otherwise a user with the same email is linked if both the provider
+// and the user verified the email, else a new user is created, without a usable password.
+// The mock provider never links users, it reports any email as verified.
+func (s *OIDCService) Callback(ctx context.Context, req *domain.OIDCCallbackRequest) (_ *domain.User, err error) {
+	ctx, span := startSpan(ctx, "OIDCService.Callback")
+	defer func() { endSpan(span, err) }()
+
+	// validate input
+	err = req.Validate()
+	if err != nil {
+		return nil, err
+	}
+
+	state, err := s.identityRepo.ConsumeState(ctx, hashToken(req.State))
+	if err != nil {
+		if errors.Is(err, domain.ErrNotFound) {
+			return nil, errInvalidOIDCState
+		}
+		return nil, err
+	}
+
+	// a callback for a sign in started by another client, e.g. a link with the code of an attacker
+	if subtle.ConstantTimeCompare([]byte(hashToken(req.Binding)), []byte(state.BindingHash)) != 1 {
+		logging.FromContext(ctx).Warn("oidc state used by another client", "provider", state.Provider)
+		return nil, errInvalidOIDCState
+	}
+
+	provider, ok := s.providers[state.Provider]
+	if !ok {
+		return nil, domain.Errorf(domain.NOTFOUND_ERROR, "provider not found")
+	}
+
+	external, err := provider.Exchange(ctx, req.Code, s.redirectURL, state.Nonce, state.CodeVerifier)
+	if err != nil {
+		if errors.Is(err, oidc.ErrExchange) || errors.Is(err, oidc.ErrInvalidIDToken) {
+			logging.FromContext(ctx).Warn("oidc sign in failed", "provider", state.Provider, "error", err)
+			return nil, errOIDCFailed
+		}
+		return nil, err
+	}
+
+	// a new user is only created together with the link to the identity
+	var user *domain.User
+	err = s.tx.WithinTx(ctx, func(ctx context.Context) error {
+		user, err = s.signIn(ctx, provider, external)
+		return err
+	})
+	if err != nil {
+		if errors.Is(err, domain.ErrSerializationFailure) {
+			return nil, errSerializationFailure.Wrap(err)
+		}
+		return nil, err
+	}
+
+	s.audit.Record(ctx, domain.AuthEventLogin, user.ID, user.Email)
+	return user, nil
+}
+
+// signIn finds the user of the identity, linking or creating it.
+func (s *OIDCService) signIn(ctx context.Context, provider *oidc.Provider, external *oidc.Identity) (*domain.User, error) {
+	providerName := provider.Name()
+	identity, err := s.identityRepo.Get(ctx, providerName, external.Subject)
+	if err == nil {
+		err = s.identityRepo.Touch(ctx, identity.ID, external.Email)
+		if err != nil {
+			return nil, err
+		}
+		return s.getUser(ctx, identity.UserID)
+	}
+	if !errors.Is(err, domain.ErrNotFound) {
+		return nil, err
+	}
+
+	if external.Email == "" {
+		return nil, domain.Errorf(domain.UNAUTHORIZED_ERROR, "the provider didn't share an email, allow access to it and try again")
+	}
+
+	user, err := s.userRepo.GetByEmail(ctx, external.Email)
+	switch {
+	case err == nil:
+		// linking an unverified email would let whoever registered it first take over the account
+		if !external.EmailVerified || user.EmailVerifiedAt == nil || provider.Mock() {
+			return nil, domain.Errorf(domain.CONFLICT_ERROR, "an account with this email already exists, log in with your password")
+		}
+	case errors.Is(err, domain.ErrNotFound):
+		user, err = s.createUser(ctx, external)
+		if err != nil {
+			return nil, err
+		}
+	default:
+		return nil, err
+	}
+
+	err = s.identityRepo.Insert(ctx, &domain.Identity{
+		UserID:   user.ID,
+		Provider: providerName,
+		Subject:  external.Subject,
+		Email:    external.Email,
+	})
+	if err != nil {
+		if errors.Is(err, domain.ErrConflict) {
+			// linked by a concurrent callback
+			return nil, errOIDCFailed.Wrap(err)
+		}
+		return nil, err
+	}
+
+	logging.FromContext(ctx).Info("identity linked", "provider", providerName, "linked_user_id", user.ID)
+	return user, nil
+}
+
+// createUser creates a user for the identity with a random password nobody knows,
+// the user can set one with the password reset.
+func (s *OIDCService) createUser(ctx context.Context, external *oidc.Identity) (*domain.User, error) {
+	password, err := generateRefreshToken()
+	if err != nil {
+		return nil, err
+	}
+	passwordHash, err := s.passwords.hash(ctx, password)
+	if err != nil {
+		return nil, err
+	}
+
+	id, err := s.userRepo.Insert(ctx, external.Email, passwordHash)
+	if err != nil {
+		if errors.Is(err, domain.ErrConflict) {
+			// created by a concurrent request
+			return nil, errOIDCFailed.Wrap(err)
+		}
+		return nil, err
+	}
+	logging.FromContext(ctx).Info("user created", "created_user_id", id)
+
+	user, err := s.getUser(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	if external.EmailVerified {
+		now := time.Now()
+		user.EmailVerifiedAt = &now
+		user, err = s.userRepo.Update(ctx, user)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return user, nil
+}
+
+func (s *OIDCService) getUser(ctx context.Context, id int) (*domain.User, error) {
+	user, err := s.userRepo.GetByID(ctx, id)
+	if err != nil {
+		if errors.Is(err, domain.ErrNotFound) {
+			return nil, domain.Errorf(domain.NOTFOUND_ERROR, "user not found")
+		}
+		return nil, err
+	}
+	return user, nil
+}
+
+// ListIdentities returns the identities linked to the user. It requires the users:read permission for other users.
+func (s *OIDCService) ListIdentities(ctx context.Context, userID int) (_ []*domain.Identity, err error) {
+	ctx, span := startSpan(ctx, "OIDCService.ListIdentities")
+	defer func() { endSpan(span, err) }()
+
+	err = Authorize(ctx, IsOwner(userID), HasPermission(PermissionUsersRead))
+	if err != nil {
+		return nil, err
+	}
+
+	return s.identityRepo.ListByUser(ctx, userID)
+}
+
+// DeleteExpired removes the states of abandoned sign ins and returns how many were removed.
+func (s *OIDCService) DeleteExpired(ctx context.Context) (int64, error) {
+	return s.identityRepo.DeleteExpiredStates(ctx)
+}
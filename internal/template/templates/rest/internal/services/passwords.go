@@ -0,0 +1,77 @@
+package services
+
+import (
+	"context"
+	"errors"
+
+	"example.com/rest/internal/domain"
+	"example.com/rest/internal/password"
+	"example.com/rest/internal/validator"
+)
+
+// Passwords hashes and verifies passwords for the user and account services
+// and rejects new passwords on the blocklist.
+type Passwords struct {
+	hasher    password.Hasher
+	blocklist *password.Blocklist
+}
+
+// NewPasswords creates the password helper, the blocklist may be nil.
+func NewPasswords(hasher password.Hasher, blocklist *password.Blocklist) *Passwords {
+	return &Passwords{
+		hasher:    hasher,
+		blocklist: blocklist,
+	}
+}
+
+// hashNew checks a new password against the blocklist and hashes it.
+// The field is the name of the password in the request, for the validation error.
+func (p *Passwords) hashNew(ctx context.Context, field, newPassword string) (string, error) {
+	v := validator.New()
+
+	v.CheckField(!p.blocklist.Contains(newPassword), field, "password is too common, choose another one")
+	if err := v.Validate("invalid input"); err != nil {
+		return "", err
+	}
+
+	hash, err := p.hash(ctx, newPassword)
+	if err != nil {
+		if errors.Is(err, password.ErrTooLong) {
+			v.AddError(field, "password is too long")
+			return "", v.Validate("invalid input")
+		}
+		return "", err
+	}
+	return hash, nil
+}
+
+// hash hashes the password.
+// It is traced separately as hashing is deliberately slow.
+func (p *Passwords) hash(ctx context.Context, pw string) (_ string, err error) {
+	_, span := startSpan(ctx, "password.Hash")
+	defer func() { endSpan(span, err) }()
+
+	hash, err := p.hasher.Hash(pw)
+	if err != nil {
+		return "", domain.Errorf(domain.INTERNAL_ERROR, "failed to hash password").Wrap(err)
+	}
+	return hash, nil
+}
+
+// verify reports whether the password matches the hash.
+// It is traced separately as verifying is deliberately slow.
+func (p *Passwords) verify(ctx context.Context, hash, pw string) (_ bool, err error) {
+	_, span := startSpan(ctx, "password.Verify")
+	defer func() { endSpan(span, err) }()
+
+	ok, err := p.hasher.Verify(pw, hash)
+	if err != nil {
+		return false, domain.Errorf(domain.INTERNAL_ERROR, "failed to verify password").Wrap(err)
+	}
+	return ok, nil
+}
+
+// needsRehash reports whether the hash should be replaced with a hash of the current algorithm and parameters.
+func (p *Passwords) needsRehash(hash string) bool {
+	return p.hasher.NeedsRehash(hash)
+}
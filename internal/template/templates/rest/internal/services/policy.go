@@ -0,0 +1,78 @@
+package services
+
+import (
+	"context"
+
+	"example.com/rest/internal/domain"
+)
+
+// Permissions granted by roles, they are seeded by the migrations.
+const (
+	PermissionUsersRead   = "users:read"
+	PermissionUsersDelete = "users:delete"
+	PermissionRolesWrite  = "roles:write"
+)
+
+// ScopeAccountWrite lets an API key limited to scopes manage the account of its user,
+// e.g. update or delete the user and revoke keys. Without it, scoped keys can only use their permissions.
+const ScopeAccountWrite = "account:write"
+
+// RoleAdmin is the seeded role that has all permissions.
+const RoleAdmin = "admin"
+
+// Policy decides whether the principal may perform an operation.
+type Policy func(principal *domain.Principal) bool
+
+// Authorize checks the policies against the principal of the context.
+// The operation is allowed if any of the policies allows it.
+// It returns an unauthorized error if the context has no principal and a forbidden error if no policy allows it.
+//
+// Services call it before operating on a resource, so ownership rules are enforced no matter which handler calls:
+//
+//	err := Authorize(ctx, IsOwner(id), HasPermission(PermissionUsersDelete))
+func Authorize(ctx context.Context, policies ...Policy) error {
+	principal, ok := domain.PrincipalFromContext(ctx)
+	if !ok {
+		return domain.Errorf(domain.UNAUTHORIZED_ERROR, "user not authenticated")
+	}
+
+	for _, policy := range policies {
+		if policy(principal) {
+			return nil
+		}
+	}
+	return domain.Errorf(domain.FORBIDDEN_ERROR, "you are not allowed to perform this operation")
+}
+
+// IsOwner allows the operation if the principal is the user that owns the resource.
+func IsOwner(ownerID int) Policy {
+	return func(principal *domain.Principal) bool {
+		return principal.UserID == ownerID
+	}
+}
+
+// OwnsAccount allows changes to the account of the principal, it is IsOwner for writes.
+// Principals limited to scopes also need the ScopeAccountWrite scope, so a key scoped to
+// "users:read" can't delete the user or revoke the other keys.
+func OwnsAccount(ownerID int) Policy {
+	return func(principal *domain.Principal) bool {
+		if len(principal.Scopes) > 0 && !principal.HasScope(ScopeAccountWrite) {
+			return false
+		}
+		return principal.UserID == ownerID
+	}
+}
+
+// HasRole allows the operation if the principal has the role.
+func HasRole(role string) Policy {
+	return func(principal *domain.Principal) bool {
+		return principal.HasRole(role)
+	}
+}
+
+// HasPermission allows the operation if a role of the principal grants the permission.
+func HasPermission(permission string) Policy {
+	return func(principal *domain.Principal) bool {
+		return principal.HasPermission(permission)
+	}
+}
@@ -0,0 +1,86 @@
+package services
+
+import (
+	"context"
+	"errors"
+
+	"example.com/rest/internal/domain"
+	"example.com/rest/internal/logging"
+)
+
+// RoleService manages the roles of users.
+// Roles and their permissions are defined by the migrations, the service only assigns them to users.
+type RoleService struct {
+	roleRepo RoleRepo
+}
+
+type RoleRepo interface {
+	GetUserRoles(ctx context.Context, userID int) ([]string, error)
+	AssignRole(ctx context.Context, userID int, role string) error
+	RemoveRole(ctx context.Context, userID int, role string) error
+}
+
+func NewRoleService(repo RoleRepo) *RoleService {
+	return &RoleService{
+		roleRepo: repo,
+	}
+}
+
+// UserRoles returns the roles of the user, it requires the users:read permission for other users.
+func (s *RoleService) UserRoles(ctx context.Context, userID int) (_ []string, err error) {
+	ctx, span := startSpan(ctx, "RoleService.UserRoles")
+	defer func() { endSpan(span, err) }()
+
+	err = Authorize(ctx, IsOwner(userID), HasPermission(PermissionUsersRead))
+	if err != nil {
+		return nil, err
+	}
+
+	return s.roleRepo.GetUserRoles(ctx, userID)
+}
+
+// AssignRole assigns the role to the user, it requires the roles:write permission.
+// The user gets the permissions of the role with the next access token, e.g. after refreshing.
+func (s *RoleService) AssignRole(ctx context.Context, userID int, role string) (err error) {
+	ctx, span := startSpan(ctx, "RoleService.AssignRole")
+	defer func() { endSpan(span, err) }()
+
+	err = Authorize(ctx, HasPermission(PermissionRolesWrite))
+	if err != nil {
+		return err
+	}
+
+	err = s.roleRepo.AssignRole(ctx, userID, role)
+	if err != nil {
+		if errors.Is(err, domain.ErrNotFound) {
+			return domain.Errorf(domain.NOTFOUND_ERROR, "user or role not found")
+		}
+		return err
+	}
+
+	logging.FromContext(ctx).Info("role assigned", "target_user_id", userID, "role", role)
+	return nil
+}
+
+// RemoveRole removes the role from the user, it requires the roles:write permission.
+// Access tokens that were issued before keep the role until they expire.
+func (s *RoleService) RemoveRole(ctx context.Context, userID int, role string) (err error) {
+	ctx, span := startSpan(ctx, "RoleService.RemoveRole")
+	defer func() { endSpan(span, err) }()
+
+	err = Authorize(ctx, HasPermission(PermissionRolesWrite))
+	if err != nil {
+		return err
+	}
+
+	err = s.roleRepo.RemoveRole(ctx, userID, role)
+	if err != nil {
+		if errors.Is(err, domain.ErrNotFound) {
+			return domain.Errorf(domain.NOTFOUND_ERROR, "user doesn't have the role")
+		}
+		return err
+	}
+
+	logging.FromContext(ctx).Info("role removed", "target_user_id", userID, "role", role)
+	return nil
+}
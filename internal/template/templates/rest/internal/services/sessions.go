@@ -0,0 +1,201 @@
+package services
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"time"
+
+	"example.com/rest/internal/domain"
+	"example.com/rest/internal/logging"
+)
+
+// SessionService manages server-side sessions of browser clients.
+// The session token is sent in an HttpOnly cookie, so scripts can't read it, and is stored hashed.
+// Sessions end after the idle timeout without requests and at the latest after the absolute timeout.
+type SessionService struct {
+	sessionRepo     SessionRepo
+	grants          GrantRepo
+	idleTimeout     time.Duration
+	absoluteTimeout time.Duration
+}
+
+type SessionRepo interface {
+	Insert(ctx context.Context, session *domain.Session) (*domain.Session, error)
+	GetByHash(ctx context.Context, tokenHash string) (*domain.Session, error)
+	ListActive(ctx context.Context, userID int) ([]*domain.Session, error)
+	Touch(ctx context.Context, id int) error
+	Revoke(ctx context.Context, id, userID int) error
+	RevokeUser(ctx context.Context, userID int) (int64, error)
+	DeleteExpired(ctx context.Context) (int64, error)
+}
+
+func NewSessionService(repo SessionRepo, grants GrantRepo, idleTimeout, absoluteTimeout time.Duration) *SessionService {
+	return &SessionService{
+		sessionRepo:     repo,
+		grants:          grants,
+		idleTimeout:     idleTimeout,
+		absoluteTimeout: absoluteTimeout,
+	}
+}
+
+// errInvalidSession is returned for sessions that are unknown, timed out or revoked.
+var errInvalidSession = domain.Errorf(domain.UNAUTHORIZED_ERROR, "session expired, log in again")
+
+// Create starts a session for the user, it is called on login.
+// It returns the stored session and the session token for the cookie.
+func (s *SessionService) Create(ctx context.Context, userID int, userAgent, ip string) (_ *domain.Session, _ string, err error) {
+	ctx, span := startSpan(ctx, "SessionService.Create")
+	defer func() { endSpan(span, err) }()
+
+	token, err := generateRefreshToken()
+	if err != nil {
+		return nil, "", err
+	}
+
+	session, err := s.sessionRepo.Insert(ctx, &domain.Session{
+		UserID:    userID,
+		TokenHash: hashToken(token),
+		UserAgent: truncate(userAgent, 255),
+		IP:        ip,
+		ExpiresAt: time.Now().Add(s.absoluteTimeout),
+	})
+	if err != nil {
+		return nil, "", err
+	}
+
+	return session, token, nil
+}
+
+// Authenticate validates the session token and returns the principal of the session.
+// Like API keys, the roles and permissions are read on every request.
+func (s *SessionService) Authenticate(ctx context.Context, token string) (_ *domain.Principal, err error) {
+	ctx, span := startSpan(ctx, "SessionService.Authenticate")
+	defer func() { endSpan(span, err) }()
+
+	session, err := s.sessionRepo.GetByHash(ctx, hashToken(token))
+	if err != nil {
+		if errors.Is(err, domain.ErrNotFound) {
+			return nil, errInvalidSession
+		}
+		return nil, err
+	}
+
+	if !s.active(session) {
+		return nil, errInvalidSession
+	}
+
+	err = s.sessionRepo.Touch(ctx, session.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	roles, err := s.grants.GetUserRoles(ctx, session.UserID)
+	if err != nil {
+		return nil, err
+	}
+
+	permissions, err := s.grants.GetUserPermissions(ctx, session.UserID)
+	if err != nil {
+		return nil, err
+	}
+
+	return &domain.Principal{
+		UserID:      session.UserID,
+		Roles:       roles,
+		Permissions: permissions,
+		SessionID:   session.ID,
+		ExpiresAt:   session.ExpiresAt,
+	}, nil
+}
+
+// List returns the active sessions of the user and marks the current one.
+func (s *SessionService) List(ctx context.Context, userID, currentID int) (_ []*domain.Session, err error) {
+	ctx, span := startSpan(ctx, "SessionService.List")
+	defer func() { endSpan(span, err) }()
+
+	err = Authorize(ctx, OwnsAccount(userID))
+	if err != nil {
+		return nil, err
+	}
+
+	sessions, err := s.sessionRepo.ListActive(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	active := []*domain.Session{}
+	for _, session := range sessions {
+		if s.active(session) {
+			session.Current = session.ID == currentID
+			active = append(active, session)
+		}
+	}
+	return active, nil
+}
+
+// Revoke ends the session of the user, e.g. on logout or to sign out a lost device.
+func (s *SessionService) Revoke(ctx context.Context, userID, id int) (err error) {
+	ctx, span := startSpan(ctx, "SessionService.Revoke")
+	defer func() { endSpan(span, err) }()
+
+	err = Authorize(ctx, OwnsAccount(userID))
+	if err != nil {
+		return err
+	}
+
+	err = s.sessionRepo.Revoke(ctx, id, userID)
+	if err != nil {
+		if errors.Is(err, domain.ErrNotFound) {
+			return domain.Errorf(domain.NOTFOUND_ERROR, "session not found")
+		}
+		return err
+	}
+	return nil
+}
+
+// RevokeAll ends all sessions of the user.
+func (s *SessionService) RevokeAll(ctx context.Context, userID int) (err error) {
+	ctx, span := startSpan(ctx, "SessionService.RevokeAll")
+	defer func() { endSpan(span, err) }()
+
+	err = Authorize(ctx, OwnsAccount(userID))
+	if err != nil {
+		return err
+	}
+
+	count, err := s.sessionRepo.RevokeUser(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	logging.FromContext(ctx).Info("user logged out of all sessions", "revoked_sessions", count)
+	return nil
+}
+
+// DeleteExpired removes all expired sessions and returns how many were removed.
+func (s *SessionService) DeleteExpired(ctx context.Context) (int64, error) {
+	return s.sessionRepo.DeleteExpired(ctx)
+}
+
+// active reports whether the session is neither revoked, idle for too long nor expired.
+func (s *SessionService) active(session *domain.Session) bool {
+	now := time.Now()
+	return session.RevokedAt == nil && now.Before(session.ExpiresAt) && now.Before(session.LastSeenAt.Add(s.idleTimeout))
+}
+
+// CSRFToken returns the CSRF token of the session.
+// It is derived from the session token, so it needs no storage and can't be computed by other sites,
+// which can't read the HttpOnly session cookie. Browser clients send it in the X-CSRF-Token header.
+func CSRFToken(sessionToken string) string {
+	mac := hmac.New(sha256.New, []byte(sessionToken))
+	mac.Write([]byte("csrf"))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// ValidCSRFToken reports whether the CSRF token belongs to the session, in constant time.
+func ValidCSRFToken(sessionToken, csrfToken string) bool {
+	return hmac.Equal([]byte(CSRFToken(sessionToken)), []byte(csrfToken))
+}
@@ -0,0 +1,145 @@
+package services
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"time"
+
+	"example.com/rest/internal/domain"
+)
+
+// LoginPolicy configures when failed logins are throttled.
+type LoginPolicy struct {
+	MaxFailures     int           // failures of an account until it is locked
+	IPMaxFailures   int           // failures from a client IP until it is locked, higher as IPs can be shared
+	Delay           time.Duration // wait after the first failure of an account, doubled with every further failure, 0 disables it
+	LockoutDuration time.Duration // how long accounts and IPs are locked, failures older than this are forgotten
+}
+
+// LoginThrottle tracks failed logins per account and per client IP.
+// After a failure, the account has to wait a progressively longer delay before the next attempt,
+// and after too many failures the account or IP is locked for a while.
+// Accounts are identified by a key, e.g. the email for passwords, so unknown emails are throttled the same way.
+type LoginThrottle struct {
+	failureRepo LoginFailureRepo
+	policy      LoginPolicy
+}
+
+type LoginFailureRepo interface {
+	LockedUntil(ctx context.Context, keys []string) (time.Time, error)
+	RecordFailure(ctx context.Context, key string, window time.Duration) (int, error)
+	Lock(ctx context.Context, key string, until time.Time) error
+	Reset(ctx context.Context, key string) error
+	DeleteStale(ctx context.Context, window time.Duration) (int64, error)
+}
+
+func NewLoginThrottle(repo LoginFailureRepo, policy LoginPolicy) *LoginThrottle {
+	return &LoginThrottle{
+		failureRepo: repo,
+		policy:      policy,
+	}
+}
+
+// emailKey is the account key of password logins.
+func emailKey(email string) string {
+	return "email:" + strings.ToLower(email)
+}
+
+// mfaKey is the account key of the second login step, it is separate from the password
+// so that a correct password doesn't reset the failed codes.
+func mfaKey(userID int) string {
+	return "mfa:" + strconv.Itoa(userID)
+}
+
+// Check returns an error if the account or the client IP of the request is locked.
+// It is called before the credentials are checked, so a locked account can't log in even with the correct password.
+func (t *LoginThrottle) Check(ctx context.Context, account string) (err error) {
+	ctx, span := startSpan(ctx, "LoginThrottle.Check")
+	defer func() { endSpan(span, err) }()
+
+	lockedUntil, err := t.failureRepo.LockedUntil(ctx, t.keys(ctx, account))
+	if err != nil {
+		return err
+	}
+
+	if wait := time.Until(lockedUntil); wait > 0 {
+		return domain.Errorf(domain.RATE_LIMIT_ERROR, "too many failed logins, try again in %s", wait.Round(time.Second))
+	}
+	return nil
+}
+
+// Fail counts a failed login of the account from the client IP of the request and delays or locks them.
+// It reports whether the account or the IP got locked.
+func (t *LoginThrottle) Fail(ctx context.Context, account string) (_ bool, err error) {
+	ctx, span := startSpan(ctx, "LoginThrottle.Fail")
+	defer func() { endSpan(span, err) }()
+
+	locked := false
+	now := time.Now()
+
+	failures, err := t.failureRepo.RecordFailure(ctx, account, t.policy.LockoutDuration)
+	if err != nil {
+		return false, err
+	}
+
+	switch {
+	case failures >= t.policy.MaxFailures:
+		locked = true
+		err = t.failureRepo.Lock(ctx, account, now.Add(t.policy.LockoutDuration))
+	case t.policy.Delay > 0:
+		err = t.failureRepo.Lock(ctx, account, now.Add(t.delay(failures)))
+	}
+	if err != nil {
+		return false, err
+	}
+
+	if ip := domain.ClientFromContext(ctx).IP; ip != "" {
+		failures, err := t.failureRepo.RecordFailure(ctx, "ip:"+ip, t.policy.LockoutDuration)
+		if err != nil {
+			return false, err
+		}
+
+		if failures >= t.policy.IPMaxFailures {
+			locked = true
+			err = t.failureRepo.Lock(ctx, "ip:"+ip, now.Add(t.policy.LockoutDuration))
+			if err != nil {
+				return false, err
+			}
+		}
+	}
+
+	return locked, nil
+}
+
+// Reset forgets the failures of the account and unlocks it, e.g. after a successful login or password reset.
+// The failures of the client IP are kept, as an attacker could reset them with an account of their own.
+func (t *LoginThrottle) Reset(ctx context.Context, account string) (err error) {
+	ctx, span := startSpan(ctx, "LoginThrottle.Reset")
+	defer func() { endSpan(span, err) }()
+
+	return t.failureRepo.Reset(ctx, account)
+}
+
+// DeleteStale removes the failures that are forgotten and returns how many were removed.
+func (t *LoginThrottle) DeleteStale(ctx context.Context) (int64, error) {
+	return t.failureRepo.DeleteStale(ctx, t.policy.LockoutDuration)
+}
+
+// keys returns the keys to check for the account and the client IP of the request.
+func (t *LoginThrottle) keys(ctx context.Context, account string) []string {
+	keys := []string{account}
+	if ip := domain.ClientFromContext(ctx).IP; ip != "" {
+		keys = append(keys, "ip:"+ip)
+	}
+	return keys
+}
+
+// delay returns the wait after the failures of an account, e.g. 1s, 2s, 4s, ..., at most the lockout duration.
+func (t *LoginThrottle) delay(failures int) time.Duration {
+	delay := t.policy.Delay
+	for i := 1; i < failures && delay < t.policy.LockoutDuration; i++ {
+		delay *= 2
+	}
+	return min(delay, t.policy.LockoutDuration)
+}
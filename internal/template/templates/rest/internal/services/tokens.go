@@ -0,0 +1,250 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"time"
+
+	"example.com/rest/internal/domain"
+	"example.com/rest/internal/logging"
+	"github.com/google/uuid"
+)
+
+// TokenService issues access tokens together with refresh tokens.
+// Access tokens are short-lived JWTs that can't be revoked, refresh tokens are opaque random strings
+// that are stored hashed and are rotated on every refresh.
+type TokenService struct {
+	refreshTokenRepo    RefreshTokenRepo
+	grants              GrantRepo
+	generateAccessToken func(principal *domain.Principal) (string, error)
+	refreshDuration     time.Duration
+}
+
+type RefreshTokenRepo interface {
+	Insert(ctx context.Context, token *domain.RefreshToken) error
+	GetByHash(ctx context.Context, tokenHash string) (*domain.RefreshToken, error)
+	Rotate(ctx context.Context, id int, next *domain.RefreshToken) error
+	RevokeFamily(ctx context.Context, familyID string) (int64, error)
+	RevokeUser(ctx context.Context, userID int) (int64, error)
+	DeleteExpired(ctx context.Context) (int64, error)
+}
+
+// GrantRepo provides the roles and permissions that are put into access tokens.
+type GrantRepo interface {
+	GetUserRoles(ctx context.Context, userID int) ([]string, error)
+	GetUserPermissions(ctx context.Context, userID int) ([]string, error)
+}
+
+// NewTokenService creates a new token service.
+// Refresh tokens are valid for the refreshDuration, rotating a token issues a new one with a full duration.
+func NewTokenService(repo RefreshTokenRepo, grants GrantRepo, generateAccessToken func(*domain.Principal) (string, error), refreshDuration time.Duration) *TokenService {
+	return &TokenService{
+		refreshTokenRepo:    repo,
+		grants:              grants,
+		generateAccessToken: generateAccessToken,
+		refreshDuration:     refreshDuration,
+	}
+}
+
+// errInvalidRefreshToken is returned for refresh tokens that are unknown, expired, used or revoked.
+// The client can't tell them apart, it has to log in again in any case.
+var errInvalidRefreshToken = domain.Errorf(domain.UNAUTHORIZED_ERROR, "invalid refresh token")
+
+// Issue starts a new token family for the user, it is called on login.
+func (s *TokenService) Issue(ctx context.Context, userID int) (_ *domain.Tokens, err error) {
+	ctx, span := startSpan(ctx, "TokenService.Issue")
+	defer func() { endSpan(span, err) }()
+
+	return s.issue(ctx, userID, uuid.New().String())
+}
+
+// Refresh exchanges a refresh token for a new access and refresh token in the same family.
+// Every refresh token can be used only once. If a used token is presented again, the token was
+// most likely stolen, so the whole family is revoked and both the attacker and the user have to log in again.
+func (s *TokenService) Refresh(ctx context.Context, req *domain.RefreshRequest) (_ *domain.Tokens, err error) {
+	ctx, span := startSpan(ctx, "TokenService.Refresh")
+	defer func() { endSpan(span, err) }()
+
+	// validate input
+	err = req.Validate()
+	if err != nil {
+		return nil, err
+	}
+
+	token, err := s.refreshTokenRepo.GetByHash(ctx, hashToken(req.RefreshToken))
+	if err != nil {
+		if errors.Is(err, domain.ErrNotFound) {
+			return nil, errInvalidRefreshToken
+		}
+		return nil, err
+	}
+
+	if token.RevokedAt != nil || time.Now().After(token.ExpiresAt) {
+		return nil, errInvalidRefreshToken
+	}
+
+	if token.UsedAt != nil {
+		return nil, s.revokeReused(ctx, token)
+	}
+
+	tokens, next, err := s.generate(ctx, token.UserID)
+	if err != nil {
+		return nil, err
+	}
+
+	// exchange the token for the new one in a single statement, this fails if a concurrent request used it first
+	err = s.refreshTokenRepo.Rotate(ctx, token.ID, next)
+	if err != nil {
+		if errors.Is(err, domain.ErrConflict) {
+			return nil, s.revokeReused(ctx, token)
+		}
+		return nil, err
+	}
+
+	return tokens, nil
+}
+
+// Logout revokes the family of the refresh token, which ends the session it belongs to.
+// The access tokens stay valid until they expire.
+// Unknown tokens and tokens of other users are ignored, so logging out twice is not an error.
+func (s *TokenService) Logout(ctx context.Context, userID int, req *domain.RefreshRequest) (err error) {
+	ctx, span := startSpan(ctx, "TokenService.Logout")
+	defer func() { endSpan(span, err) }()
+
+	err = Authorize(ctx, OwnsAccount(userID))
+	if err != nil {
+		return err
+	}
+
+	// validate input
+	err = req.Validate()
+	if err != nil {
+		return err
+	}
+
+	token, err := s.refreshTokenRepo.GetByHash(ctx, hashToken(req.RefreshToken))
+	if err != nil {
+		if errors.Is(err, domain.ErrNotFound) {
+			return nil
+		}
+		return err
+	}
+
+	if token.UserID != userID {
+		return nil
+	}
+
+	_, err = s.refreshTokenRepo.RevokeFamily(ctx, token.FamilyID)
+	return err
+}
+
+// LogoutAll revokes all refresh tokens of the user, which ends all of their sessions.
+func (s *TokenService) LogoutAll(ctx context.Context, userID int) (err error) {
+	ctx, span := startSpan(ctx, "TokenService.LogoutAll")
+	defer func() { endSpan(span, err) }()
+
+	err = Authorize(ctx, OwnsAccount(userID))
+	if err != nil {
+		return err
+	}
+
+	count, err := s.refreshTokenRepo.RevokeUser(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	logging.FromContext(ctx).Info("user logged out of all sessions", "revoked_tokens", count)
+	return nil
+}
+
+// DeleteExpired removes all expired refresh tokens and returns how many were removed.
+func (s *TokenService) DeleteExpired(ctx context.Context) (int64, error) {
+	return s.refreshTokenRepo.DeleteExpired(ctx)
+}
+
+// issue generates an access token and a refresh token in the family and stores the refresh token.
+func (s *TokenService) issue(ctx context.Context, userID int, familyID string) (*domain.Tokens, error) {
+	tokens, refreshToken, err := s.generate(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	refreshToken.FamilyID = familyID
+	err = s.refreshTokenRepo.Insert(ctx, refreshToken)
+	if err != nil {
+		return nil, err
+	}
+
+	return tokens, nil
+}
+
+// generate generates an access token and a refresh token for the user.
+// It returns the tokens for the client and the refresh token to store, without a family.
+// The access token carries the current roles and permissions of the user, so changes to them
+// take effect with the next refresh.
+func (s *TokenService) generate(ctx context.Context, userID int) (*domain.Tokens, *domain.RefreshToken, error) {
+	roles, err := s.grants.GetUserRoles(ctx, userID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	permissions, err := s.grants.GetUserPermissions(ctx, userID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	accessToken, err := s.generateAccessToken(&domain.Principal{UserID: userID, Roles: roles, Permissions: permissions})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	refreshToken, err := generateRefreshToken()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	tokens := &domain.Tokens{
+		AccessToken:  accessToken,
+		RefreshToken: refreshToken,
+	}
+	return tokens, &domain.RefreshToken{
+		UserID:    userID,
+		TokenHash: hashToken(refreshToken),
+		ExpiresAt: time.Now().Add(s.refreshDuration),
+	}, nil
+}
+
+// revokeReused revokes the family of a refresh token that was used twice.
+func (s *TokenService) revokeReused(ctx context.Context, token *domain.RefreshToken) error {
+	count, err := s.refreshTokenRepo.RevokeFamily(ctx, token.FamilyID)
+	if err != nil {
+		return err
+	}
+
+	logging.FromContext(ctx).Warn("refresh token reuse detected, token family revoked",
+		"token_user_id", token.UserID,
+		"family_id", token.FamilyID,
+		"revoked_tokens", count,
+	)
+	return errInvalidRefreshToken
+}
+
+// generateRefreshToken returns a random token with 256 bits of entropy.
+func generateRefreshToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// hashToken returns the hex encoded SHA-256 hash of the token.
+// A fast hash is enough, as the token is random and long, unlike a password.
+func hashToken(token string) string {
+	hash := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(hash[:])
+}
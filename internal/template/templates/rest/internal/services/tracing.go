@@ -0,0 +1,32 @@
+package services
+
+import (
+	"context"
+	"errors"
+
+	"example.com/rest/internal/domain"
+	"example.com/rest/internal/validator"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var tracer = otel.Tracer("example.com/rest/internal/services")
+
+// startSpan starts a span for a service operation.
+func startSpan(ctx context.Context, name string) (context.Context, trace.Span) {
+	return tracer.Start(ctx, name)
+}
+
+// endSpan records the error of the operation and ends the span.
+// Domain and validation errors caused by the client (invalid input, not found, ...) are not recorded as errors.
+func endSpan(span trace.Span, err error) {
+	var domainError *domain.Error
+	var validationError *validator.Error
+	clientError := errors.As(err, &validationError) || (errors.As(err, &domainError) && domainError.Code != domain.INTERNAL_ERROR)
+	if err != nil && !clientError {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
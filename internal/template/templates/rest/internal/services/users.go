@@ -3,58 +3,110 @@ package services
 import (
 	"context"
 	"errors"
+	"slices"
 
 	"example.com/rest/internal/domain"
-	"example.com/rest/internal/postgres"
-	"golang.org/x/crypto/bcrypt"
+	"example.com/rest/internal/logging"
 )
 
+// errStaleVersion is returned when the client modifies a user based on an outdated version.
+var errStaleVersion = domain.Errorf(domain.PRECONDITION_ERROR, "user has been modified, fetch the latest version and try again")
+
 type UserService struct {
-	userRepo UserRepo
+	userRepo  UserRepo
+	tx        Transactor
+	passwords *Passwords
+	throttle  *LoginThrottle
+	audit     *AuditService
+	counters  UserCounters
+}
+
+// Counter counts events, e.g. a Prometheus counter.
+type Counter interface {
+	Inc()
+}
+
+// UserCounters are incremented on user events.
+type UserCounters struct {
+	Registrations Counter
+	FailedLogins  Counter
 }
 
 type UserRepo interface {
 	Insert(ctx context.Context, email, passwordHash string) (int, error)
 	GetByID(ctx context.Context, id int) (*domain.User, error)
 	GetByEmail(ctx context.Context, email string) (*domain.User, error)
+	List(ctx context.Context, limit, offset int) ([]*domain.User, error)
 	Update(ctx context.Context, user *domain.User) (*domain.User, error)
-	Delete(ctx context.Context, id int) error
+	UpdatePasswordHash(ctx context.Context, id int, oldHash, newHash string) error
+	Delete(ctx context.Context, id, version int) error
 }
 
-func NewUserService(repo UserRepo) *UserService {
+// Transactor runs a function in a transaction, repositories called with the context passed to the function
+// take part in it, see postgres.TxManager. The function may be run again after a serialization failure,
+// so it must not have side effects outside of the database.
+type Transactor interface {
+	WithinTx(ctx context.Context, fn func(ctx context.Context) error) error
+}
+
+// errSerializationFailure is returned when a transaction still conflicts with concurrent ones after its retries.
+// It wraps the repository error, so the cause stays in the logs.
+var errSerializationFailure = domain.Errorf(domain.CONFLICT_ERROR, "concurrent update, try again")
+
+func NewUserService(repo UserRepo, tx Transactor, passwords *Passwords, throttle *LoginThrottle, audit *AuditService, counters UserCounters) *UserService {
 	return &UserService{
-		userRepo: repo,
+		userRepo:  repo,
+		tx:        tx,
+		passwords: passwords,
+		throttle:  throttle,
+		audit:     audit,
+		counters:  counters,
 	}
 }
 
-func (s *UserService) Create(ctx context.Context, req *domain.UserCredentials) (int, error) {
+func (s *UserService) Create(ctx context.Context, req *domain.UserCredentials) (_ int, err error) {
+	ctx, span := startSpan(ctx, "UserService.Create")
+	defer func() { endSpan(span, err) }()
+
 	// validate input
-	err := req.Validate()
+	err = req.Validate()
 	if err != nil {
 		return 0, err
 	}
 
 	// hash password
-	passwordHash, err := bcrypt.GenerateFromPassword([]byte(req.Password), bcrypt.DefaultCost)
+	passwordHash, err := s.passwords.hashNew(ctx, "password", req.Password)
 	if err != nil {
-		return 0, domain.Errorf(domain.INTERNAL_ERROR, "failed to hash password").Wrap(err)
+		return 0, err
 	}
 
 	// insert user
-	id, err := s.userRepo.Insert(ctx, req.Email, string(passwordHash))
+	id, err := s.userRepo.Insert(ctx, req.Email, passwordHash)
 	if err != nil {
-		if errors.Is(err, postgres.ErrConflict) {
+		if errors.Is(err, domain.ErrConflict) {
 			return 0, domain.Errorf(domain.CONFLICT_ERROR, "user already exists")
 		}
 		return 0, err
 	}
+
+	s.counters.Registrations.Inc()
+	logging.FromContext(ctx).Info("user created", "created_user_id", id)
 	return id, nil
 }
 
-func (s *UserService) GetByID(ctx context.Context, id int) (*domain.User, error) {
+func (s *UserService) GetByID(ctx context.Context, id int) (_ *domain.User, err error) {
+	ctx, span := startSpan(ctx, "UserService.GetByID")
+	defer func() { endSpan(span, err) }()
+
+	// users can read themselves, others need the permission
+	err = Authorize(ctx, IsOwner(id), HasPermission(PermissionUsersRead))
+	if err != nil {
+		return nil, err
+	}
+
 	user, err := s.userRepo.GetByID(ctx, id)
 	if err != nil {
-		if errors.Is(err, postgres.ErrNotFound) {
+		if errors.Is(err, domain.ErrNotFound) {
 			return nil, domain.Errorf(domain.NOTFOUND_ERROR, "user not found")
 		}
 		return nil, err
@@ -62,10 +114,26 @@ func (s *UserService) GetByID(ctx context.Context, id int) (*domain.User, error)
 	return user, nil
 }
 
-func (s *UserService) GetByEmail(ctx context.Context, email string) (*domain.User, error) {
+// List returns a page of users ordered by ID, it requires the users:read permission.
+func (s *UserService) List(ctx context.Context, limit, offset int) (_ []*domain.User, err error) {
+	ctx, span := startSpan(ctx, "UserService.List")
+	defer func() { endSpan(span, err) }()
+
+	err = Authorize(ctx, HasPermission(PermissionUsersRead))
+	if err != nil {
+		return nil, err
+	}
+
+	return s.userRepo.List(ctx, limit, offset)
+}
+
+func (s *UserService) GetByEmail(ctx context.Context, email string) (_ *domain.User, err error) {
+	ctx, span := startSpan(ctx, "UserService.GetByEmail")
+	defer func() { endSpan(span, err) }()
+
 	user, err := s.userRepo.GetByEmail(ctx, email)
 	if err != nil {
-		if errors.Is(err, postgres.ErrNotFound) {
+		if errors.Is(err, domain.ErrNotFound) {
 			return nil, domain.Errorf(domain.NOTFOUND_ERROR, "user not found")
 		}
 		return nil, err
@@ -73,9 +141,20 @@ func (s *UserService) GetByEmail(ctx context.Context, email string) (*domain.Use
 	return user, nil
 }
 
-func (s *UserService) Authenticate(ctx context.Context, req *domain.UserCredentials) (*domain.User, error) {
+// Authenticate checks the credentials and returns the user.
+// Failed attempts are throttled per account and client IP, see LoginThrottle, and recorded in the audit trail.
+func (s *UserService) Authenticate(ctx context.Context, req *domain.UserCredentials) (_ *domain.User, err error) {
+	ctx, span := startSpan(ctx, "UserService.Authenticate")
+	defer func() { endSpan(span, err) }()
+
 	// validate input
-	err := req.Validate()
+	err = req.Validate()
+	if err != nil {
+		return nil, err
+	}
+
+	// reject locked accounts and IPs before checking the password
+	err = s.throttle.Check(ctx, emailKey(req.Email))
 	if err != nil {
 		return nil, err
 	}
@@ -83,24 +162,83 @@ func (s *UserService) Authenticate(ctx context.Context, req *domain.UserCredenti
 	// find user
 	user, err := s.userRepo.GetByEmail(ctx, req.Email)
 	if err != nil {
-		if errors.Is(err, postgres.ErrNotFound) {
-			return nil, domain.Errorf(domain.UNAUTHORIZED_ERROR, "invalid credentials")
+		if errors.Is(err, domain.ErrNotFound) {
+			return nil, s.loginFailed(ctx, 0, req.Email)
 		}
 		return nil, err
 	}
 
 	// compare passwords
-	err = bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(req.Password))
+	ok, err := s.passwords.verify(ctx, user.PasswordHash, req.Password)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, s.loginFailed(ctx, user.ID, req.Email)
+	}
+
+	err = s.throttle.Reset(ctx, emailKey(req.Email))
 	if err != nil {
-		return nil, domain.Errorf(domain.UNAUTHORIZED_ERROR, "invalid credentials")
+		return nil, err
 	}
 
+	// replace hashes of an old algorithm or with old parameters while the password is known
+	if s.passwords.needsRehash(user.PasswordHash) {
+		s.rehash(ctx, user, req.Password)
+	}
+
+	s.audit.Record(ctx, domain.AuthEventLogin, user.ID, user.Email)
 	return user, nil
 }
 
-func (s *UserService) Update(ctx context.Context, id int, req *domain.UserPatch) (*domain.User, error) {
+// rehash stores a new hash of the password of the user.
+// A failure is logged but doesn't fail the login, the next login tries again.
+func (s *UserService) rehash(ctx context.Context, user *domain.User, password string) {
+	hash, err := s.passwords.hash(ctx, password)
+	if err != nil {
+		logging.FromContext(ctx).Error("failed to rehash password", "error", err)
+		return
+	}
+
+	// only replaces the verified hash, not one set concurrently, and keeps the version
+	err = s.userRepo.UpdatePasswordHash(ctx, user.ID, user.PasswordHash, hash)
+	if err != nil && !errors.Is(err, domain.ErrNotFound) {
+		logging.FromContext(ctx).Error("failed to rehash password", "error", err)
+	}
+}
+
+// loginFailed counts and records a failed login, the user ID is 0 for unknown emails.
+// It returns the error for the client.
+func (s *UserService) loginFailed(ctx context.Context, userID int, email string) error {
+	s.counters.FailedLogins.Inc()
+	s.audit.Record(ctx, domain.AuthEventLoginFailed, userID, email)
+
+	locked, err := s.throttle.Fail(ctx, emailKey(email))
+	if err != nil {
+		return err
+	}
+
+	if locked {
+		logging.FromContext(ctx).Warn("login locked after failed attempts", "login_user_id", userID)
+		s.audit.Record(ctx, domain.AuthEventLockout, userID, email)
+	}
+	return domain.Errorf(domain.UNAUTHORIZED_ERROR, "invalid credentials")
+}
+
+// Update applies the patch to the user.
+// If versions is not empty, the update only succeeds if the stored user still has one of those versions.
+// Only the user can update themselves, as the patch requires the current password.
+func (s *UserService) Update(ctx context.Context, id int, versions []int, req *domain.UserPatch) (_ *domain.User, err error) {
+	ctx, span := startSpan(ctx, "UserService.Update")
+	defer func() { endSpan(span, err) }()
+
+	err = Authorize(ctx, OwnsAccount(id))
+	if err != nil {
+		return nil, err
+	}
+
 	// validate input
-	err := req.Validate()
+	err = req.Validate()
 	if err != nil {
 		return nil, err
 	}
@@ -108,15 +246,23 @@ func (s *UserService) Update(ctx context.Context, id int, req *domain.UserPatch)
 	// get user
 	user, err := s.userRepo.GetByID(ctx, id)
 	if err != nil {
-		if errors.Is(err, postgres.ErrNotFound) {
+		if errors.Is(err, domain.ErrNotFound) {
 			return nil, domain.Errorf(domain.NOTFOUND_ERROR, "user not found")
 		}
 		return nil, err
 	}
 
+	// check that the client edited the current version
+	if len(versions) > 0 && !slices.Contains(versions, user.Version) {
+		return nil, errStaleVersion
+	}
+
 	// compare passwords
-	err = bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(req.Password))
+	ok, err := s.passwords.verify(ctx, user.PasswordHash, req.Password)
 	if err != nil {
+		return nil, err
+	}
+	if !ok {
 		return nil, domain.Errorf(domain.UNAUTHORIZED_ERROR, "invalid password")
 	}
 
@@ -126,44 +272,110 @@ func (s *UserService) Update(ctx context.Context, id int, req *domain.UserPatch)
 		if *req.Email == user.Email {
 			return nil, domain.Errorf(domain.CONFLICT_ERROR, "email already in use")
 		}
-		// update email
+		// update email, the new email has to be verified again
 		user.Email = *req.Email
+		user.EmailVerifiedAt = nil
 	}
 
 	if req.NewPassword != nil {
 		// compare old and new password
-		err = bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(*req.NewPassword))
-		if err == nil {
+		if *req.NewPassword == req.Password {
 			return nil, domain.Errorf(domain.CONFLICT_ERROR, "new password must be different")
 		}
 		// hash new password
-		hashedPassword, err := bcrypt.GenerateFromPassword([]byte(*req.NewPassword), bcrypt.DefaultCost)
+		hashedPassword, err := s.passwords.hashNew(ctx, "new_password", *req.NewPassword)
 		if err != nil {
-			return nil, domain.Errorf(domain.INTERNAL_ERROR, "failed to hash password").Wrap(err)
+			return nil, err
 		}
-		user.PasswordHash = string(hashedPassword)
+		user.PasswordHash = hashedPassword
 	}
 
-	// update user
-	user, err = s.userRepo.Update(ctx, user)
+	// update user and record the password change in one transaction
+	var updated *domain.User
+	err = s.tx.WithinTx(ctx, func(ctx context.Context) error {
+		updated, err = s.userRepo.Update(ctx, user)
+		if err != nil {
+			return err
+		}
+
+		if req.NewPassword != nil {
+			s.audit.Record(ctx, domain.AuthEventPasswordChanged, updated.ID, updated.Email)
+		}
+		return nil
+	})
 	if err != nil {
-		if errors.Is(err, postgres.ErrNotFound) {
+		switch {
+		case errors.Is(err, domain.ErrNotFound):
+			return nil, domain.Errorf(domain.NOTFOUND_ERROR, "user not found")
+		case errors.Is(err, domain.ErrStaleVersion):
+			if len(versions) > 0 {
+				return nil, errStaleVersion
+			}
 			return nil, domain.Errorf(domain.CONFLICT_ERROR, "update conflict")
+		case errors.Is(err, domain.ErrConflict):
+			return nil, domain.Errorf(domain.CONFLICT_ERROR, "email already in use")
+		case errors.Is(err, domain.ErrSerializationFailure):
+			return nil, errSerializationFailure.Wrap(err)
 		}
 		return nil, err
 	}
 
-	return user, nil
+	return updated, nil
 }
 
-func (s *UserService) Delete(ctx context.Context, id int) error {
-	err := s.userRepo.Delete(ctx, id)
+// Delete deletes the user.
+// If versions is not empty, the user is only deleted if the stored user still has one of those versions.
+func (s *UserService) Delete(ctx context.Context, id int, versions []int) (err error) {
+	ctx, span := startSpan(ctx, "UserService.Delete")
+	defer func() { endSpan(span, err) }()
+
+	// users can delete themselves, others need the permission
+	err = Authorize(ctx, OwnsAccount(id), HasPermission(PermissionUsersDelete))
+	if err != nil {
+		return err
+	}
+
+	// of several versions, the current one is deleted if it is among them
+	version := 0
+	switch {
+	case len(versions) == 1:
+		version = versions[0]
+	case len(versions) > 1:
+		user, err := s.userRepo.GetByID(ctx, id)
+		if err != nil {
+			if errors.Is(err, domain.ErrNotFound) {
+				return domain.Errorf(domain.NOTFOUND_ERROR, "user not found")
+			}
+			return err
+		}
+		if !slices.Contains(versions, user.Version) {
+			return errStaleVersion
+		}
+		version = user.Version
+	}
+
+	// delete user and record the deletion in one transaction
+	err = s.tx.WithinTx(ctx, func(ctx context.Context) error {
+		err := s.userRepo.Delete(ctx, id, version)
+		if err != nil {
+			return err
+		}
+
+		s.audit.Record(ctx, domain.AuthEventUserDeleted, id, "")
+		return nil
+	})
 	if err != nil {
-		if errors.Is(err, postgres.ErrNotFound) {
+		switch {
+		case errors.Is(err, domain.ErrNotFound):
 			return domain.Errorf(domain.NOTFOUND_ERROR, "user not found")
+		case errors.Is(err, domain.ErrStaleVersion):
+			return errStaleVersion
+		case errors.Is(err, domain.ErrSerializationFailure):
+			return errSerializationFailure.Wrap(err)
 		}
 		return err
 	}
 
+	logging.FromContext(ctx).Info("user deleted", "deleted_user_id", id)
 	return nil
 }
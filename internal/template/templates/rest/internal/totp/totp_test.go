@@ -0,0 +1,121 @@
+package totp
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// rfcSecret is the SHA1 secret of the test vectors of RFC 6238, "12345678901234567890" in base32.
+const rfcSecret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+// rfcVectors are the SHA1 test vectors of RFC 6238, Appendix B.
+// The RFC lists 8 digit codes, the 6 digit codes are their last 6 digits.
+var rfcVectors = []struct {
+	unix int64
+	code string
+}{
+	{59, "287082"},
+	{1111111109, "081804"},
+	{1111111111, "050471"},
+	{1234567890, "005924"},
+	{2000000000, "279037"},
+	{20000000000, "353130"},
+}
+
+func TestCode(t *testing.T) {
+	for _, tt := range rfcVectors {
+		got, err := Code(rfcSecret, time.Unix(tt.unix, 0))
+		if err != nil {
+			t.Fatalf("Code at %d: %v", tt.unix, err)
+		}
+		if got != tt.code {
+			t.Errorf("Code at %d = %s, want %s", tt.unix, got, tt.code)
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	for _, tt := range rfcVectors {
+		s, ok := Validate(rfcSecret, tt.code, time.Unix(tt.unix, 0))
+		if !ok {
+			t.Errorf("Validate(%s) at %d failed", tt.code, tt.unix)
+			continue
+		}
+		if want := tt.unix / 30; s != want {
+			t.Errorf("Validate(%s) at %d returned step %d, want %d", tt.code, tt.unix, s, want)
+		}
+	}
+}
+
+func TestValidateDrift(t *testing.T) {
+	// 1111111111 is in the step 37037037, 30 seconds of drift move it to the next or previous step
+	const unix, code, codeStep = 1111111111, "050471", 37037037
+
+	tests := []struct {
+		name  string
+		drift time.Duration
+		ok    bool
+	}{
+		{"same step", 0, true},
+		{"one step later", 30 * time.Second, true},
+		{"one step earlier", -30 * time.Second, true},
+		{"two steps later", 60 * time.Second, false},
+		{"two steps earlier", -60 * time.Second, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, ok := Validate(rfcSecret, code, time.Unix(unix, 0).Add(tt.drift))
+			if ok != tt.ok {
+				t.Fatalf("Validate = %v, want %v", ok, tt.ok)
+			}
+			// the step of the code is returned, not the current one, so it can't be replayed in the next step
+			if ok && s != codeStep {
+				t.Errorf("Validate returned step %d, want %d", s, codeStep)
+			}
+		})
+	}
+}
+
+func TestValidateInvalid(t *testing.T) {
+	at := time.Unix(59, 0)
+
+	tests := []struct {
+		name   string
+		secret string
+		code   string
+		ok     bool
+	}{
+		{"lowercase secret", strings.ToLower(rfcSecret), "287082", true},
+		{"wrong code", rfcSecret, "287083", false},
+		{"8 digits", rfcSecret, "94287082", false},
+		{"too short", rfcSecret, "28708", false},
+		{"empty code", rfcSecret, "", false},
+		{"invalid secret", "not base32!", "287082", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, ok := Validate(tt.secret, tt.code, at); ok != tt.ok {
+				t.Errorf("Validate = %v, want %v", ok, tt.ok)
+			}
+		})
+	}
+}
+
+func TestGenerateSecret(t *testing.T) {
+	secret, err := GenerateSecret()
+	if err != nil {
+		t.Fatalf("GenerateSecret: %v", err)
+	}
+	if len(secret) != 32 {
+		t.Errorf("secret %q has %d characters, want 32", secret, len(secret))
+	}
+
+	code, err := Code(secret, time.Now())
+	if err != nil {
+		t.Fatalf("Code: %v", err)
+	}
+	if _, ok := Validate(secret, code, time.Now()); !ok {
+		t.Error("Validate of a generated code failed")
+	}
+}
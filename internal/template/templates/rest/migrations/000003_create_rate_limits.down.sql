@@ -0,0 +1,5 @@
+BEGIN;
+
+DROP TABLE IF EXISTS rate_limits;
+
+COMMIT;
\ No newline at end of file
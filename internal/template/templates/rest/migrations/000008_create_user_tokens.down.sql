@@ -0,0 +1,7 @@
+BEGIN;
+
+DROP TABLE IF EXISTS user_tokens;
+
+ALTER TABLE users DROP COLUMN IF EXISTS email_verified_at;
+
+COMMIT;
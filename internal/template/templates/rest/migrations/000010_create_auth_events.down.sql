@@ -0,0 +1,6 @@
+BEGIN;
+
+DROP TABLE IF EXISTS auth_events;
+DROP TABLE IF EXISTS login_failures;
+
+COMMIT;
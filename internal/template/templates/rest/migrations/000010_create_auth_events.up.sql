@@ -0,0 +1,28 @@
+BEGIN;
+
+-- failed logins per account (key "email:...") or client IP (key "ip:...")
+CREATE TABLE login_failures (
+    key TEXT PRIMARY KEY,
+    failures INT NOT NULL,
+    last_failure_at TIMESTAMPTZ NOT NULL,
+    locked_until TIMESTAMPTZ
+);
+
+CREATE INDEX login_failures_last_failure_at_idx ON login_failures (last_failure_at);
+
+-- user_id has no foreign key, so the events of deleted users are kept
+CREATE TABLE auth_events (
+    id BIGINT PRIMARY KEY GENERATED ALWAYS AS IDENTITY,
+    type TEXT NOT NULL CHECK (type IN ('login', 'login_failed', 'lockout', 'password_changed', 'password_reset', 'user_deleted')),
+    user_id BIGINT,
+    email CITEXT,
+    request_id TEXT NOT NULL,
+    ip TEXT NOT NULL,
+    user_agent TEXT NOT NULL,
+    created_at TIMESTAMPTZ DEFAULT now() NOT NULL
+);
+
+CREATE INDEX auth_events_user_id_idx ON auth_events (user_id, created_at);
+CREATE INDEX auth_events_created_at_idx ON auth_events (created_at);
+
+COMMIT;
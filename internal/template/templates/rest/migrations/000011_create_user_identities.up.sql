@@ -0,0 +1,30 @@
+BEGIN;
+
+CREATE TABLE user_identities (
+    id BIGINT PRIMARY KEY GENERATED ALWAYS AS IDENTITY,
+    user_id BIGINT NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    provider TEXT NOT NULL,
+    subject TEXT NOT NULL,
+    email CITEXT NOT NULL,
+    created_at TIMESTAMPTZ DEFAULT now() NOT NULL,
+    last_login_at TIMESTAMPTZ DEFAULT now() NOT NULL,
+    UNIQUE (provider, subject)
+);
+
+CREATE INDEX user_identities_user_id_idx ON user_identities (user_id);
+
+-- pending sign ins, from the redirect to the provider until the callback
+CREATE TABLE oidc_states (
+    id BIGINT PRIMARY KEY GENERATED ALWAYS AS IDENTITY,
+    state_hash TEXT UNIQUE NOT NULL,
+    binding_hash TEXT NOT NULL, -- hash of the value the client that started the sign in holds
+    provider TEXT NOT NULL,
+    nonce TEXT NOT NULL,
+    code_verifier TEXT NOT NULL,
+    created_at TIMESTAMPTZ DEFAULT now() NOT NULL,
+    expires_at TIMESTAMPTZ NOT NULL
+);
+
+CREATE INDEX oidc_states_expires_at_idx ON oidc_states (expires_at);
+
+COMMIT;